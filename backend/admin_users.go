@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// validRoles lists the roles defined in permit-policy.json
+var validRoles = []string{"student", "teacher", "admin"}
+
+// listPageSize is how many users or teams are requested from Appwrite at once
+const listPageSize = 100
+
+// UserAccount mirrors an Appwrite user as returned by the Users API
+type UserAccount struct {
+	ID     string                 `json:"$id"`
+	Name   string                 `json:"name"`
+	Email  string                 `json:"email"`
+	Status bool                   `json:"status"`
+	Labels []string               `json:"labels"`
+	Prefs  map[string]interface{} `json:"prefs"`
+}
+
+// Roles returns the LMS roles recorded in the account labels. Labels can only
+// be changed with an API key, so unlike preferences they are safe to trust.
+func (u UserAccount) Roles() []string {
+	var roles []string
+	for _, label := range u.Labels {
+		if contains(validRoles, label) {
+			roles = append(roles, label)
+		}
+	}
+	return roles
+}
+
+// authorizeUserAction checks with Permit.io whether the current user may
+// perform action on the target user within the current tenant. Targets outside
+// the tenant, including members of any organization when acting in the
+// default tenant, are reported as not found. It writes an error response and
+// returns false when the request must not proceed.
+func (s *LMSService) authorizeUserAction(w http.ResponseWriter, r *http.Request, action, targetID string) (string, bool) {
+	userID, ok := s.authorize(w, r, action, &models.ResourceInput{
+		Type: "user",
+		Key:  targetID,
+	})
+	if !ok {
+		return "", false
+	}
+
+	if targetID != "" {
+		member, err := s.inTenant(targetID, getContextTenant(r))
+		if err != nil {
+			log.Printf("Failed to check organization of user %s: %v", targetID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to check organization membership")
+			return "", false
+		}
+		if !member {
+			respondWithError(w, http.StatusNotFound, "User not found")
+			return "", false
+		}
+	}
+
+	return userID, true
+}
+
+// getUserAccount loads a single Appwrite user by ID
+func (s *LMSService) getUserAccount(userID string) (*UserAccount, error) {
+	result, err := s.users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var account UserAccount
+	if err := json.Unmarshal([]byte(result.(string)), &account); err != nil {
+		return nil, fmt.Errorf("failed to parse user: %w", err)
+	}
+	return &account, nil
+}
+
+// listAllUsers returns every Appwrite user, following the pages of the
+// Users API until a short page comes back
+func (s *LMSService) listAllUsers(ctx context.Context) ([]UserAccount, error) {
+	var accounts []UserAccount
+	for {
+		queries := []interface{}{query.Limit(listPageSize)}
+		if len(accounts) > 0 {
+			queries = append(queries, query.CursorAfter(accounts[len(accounts)-1].ID))
+		}
+		result, err := s.users.List(ctx, queries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+
+		var page []UserAccount
+		if err := json.Unmarshal([]byte(result.(string)), &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal users: %w", err)
+		}
+		accounts = append(accounts, page...)
+		if len(page) < listPageSize {
+			return accounts, nil
+		}
+	}
+}
+
+// getUserAccounts loads the Appwrite users with the given IDs, a page of IDs
+// per request. Users that no longer exist are missing from the result.
+func (s *LMSService) getUserAccounts(ctx context.Context, userIDs []string) (map[string]UserAccount, error) {
+	accounts := make(map[string]UserAccount, len(userIDs))
+	for start := 0; start < len(userIDs); start += listPageSize {
+		end := start + listPageSize
+		if end > len(userIDs) {
+			end = len(userIDs)
+		}
+		result, err := s.users.List(ctx, []interface{}{
+			query.Equal("$id", userIDs[start:end]),
+			query.Limit(listPageSize),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+
+		var page []UserAccount
+		if err := json.Unmarshal([]byte(result.(string)), &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal users: %w", err)
+		}
+		for _, account := range page {
+			accounts[account.ID] = account
+		}
+	}
+	return accounts, nil
+}
+
+// ListUsers returns the users of the current tenant with their roles and status
+func (s *LMSService) ListUsers(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := s.authorizeUserAction(w, r, "read", "")
+	if !ok {
+		return
+	}
+
+	accounts, err := s.listAllUsers(r.Context())
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+
+	// Only list members of the admin's organization. Admins in the default
+	// tenant only see users outside every organization.
+	tenantID := getContextTenant(r)
+	var members map[string]bool
+	if tenantID == defaultTenant() {
+		members, err = s.organizationMembers(r.Context())
+	} else {
+		var ids []string
+		ids, err = s.tenantMembers(tenantID)
+		members = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			members[id] = true
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to list members of tenant %s: %v", tenantID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve users")
+		return
+	}
+
+	data := make([]map[string]interface{}, 0, len(accounts))
+	for _, account := range accounts {
+		member := members[account.ID]
+		if tenantID == defaultTenant() {
+			member = !member
+		}
+		if !member {
+			continue
+		}
+		data = append(data, map[string]interface{}{
+			"id":     account.ID,
+			"name":   account.Name,
+			"email":  account.Email,
+			"status": account.Status,
+			"roles":  account.Roles(),
+		})
+	}
+
+	log.Printf("Admin %s listed %d users", adminID, len(data))
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+		"meta": map[string]interface{}{
+			"total": len(data),
+		},
+	})
+}
+
+// UpdateUserRole replaces a user's role in Appwrite and Permit.io
+func (s *LMSService) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	targetID := mux.Vars(r)["id"]
+
+	adminID, ok := s.authorizeUserAction(w, r, "update", targetID)
+	if !ok {
+		return
+	}
+
+	var requestData struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if !contains(validRoles, requestData.Role) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Role must be one of %v", validRoles))
+		return
+	}
+
+	if targetID == adminID && requestData.Role != "admin" {
+		respondWithError(w, http.StatusBadRequest, "Admins cannot remove their own admin role")
+		return
+	}
+
+	account, err := s.getUserAccount(targetID)
+	if err != nil {
+		log.Printf("User not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	// Roles are account labels shared by every organization, so an admin of
+	// one organization must not change them for members of others
+	tenants, err := s.userTenants(targetID)
+	if err != nil {
+		log.Printf("Failed to get organizations of user %s: %v", targetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check organization membership")
+		return
+	}
+	if len(tenants) > 1 {
+		respondWithError(w, http.StatusConflict, "User belongs to several organizations, their role cannot be changed from one of them")
+		return
+	}
+
+	previousRoles := account.Roles()
+
+	if err := s.setUserRoles(r.Context(), account, []string{requestData.Role}); err != nil {
+		log.Printf("Failed to update roles for user %s: %v", targetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user role")
+		return
+	}
+
+	log.Printf("Admin %s changed roles of user %s from %v to [%s]",
+		adminID, targetID, previousRoles, requestData.Role)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"id":    targetID,
+			"roles": []string{requestData.Role},
+		},
+	})
+}
+
+// setUserRoles writes roles to the Appwrite labels of the account and brings
+// the Permit.io role assignments in step. Labels are global, so the roles are
+// synced to every tenant the user belongs to.
+func (s *LMSService) setUserRoles(ctx context.Context, account *UserAccount, roles []string) error {
+	previousRoles := account.Roles()
+
+	tenants, err := s.userTenants(account.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get tenants: %w", err)
+	}
+	if len(tenants) == 0 {
+		tenants = []string{defaultTenant()}
+	}
+
+	// Keep labels that are not LMS roles untouched
+	labels := make([]string, 0, len(account.Labels)+len(roles))
+	for _, label := range account.Labels {
+		if !contains(validRoles, label) {
+			labels = append(labels, label)
+		}
+	}
+	labels = append(labels, roles...)
+
+	if _, err := s.users.UpdateLabels(account.ID, labels); err != nil {
+		return fmt.Errorf("failed to update labels: %w", err)
+	}
+	account.Labels = labels
+
+	for _, tenantID := range tenants {
+		if err := s.syncPermitRoles(ctx, account.ID, previousRoles, roles, tenantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncPermitRoles replaces the previous role assignments of the user in the
+// given Permit.io tenant with roles.
+func (s *LMSService) syncPermitRoles(ctx context.Context, userID string, previousRoles, roles []string, tenantID string) error {
+	// Assign the new roles before removing old ones so the user is never
+	// left without a role in Permit.io
+	for _, role := range roles {
+		if contains(previousRoles, role) {
+			continue
+		}
+		if _, err := s.permit.Api.Users.AssignRole(ctx, userID, role, tenantID); err != nil {
+			return fmt.Errorf("failed to assign role %s in Permit.io: %w", role, err)
+		}
+	}
+	for _, role := range previousRoles {
+		if contains(roles, role) {
+			continue
+		}
+		if _, err := s.permit.Api.Users.UnassignRole(ctx, userID, role, tenantID); err != nil {
+			return fmt.Errorf("failed to unassign role %s in Permit.io: %w", role, err)
+		}
+	}
+
+	return nil
+}
+
+// DeactivateUser blocks a user from signing in
+func (s *LMSService) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserStatus(w, r, false)
+}
+
+// ReactivateUser restores a previously deactivated user
+func (s *LMSService) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserStatus(w, r, true)
+}
+
+func (s *LMSService) setUserStatus(w http.ResponseWriter, r *http.Request, active bool) {
+	targetID := mux.Vars(r)["id"]
+
+	adminID, ok := s.authorizeUserAction(w, r, "update", targetID)
+	if !ok {
+		return
+	}
+
+	if targetID == adminID && !active {
+		respondWithError(w, http.StatusBadRequest, "Admins cannot deactivate themselves")
+		return
+	}
+
+	if _, err := s.getUserAccount(targetID); err != nil {
+		log.Printf("User not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if _, err := s.users.UpdateStatus(targetID, active); err != nil {
+		log.Printf("Failed to update status for user %s: %v", targetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update user status")
+		return
+	}
+
+	// Deactivated users should not keep any open sessions
+	if !active {
+		if _, err := s.users.DeleteSessions(targetID); err != nil {
+			log.Printf("Warning: Failed to delete sessions for user %s: %v", targetID, err)
+		}
+	}
+
+	log.Printf("Admin %s set status of user %s to active=%t", adminID, targetID, active)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"id":     targetID,
+			"status": active,
+		},
+	})
+}
+
+// ImpersonateUser returns a read-only view of what the target user can see,
+// for debugging permissions. No session or token is issued for the user.
+func (s *LMSService) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	targetID := mux.Vars(r)["id"]
+
+	adminID, ok := s.authorizeUserAction(w, r, "impersonate", targetID)
+	if !ok {
+		return
+	}
+
+	account, err := s.getUserAccount(targetID)
+	if err != nil {
+		log.Printf("User not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	filter := CourseFilter{
+		TermID:          r.URL.Query().Get("termId"),
+		IncludeArchived: r.URL.Query().Get("includeArchived") == "true",
+	}
+
+	courses, total, err := s.listVisibleCourses(r.Context(), targetID, getContextTenant(r), filter)
+	if err != nil {
+		log.Printf("Failed to get courses for user %s: %v", targetID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve courses")
+		return
+	}
+
+	// Log impersonation for auditing
+	log.Printf("Admin %s impersonated user %s (read only)", adminID, targetID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"user": map[string]interface{}{
+				"id":     account.ID,
+				"name":   account.Name,
+				"email":  account.Email,
+				"status": account.Status,
+				"roles":  account.Roles(),
+			},
+			"courses": courses,
+		},
+		"meta": map[string]interface{}{
+			"readOnly":     true,
+			"totalCourses": total,
+		},
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultMaxFileSizeMB is the upload limit for assignments that set none
+const defaultMaxFileSizeMB = 25
+
+// attachmentContentTypes lists the content types http.DetectContentType may
+// report for files with these extensions. Office documents are zip archives.
+// Files with other extensions are not sniffed.
+var attachmentContentTypes = map[string][]string{
+	".pdf":  {"application/pdf"},
+	".png":  {"image/png"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".zip":  {"application/zip"},
+	".docx": {"application/zip"},
+	".xlsx": {"application/zip"},
+	".pptx": {"application/zip"},
+	".gz":   {"application/x-gzip"},
+	".txt":  {"text/plain"},
+	".md":   {"text/plain"},
+	".csv":  {"text/plain"},
+}
+
+// Attachment is a file a student uploaded for an assignment. The file itself
+// lives in the submissions storage bucket; submissions reference attachments
+// by ID.
+type Attachment struct {
+	ID           string `json:"$id"`
+	FileID       string `json:"fileId"`
+	AssignmentID string `json:"assignmentId"`
+	StudentID    string `json:"studentId"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+	SizeBytes    int64  `json:"sizeBytes"`
+	SHA256       string `json:"sha256"`
+	ScanStatus   string `json:"scanStatus"` // clean or not_scanned
+	TenantID     string `json:"tenantId"`
+}
+
+func attachmentsCollectionID() string {
+	return getEnv("APPWRITE_ATTACHMENTS_COLLECTION_ID", "attachments")
+}
+
+func submissionsBucketID() string {
+	return getEnv("APPWRITE_SUBMISSIONS_BUCKET_ID", "submissions")
+}
+
+// scanStatus reports whether uploads are virus scanned. Appwrite rejects
+// infected files in buckets with antivirus enabled, so every stored file in
+// such a bucket is clean.
+func scanStatus() string {
+	if getEnv("APPWRITE_BUCKET_ANTIVIRUS", "false") == "true" {
+		return "clean"
+	}
+	return "not_scanned"
+}
+
+// getAttachment loads an attachment by ID. Attachments of other tenants are
+// reported as not found.
+func (s *LMSService) getAttachment(attachmentID, tenantID string) (*Attachment, error) {
+	doc, err := s.db.GetDocument(s.databaseID, attachmentsCollectionID(), attachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment Attachment
+	if err := json.Unmarshal([]byte(doc.(string)), &attachment); err != nil {
+		return nil, fmt.Errorf("failed to parse attachment: %w", err)
+	}
+
+	if attachment.TenantID != tenantID {
+		return nil, fmt.Errorf("attachment %s not found", attachmentID)
+	}
+	return &attachment, nil
+}
+
+// attachmentMaxSizeMB returns the upload limit of the assignment
+func attachmentMaxSizeMB(assignment *Assignment) int {
+	if assignment.MaxFileSizeMB <= 0 {
+		return defaultMaxFileSizeMB
+	}
+	return assignment.MaxFileSizeMB
+}
+
+// checkAttachmentAllowed returns an error when the file does not meet the
+// assignment's size and type limits
+func checkAttachmentAllowed(assignment *Assignment, name string, size int64) error {
+	maxSizeMB := attachmentMaxSizeMB(assignment)
+	if size > int64(maxSizeMB)*1024*1024 {
+		return fmt.Errorf("file exceeds the %d MB limit", maxSizeMB)
+	}
+
+	if len(assignment.AllowedFileTypes) == 0 {
+		return nil
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, allowed := range assignment.AllowedFileTypes {
+		if strings.ToLower(allowed) == ext {
+			return nil
+		}
+	}
+	return fmt.Errorf("file type %q is not allowed, expected one of %s",
+		ext, strings.Join(assignment.AllowedFileTypes, ", "))
+}
+
+// checkAttachmentContent returns an error when the content of the file does
+// not match its extension, e.g. an executable renamed to .pdf
+func checkAttachmentContent(name string, data []byte) error {
+	ext := strings.ToLower(filepath.Ext(name))
+	expected, ok := attachmentContentTypes[ext]
+	if !ok {
+		return nil
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	for _, allowed := range expected {
+		if contentType == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("file content %q does not match the %q extension", contentType, ext)
+}
+
+// UploadAttachment stores a file for the current student's next submission.
+// Only the student, the course teacher and section instructors can download it.
+func (s *LMSService) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	if !contains(course.StudentIDs, userID) {
+		respondWithError(w, http.StatusForbidden, "Only enrolled students can upload attachments")
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	// Leave room for the multipart headers
+	maxSizeMB := attachmentMaxSizeMB(assignment)
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxSizeMB+1)<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds the %d MB limit", maxSizeMB))
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Missing file")
+		return
+	}
+	defer file.Close()
+
+	if err := checkAttachmentAllowed(assignment, header.Filename, header.Size); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+	if err := checkAttachmentContent(header.Filename, data); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	hash := sha256.Sum256(data)
+
+	instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get course sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+		return
+	}
+
+	permissions := []string{
+		fmt.Sprintf(`read("user:%s")`, userID),
+		fmt.Sprintf(`read("user:%s")`, course.TeacherID),
+	}
+	for _, id := range instructorIDs {
+		permissions = append(permissions, fmt.Sprintf(`read("user:%s")`, id))
+	}
+
+	stored, err := s.storage.CreateFile(
+		r.Context(),
+		submissionsBucketID(),
+		"unique()",
+		header.Filename,
+		data,
+		permissions,
+	)
+	if err != nil {
+		log.Printf("Failed to store attachment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to store attachment")
+		return
+	}
+
+	attachment := map[string]interface{}{
+		"fileId":       stored.Get("$id"),
+		"assignmentId": assignment.ID,
+		"studentId":    userID,
+		"name":         header.Filename,
+		"mimeType":     http.DetectContentType(data),
+		"sizeBytes":    len(data),
+		"sha256":       hex.EncodeToString(hash[:]),
+		"scanStatus":   scanStatus(),
+		"tenantId":     assignment.TenantID,
+	}
+
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		attachmentsCollectionID(),
+		"unique()",
+		attachment,
+	)
+	if err != nil {
+		log.Printf("Failed to create attachment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create attachment")
+		return
+	}
+
+	log.Printf("User %s uploaded attachment %s for assignment %s", userID, doc.Get("$id"), assignment.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    doc,
+	})
+}
+
+// DownloadAttachment streams an attachment to its student or to a user who
+// may grade the assignment
+func (s *LMSService) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	user, ok := getContextUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID, _ := user["id"].(string)
+
+	attachment, err := s.getAttachment(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil {
+		log.Printf("Attachment not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	if attachment.StudentID != userID {
+		if _, _, _, ok := s.loadAssignmentCourse(w, r, attachment.AssignmentID, "grade"); !ok {
+			return
+		}
+	}
+
+	s.serveAttachment(w, attachment)
+}
+
+// serveAttachment writes the file of an attachment to the response
+func (s *LMSService) serveAttachment(w http.ResponseWriter, attachment *Attachment) {
+	data, err := s.storage.GetFileDownload(submissionsBucketID(), attachment.FileID)
+	if err != nil {
+		log.Printf("Failed to download attachment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to download attachment")
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.Name))
+	w.Header().Set("X-Content-SHA256", attachment.SHA256)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
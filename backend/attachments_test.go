@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestCheckAttachmentAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		assignment Assignment
+		file       string
+		size       int64
+		wantErr    bool
+	}{
+		{
+			name: "any type under the default limit",
+			file: "essay.odt",
+			size: defaultMaxFileSizeMB * 1024 * 1024,
+		},
+		{
+			name:    "over the default limit",
+			file:    "essay.pdf",
+			size:    defaultMaxFileSizeMB*1024*1024 + 1,
+			wantErr: true,
+		},
+		{
+			name:       "over the assignment's limit",
+			assignment: Assignment{MaxFileSizeMB: 1},
+			file:       "essay.pdf",
+			size:       1024*1024 + 1,
+			wantErr:    true,
+		},
+		{
+			name:       "allowed type in another case",
+			assignment: Assignment{AllowedFileTypes: []string{".pdf", ".docx"}},
+			file:       "Essay.PDF",
+			size:       1024,
+		},
+		{
+			name:       "type not allowed",
+			assignment: Assignment{AllowedFileTypes: []string{".pdf"}},
+			file:       "essay.pdf.exe",
+			size:       1024,
+			wantErr:    true,
+		},
+		{
+			name:       "file without extension",
+			assignment: Assignment{AllowedFileTypes: []string{".pdf"}},
+			file:       "essay",
+			size:       1024,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAttachmentAllowed(&tt.assignment, tt.file, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAttachmentAllowed(%q, %d) error = %v, want error = %v", tt.file, tt.size, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckAttachmentContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		wantErr bool
+	}{
+		{
+			name: "PDF",
+			file: "essay.pdf",
+			data: []byte("%PDF-1.7\n1 0 obj"),
+		},
+		{
+			name:    "executable renamed to PDF",
+			file:    "essay.pdf",
+			data:    []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"),
+			wantErr: true,
+		},
+		{
+			name: "Office document is a zip archive",
+			file: "essay.DOCX",
+			data: []byte("PK\x03\x04\x14\x00\x06\x00"),
+		},
+		{
+			name:    "HTML renamed to text",
+			file:    "notes.txt",
+			data:    []byte("<html><script>alert(1)</script></html>"),
+			wantErr: true,
+		},
+		{
+			name: "extensions that are not sniffed",
+			file: "main.go",
+			data: []byte("MZ\x90\x00"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAttachmentContent(tt.file, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAttachmentContent(%q) error = %v, want error = %v", tt.file, err, tt.wantErr)
+			}
+		})
+	}
+}
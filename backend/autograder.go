@@ -0,0 +1,744 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// AssignmentTypeProgramming marks assignments whose submissions are graded by
+// running the teacher's test suite in a sandbox
+const AssignmentTypeProgramming = "programming"
+
+// Autograde run states
+const (
+	AutogradeQueued    = "queued"
+	AutogradeRunning   = "running"
+	AutogradeCompleted = "completed"
+	AutogradeFailed    = "failed"
+)
+
+// autograderPollInterval is how often idle workers look for queued runs
+const autograderPollInterval = 5 * time.Second
+
+// AutogradeRun is one run of an assignment's test suite against a
+// submission. The runs collection is the autograder's queue: submit_assignment
+// and regrade requests add queued runs, and the backend's workers run them.
+// Test results are stored as parallel arrays.
+type AutogradeRun struct {
+	ID           string   `json:"$id"`
+	SubmissionID string   `json:"submissionId"`
+	AssignmentID string   `json:"assignmentId"`
+	StudentID    string   `json:"studentId"`
+	Status       string   `json:"status"` // queued, running, completed or failed
+	TestNames    []string `json:"testNames"`
+	TestPassed   []bool   `json:"testPassed"`
+	TestPoints   []int    `json:"testPoints"`
+	TestMessages []string `json:"testMessages"`
+	Passed       int      `json:"passed"` // Number of passing tests
+	Total        int      `json:"total"`
+	Score        int      `json:"score"` // Share of test points earned, 0-100
+	Output       string   `json:"output"`
+	ExitCode     int      `json:"exitCode"`
+	TimedOut     bool     `json:"timedOut"`
+	Error        string   `json:"error"` // Why a failed run could not run the tests
+	QueuedAt     string   `json:"queuedAt"`
+	StartedAt    string   `json:"startedAt"`
+	FinishedAt   string   `json:"finishedAt"`
+	TenantID     string   `json:"tenantId"`
+}
+
+func autogradeRunsCollectionID() string {
+	return getEnv("APPWRITE_AUTOGRADE_RUNS_COLLECTION_ID", "autograde_runs")
+}
+
+func testSuitesBucketID() string {
+	return getEnv("APPWRITE_TEST_SUITES_BUCKET_ID", "test_suites")
+}
+
+// scoreTests returns the share of test points earned, scaled to 0-100
+func scoreTests(tests []TestResult) int {
+	earned, total := 0, 0
+	for _, test := range tests {
+		total += test.Points
+		if test.Passed {
+			earned += test.Points
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return int(math.Round(float64(earned) * 100 / float64(total)))
+}
+
+// getAutogradeRun loads an autograde run by ID
+func (s *LMSService) getAutogradeRun(runID string) (*AutogradeRun, error) {
+	doc, err := s.db.GetDocument(s.databaseID, autogradeRunsCollectionID(), runID)
+	if err != nil {
+		return nil, err
+	}
+
+	var run AutogradeRun
+	if err := json.Unmarshal([]byte(doc.(string)), &run); err != nil {
+		return nil, fmt.Errorf("failed to parse autograde run: %w", err)
+	}
+	return &run, nil
+}
+
+// listAutogradeRuns returns the autograde runs matching the queries, oldest
+// first
+func (s *LMSService) listAutogradeRuns(ctx context.Context, queries []interface{}) ([]AutogradeRun, error) {
+	documents, err := s.db.ListDocuments(ctx, s.databaseID, autogradeRunsCollectionID(), queries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list autograde runs: %w", err)
+	}
+
+	var runs []AutogradeRun
+	if err := json.Unmarshal([]byte(documents.(string)), &runs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal autograde runs: %w", err)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].QueuedAt < runs[j].QueuedAt
+	})
+	return runs, nil
+}
+
+// enqueueAutograde queues a run of the assignment's test suite against the
+// submission and returns the run's ID
+func (s *LMSService) enqueueAutograde(ctx context.Context, submission *Submission) (string, error) {
+	doc, err := s.db.CreateDocument(
+		ctx,
+		s.databaseID,
+		autogradeRunsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"submissionId": submission.ID,
+			"assignmentId": submission.AssignmentID,
+			"studentId":    submission.StudentID,
+			"status":       AutogradeQueued,
+			"queuedAt":     time.Now().Format(time.RFC3339),
+			"tenantId":     submission.TenantID,
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to queue autograde run: %w", err)
+	}
+
+	runID := fmt.Sprint(doc.Get("$id"))
+	if err := s.setAutogradeStatus(submission.ID, runID, AutogradeQueued); err != nil {
+		return "", err
+	}
+	return runID, nil
+}
+
+// setAutogradeStatus records the latest autograde run of a submission
+func (s *LMSService) setAutogradeStatus(submissionID, runID, status string) error {
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		submissionsCollectionID(),
+		submissionID,
+		map[string]interface{}{
+			"autogradeRunId":  runID,
+			"autogradeStatus": status,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update autograde status of submission: %w", err)
+	}
+	return nil
+}
+
+// updateAutogradeRun stores changes to a run
+func (s *LMSService) updateAutogradeRun(runID string, data map[string]interface{}) error {
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		autogradeRunsCollectionID(),
+		runID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update autograde run: %w", err)
+	}
+	return nil
+}
+
+// RunAutograder runs queued autograde runs with the given number of workers
+// until ctx is done. Runs left running by a previous process are queued
+// again, so only one backend instance may run the autograder.
+func (s *LMSService) RunAutograder(ctx context.Context, workers int) {
+	stale, err := s.listAutogradeRuns(ctx, []interface{}{query.Equal("status", AutogradeRunning)})
+	if err != nil {
+		log.Printf("Failed to get interrupted autograde runs: %v", err)
+	}
+	for _, run := range stale {
+		if err := s.updateAutogradeRun(run.ID, map[string]interface{}{"status": AutogradeQueued}); err != nil {
+			log.Printf("Failed to requeue autograde run %s: %v", run.ID, err)
+		}
+	}
+
+	var (
+		mu       sync.Mutex
+		inFlight = make(map[string]bool)
+	)
+	jobs := make(chan AutogradeRun)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for run := range jobs {
+				s.processAutogradeRun(ctx, run)
+				mu.Lock()
+				delete(inFlight, run.ID)
+				mu.Unlock()
+			}
+		}()
+	}
+	defer close(jobs)
+
+	log.Printf("Autograder started with %d workers", workers)
+
+	ticker := time.NewTicker(autograderPollInterval)
+	defer ticker.Stop()
+	for {
+		queued, err := s.listAutogradeRuns(ctx, []interface{}{query.Equal("status", AutogradeQueued)})
+		if err != nil {
+			log.Printf("Failed to get queued autograde runs: %v", err)
+		}
+
+		for _, run := range queued {
+			mu.Lock()
+			busy := inFlight[run.ID]
+			inFlight[run.ID] = true
+			mu.Unlock()
+			if busy {
+				continue
+			}
+
+			select {
+			case jobs <- run:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processAutogradeRun runs the test suite of a queued run and grades the
+// submission with the share of test points earned
+func (s *LMSService) processAutogradeRun(ctx context.Context, run AutogradeRun) {
+	startedAt := time.Now().Format(time.RFC3339)
+	err := s.updateAutogradeRun(run.ID, map[string]interface{}{
+		"status":    AutogradeRunning,
+		"startedAt": startedAt,
+	})
+	if err == nil {
+		err = s.setAutogradeStatus(run.SubmissionID, run.ID, AutogradeRunning)
+	}
+	if err != nil {
+		log.Printf("Failed to start autograde run %s: %v", run.ID, err)
+		return
+	}
+
+	result, submission, err := s.executeAutogradeRun(ctx, run)
+	if err != nil {
+		log.Printf("Autograde run %s failed: %v", run.ID, err)
+		if err := s.updateAutogradeRun(run.ID, map[string]interface{}{
+			"status":     AutogradeFailed,
+			"error":      err.Error(),
+			"finishedAt": time.Now().Format(time.RFC3339),
+		}); err != nil {
+			log.Printf("Failed to record failure of autograde run %s: %v", run.ID, err)
+		}
+		if err := s.setAutogradeStatus(run.SubmissionID, run.ID, AutogradeFailed); err != nil {
+			log.Printf("Failed to record failure of autograde run %s: %v", run.ID, err)
+		}
+		return
+	}
+
+	data := map[string]interface{}{
+		"status":     AutogradeCompleted,
+		"output":     result.Output,
+		"exitCode":   result.ExitCode,
+		"timedOut":   result.TimedOut,
+		"finishedAt": time.Now().Format(time.RFC3339),
+	}
+	var names, messages []string
+	var passed []bool
+	var points []int
+	passing := 0
+	for _, test := range result.Tests {
+		names = append(names, test.Name)
+		passed = append(passed, test.Passed)
+		points = append(points, test.Points)
+		messages = append(messages, test.Message)
+		if test.Passed {
+			passing++
+		}
+	}
+	score := scoreTests(result.Tests)
+	data["testNames"] = names
+	data["testPassed"] = passed
+	data["testPoints"] = points
+	data["testMessages"] = messages
+	data["passed"] = passing
+	data["total"] = len(result.Tests)
+	data["score"] = score
+
+	if err := s.updateAutogradeRun(run.ID, data); err != nil {
+		log.Printf("Failed to store results of autograde run %s: %v", run.ID, err)
+		return
+	}
+	if err := s.setAutogradeStatus(submission.ID, run.ID, AutogradeCompleted); err != nil {
+		log.Printf("Failed to complete autograde run %s: %v", run.ID, err)
+		return
+	}
+
+	// Feedback a grader wrote is kept when the submission is regraded
+	feedback := submission.Feedback
+	if feedback == "" {
+		feedback = fmt.Sprintf("Passed %d of %d tests", passing, len(result.Tests))
+		if result.TimedOut {
+			feedback += " (time limit exceeded)"
+		}
+	}
+	if err := s.saveGrade(ctx, submission, score, feedback, "", "Graded automatically", GradeSourceAutograder); err != nil {
+		log.Printf("Failed to grade submission %s of autograde run %s: %v", submission.ID, run.ID, err)
+		return
+	}
+
+	assignment, err := s.getAssignment(run.AssignmentID, run.TenantID)
+	if err != nil {
+		log.Printf("Failed to get assignment of autograde run %s: %v", run.ID, err)
+		return
+	}
+	if assignment.GradingRule == "best" {
+		if err := s.countBestAttempt(ctx, assignment, submission.StudentID); err != nil {
+			log.Printf("Failed to update counted attempt after autograde run %s: %v", run.ID, err)
+		}
+	}
+
+	log.Printf("Autograde run %s of submission %s passed %d of %d tests", run.ID, submission.ID, passing, len(result.Tests))
+}
+
+// executeAutogradeRun prepares the sandbox with the test suite and the
+// submission's files and runs the tests
+func (s *LMSService) executeAutogradeRun(ctx context.Context, run AutogradeRun) (*SandboxResult, *Submission, error) {
+	submission, err := s.getSubmission(run.SubmissionID, run.TenantID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("submission not found: %w", err)
+	}
+	assignment, err := s.getAssignment(run.AssignmentID, run.TenantID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("assignment not found: %w", err)
+	}
+	if assignment.TestSuiteFileID == "" || assignment.TestCommand == "" {
+		return nil, nil, fmt.Errorf("assignment has no test suite")
+	}
+
+	dir, err := newSandboxDir()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create sandbox directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	suite, err := s.storage.GetFileDownload(testSuitesBucketID(), assignment.TestSuiteFileID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download test suite: %w", err)
+	}
+	if err := writeSandboxFile(filepath.Join(dir, "tests"), assignment.TestSuiteName, suite); err != nil {
+		return nil, nil, fmt.Errorf("failed to unpack test suite: %w", err)
+	}
+
+	submissionDir := filepath.Join(dir, "submission")
+	if submission.Content != "" {
+		if err := os.WriteFile(filepath.Join(submissionDir, "content.txt"), []byte(submission.Content), 0644); err != nil {
+			return nil, nil, fmt.Errorf("failed to write submission content: %w", err)
+		}
+	}
+	for _, attachmentID := range submission.AttachmentIDs {
+		attachment, err := s.getAttachment(attachmentID, run.TenantID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("attachment %s not found: %w", attachmentID, err)
+		}
+		data, err := s.storage.GetFileDownload(submissionsBucketID(), attachment.FileID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to download attachment %s: %w", attachmentID, err)
+		}
+		if err := writeSandboxFile(submissionDir, attachment.Name, data); err != nil {
+			return nil, nil, fmt.Errorf("failed to unpack attachment %s: %w", attachment.Name, err)
+		}
+	}
+
+	image := assignment.SandboxImage
+	if image == "" {
+		image = getEnv("AUTOGRADER_DEFAULT_IMAGE", defaultSandboxImage)
+	}
+	// The allowlist may have changed since the suite was set up
+	if !sandboxImageAllowed(image) {
+		return nil, nil, fmt.Errorf("sandbox image %q is not allowed", image)
+	}
+
+	result, err := runSandbox(ctx, dir, "autograde-"+run.ID, image, assignment.TestCommand, sandboxLimits(assignment))
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, submission, nil
+}
+
+// GetTestSuite returns the test suite settings of an assignment
+func (s *LMSService) GetTestSuite(w http.ResponseWriter, r *http.Request) {
+	_, assignment, _, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "grade")
+	if !ok {
+		return
+	}
+
+	limits := sandboxLimits(assignment)
+	image := assignment.SandboxImage
+	if image == "" {
+		image = getEnv("AUTOGRADER_DEFAULT_IMAGE", defaultSandboxImage)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"testSuiteName":    assignment.TestSuiteName,
+			"testCommand":      assignment.TestCommand,
+			"sandboxImage":     image,
+			"timeLimitSeconds": int(limits.TimeLimit / time.Second),
+			"memoryLimitMB":    limits.MemoryMB,
+			"cpuLimit":         limits.CPUs,
+		},
+	})
+}
+
+// UpdateTestSuite uploads the test suite of an assignment and sets how it is
+// run. The form takes the suite as file, which may be left out to keep the
+// current one, and command, image, timeLimitSeconds, memoryLimitMB and
+// cpuLimit. The assignment becomes a programming assignment. Submissions
+// already graded keep their grades until they are autograded again.
+func (s *LMSService) UpdateTestSuite(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	// Leave room for the other form fields
+	r.Body = http.MaxBytesReader(w, r.Body, (maxTestSuiteSizeMB+1)<<20)
+	if err := r.ParseMultipartForm(maxTestSuiteSizeMB << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Test suite exceeds the %d MB limit", maxTestSuiteSizeMB))
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	command := r.FormValue("command")
+	if command == "" {
+		respondWithError(w, http.StatusBadRequest, "Command is required")
+		return
+	}
+
+	image := r.FormValue("image")
+	if image != "" && !sandboxImageAllowed(image) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Image %q is not allowed", image))
+		return
+	}
+
+	data := map[string]interface{}{
+		"type":         AssignmentTypeProgramming,
+		"testCommand":  command,
+		"sandboxImage": image,
+	}
+
+	// Limits left out use the defaults, stored as 0
+	limits := []struct {
+		field     string
+		attribute string
+		max       float64
+		integer   bool
+	}{
+		{"timeLimitSeconds", "testTimeLimitSeconds", maxTestTimeLimit, true},
+		{"memoryLimitMB", "testMemoryLimitMB", maxTestMemoryLimit, true},
+		{"cpuLimit", "testCPULimit", maxTestCPULimit, false},
+	}
+	for _, limit := range limits {
+		value := 0.0
+		if raw := r.FormValue(limit.field); raw != "" {
+			parsed, err := strconv.ParseFloat(raw, 64)
+			if err != nil || parsed <= 0 || parsed > limit.max {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be above 0 and at most %g", limit.field, limit.max))
+				return
+			}
+			value = parsed
+		}
+		if limit.integer {
+			data[limit.attribute] = int(value)
+		} else {
+			data[limit.attribute] = value
+		}
+	}
+
+	file, header, err := r.FormFile("file")
+	switch {
+	case err == http.ErrMissingFile:
+		if assignment.TestSuiteFileID == "" {
+			respondWithError(w, http.StatusBadRequest, "Missing file")
+			return
+		}
+	case err != nil:
+		respondWithError(w, http.StatusBadRequest, "Invalid file")
+		return
+	default:
+		defer file.Close()
+		suite, err := io.ReadAll(file)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Failed to read file")
+			return
+		}
+
+		instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+		if err != nil {
+			log.Printf("Failed to get course sections: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+			return
+		}
+
+		// Test suites may hold expected answers, so students cannot read them
+		permissions := []string{fmt.Sprintf(`read("user:%s")`, course.TeacherID)}
+		for _, id := range instructorIDs {
+			permissions = append(permissions, fmt.Sprintf(`read("user:%s")`, id))
+		}
+
+		stored, err := s.storage.CreateFile(
+			r.Context(),
+			testSuitesBucketID(),
+			"unique()",
+			header.Filename,
+			suite,
+			permissions,
+		)
+		if err != nil {
+			log.Printf("Failed to store test suite: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to store test suite")
+			return
+		}
+		data["testSuiteFileId"] = stored.Get("$id")
+		data["testSuiteName"] = header.Filename
+	}
+
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignment.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update test suite: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update test suite")
+		return
+	}
+
+	// The replaced suite is no longer used
+	if _, replaced := data["testSuiteFileId"]; replaced && assignment.TestSuiteFileID != "" {
+		if _, err := s.storage.DeleteFile(testSuitesBucketID(), assignment.TestSuiteFileID); err != nil {
+			log.Printf("Warning: Failed to delete replaced test suite: %v", err)
+		}
+	}
+
+	log.Printf("User %s updated the test suite of assignment %s", userID, assignment.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// GetAutogradeResults returns the latest autograde run of a submission.
+// Students see the test results of their own submissions once grades are
+// released, and only the run's status before.
+func (s *LMSService) GetAutogradeResults(w http.ResponseWriter, r *http.Request) {
+	user, ok := getContextUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID, _ := user["id"].(string)
+
+	submission, err := s.getSubmission(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil || submission.Status == SubmissionStatusDraft {
+		log.Printf("Submission not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+
+	action := "read"
+	if submission.StudentID != userID {
+		action = "grade"
+	}
+	_, assignment, course, ok := s.loadAssignmentCourse(w, r, submission.AssignmentID, action)
+	if !ok {
+		return
+	}
+
+	if submission.AutogradeRunID == "" {
+		respondWithError(w, http.StatusNotFound, "Submission was not autograded")
+		return
+	}
+	run, err := s.getAutogradeRun(submission.AutogradeRunID)
+	if err != nil || run.TenantID != submission.TenantID {
+		log.Printf("Autograde run not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Autograde run not found")
+		return
+	}
+
+	now := time.Now()
+	if action == "read" && !gradesReleased(assignment, course, now) {
+		run = &AutogradeRun{
+			ID:           run.ID,
+			SubmissionID: run.SubmissionID,
+			AssignmentID: run.AssignmentID,
+			StudentID:    run.StudentID,
+			Status:       run.Status,
+			QueuedAt:     run.QueuedAt,
+			StartedAt:    run.StartedAt,
+			FinishedAt:   run.FinishedAt,
+			TenantID:     run.TenantID,
+		}
+	}
+	masked := action == "grade" && identitiesMasked(assignment, course, now)
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+	run.StudentID = maskStudent(assignment, masked, run.StudentID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    run,
+	})
+}
+
+// RerunAutograder queues a new autograde run for a submission, for example
+// after the test suite was fixed
+func (s *LMSService) RerunAutograder(w http.ResponseWriter, r *http.Request) {
+	submission, err := s.getSubmission(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil || submission.Status == SubmissionStatusDraft {
+		log.Printf("Submission not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, submission.AssignmentID, "grade")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if assignment.Type != AssignmentTypeProgramming {
+		respondWithError(w, http.StatusConflict, "Assignment has no test suite")
+		return
+	}
+	if submission.AutogradeStatus == AutogradeQueued || submission.AutogradeStatus == AutogradeRunning {
+		respondWithError(w, http.StatusConflict, "Submission is already being autograded")
+		return
+	}
+
+	runID, err := s.enqueueAutograde(r.Context(), submission)
+	if err != nil {
+		log.Printf("Failed to queue autograde run: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to queue autograde run")
+		return
+	}
+
+	log.Printf("User %s queued autograde run %s for submission %s", userID, runID, submission.ID)
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"runId":  runID,
+			"status": AutogradeQueued,
+		},
+	})
+}
+
+// RerunAssignmentAutograder queues autograde runs for the counted submission
+// of every student. Submissions that are already queued or running are left
+// alone.
+func (s *LMSService) RerunAssignmentAutograder(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "grade")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if assignment.Type != AssignmentTypeProgramming {
+		respondWithError(w, http.StatusConflict, "Assignment has no test suite")
+		return
+	}
+
+	counted, err := s.listCountedSubmissions(r.Context(), course, []Assignment{*assignment}, "")
+	if err != nil {
+		log.Printf("Failed to get submissions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve submissions")
+		return
+	}
+
+	queued := 0
+	for _, byAssignment := range counted {
+		submission, ok := byAssignment[assignment.ID]
+		if !ok || submission.AutogradeStatus == AutogradeQueued || submission.AutogradeStatus == AutogradeRunning {
+			continue
+		}
+		if _, err := s.enqueueAutograde(r.Context(), &submission); err != nil {
+			log.Printf("Failed to queue autograde run: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to queue autograde runs")
+			return
+		}
+		queued++
+	}
+
+	log.Printf("User %s queued %d autograde runs for assignment %s", userID, queued, assignment.ID)
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success": true,
+		"meta": map[string]interface{}{
+			"total": queued,
+		},
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestScoreTests(t *testing.T) {
+	tests := []struct {
+		name  string
+		tests []TestResult
+		want  int
+	}{
+		{
+			name:  "all tests pass",
+			tests: []TestResult{{Passed: true, Points: 1}, {Passed: true, Points: 3}},
+			want:  100,
+		},
+		{
+			name:  "points weigh the tests",
+			tests: []TestResult{{Passed: true, Points: 1}, {Passed: false, Points: 3}},
+			want:  25,
+		},
+		{
+			name:  "partial scores are rounded",
+			tests: []TestResult{{Passed: true, Points: 1}, {Passed: true, Points: 1}, {Passed: false, Points: 1}},
+			want:  67,
+		},
+		{
+			name:  "all tests fail",
+			tests: []TestResult{{Passed: false, Points: 2}},
+			want:  0,
+		},
+		{
+			name: "no tests",
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scoreTests(tt.tests); got != tt.want {
+				t.Errorf("scoreTests = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
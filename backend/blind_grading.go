@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Under blind grading, graders see every student of an assignment as a
+// pseudonym until the assignment's grades are released. Pseudonyms are
+// derived from the assignment and student IDs with BLIND_GRADING_SECRET, so
+// they are stable for an assignment but differ between assignments.
+
+// pseudonymPrefix starts every pseudonym, so they are never taken for user IDs
+const pseudonymPrefix = "anon-"
+
+// pseudonym returns the name a student goes by on a blind graded assignment
+func pseudonym(assignmentID, studentID string) string {
+	mac := hmac.New(sha256.New, []byte(getEnv("BLIND_GRADING_SECRET", "")))
+	mac.Write([]byte(assignmentID + ":" + studentID))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// checkBlindGradingConfigured writes a configuration error and returns false
+// when BLIND_GRADING_SECRET is not set, since pseudonyms derived without a
+// secret can be computed by anyone who knows the assignment and student IDs
+func checkBlindGradingConfigured(w http.ResponseWriter) bool {
+	if getEnv("BLIND_GRADING_SECRET", "") != "" {
+		return true
+	}
+	log.Printf("Blind grading is not configured: BLIND_GRADING_SECRET is not set")
+	respondWithError(w, http.StatusInternalServerError, "Blind grading is not configured")
+	return false
+}
+
+// identitiesMasked reports whether graders see pseudonyms instead of
+// students on the assignment at the given time
+func identitiesMasked(assignment *Assignment, course *Course, now time.Time) bool {
+	return assignment.BlindGrading && !gradesReleased(assignment, course, now)
+}
+
+// maskStudent returns the pseudonym of the student when identities are
+// masked, and the student ID otherwise
+func maskStudent(assignment *Assignment, masked bool, studentID string) string {
+	if !masked || studentID == "" {
+		return studentID
+	}
+	return pseudonym(assignment.ID, studentID)
+}
+
+// resolvePseudonym returns the enrolled student behind a pseudonym of the
+// assignment
+func resolvePseudonym(assignment *Assignment, course *Course, name string) (string, error) {
+	if strings.HasPrefix(name, pseudonymPrefix) {
+		for _, studentID := range course.StudentIDs {
+			if pseudonym(assignment.ID, studentID) == name {
+				return studentID, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown student %q", name)
+}
+
+// UpdateBlindGrading turns blind grading of an assignment on or off. Blind
+// grading needs a manual or scheduled grade release, because identities are
+// revealed when grades are released.
+func (s *LMSService) UpdateBlindGrading(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if requestData.Enabled {
+		if !checkBlindGradingConfigured(w) {
+			return
+		}
+		if assignment.GradeRelease != GradeReleaseManual && assignment.GradeRelease != GradeReleaseScheduled {
+			respondWithError(w, http.StatusBadRequest, "Blind grading needs a manual or scheduled grade release")
+			return
+		}
+		if gradesReleased(assignment, course, time.Now()) {
+			respondWithError(w, http.StatusConflict, "Grades were already released")
+			return
+		}
+	}
+
+	data := map[string]interface{}{
+		"blindGrading": requestData.Enabled,
+	}
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignment.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update blind grading: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update blind grading")
+		return
+	}
+
+	log.Printf("User %s set blind grading of assignment %s to %t", userID, assignment.ID, requestData.Enabled)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// ListSubmissions returns the counted attempt of every student who submitted
+// the assignment. Under blind grading, students are shown as pseudonyms.
+func (s *LMSService) ListSubmissions(w http.ResponseWriter, r *http.Request) {
+	_, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "grade")
+	if !ok {
+		return
+	}
+
+	counted, err := s.listCountedSubmissions(r.Context(), course, []Assignment{*assignment}, "")
+	if err != nil {
+		log.Printf("Failed to get submissions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve submissions")
+		return
+	}
+
+	masked := identitiesMasked(assignment, course, time.Now())
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+
+	var submissions []Submission
+	for _, byAssignment := range counted {
+		submission, ok := byAssignment[assignment.ID]
+		if !ok {
+			continue
+		}
+		submission.StudentID = maskStudent(assignment, masked, submission.StudentID)
+		submissions = append(submissions, submission)
+	}
+
+	// Order by submission time, which reveals nothing about the students
+	sort.Slice(submissions, func(i, j int) bool {
+		return submissions[i].SubmittedAt < submissions[j].SubmittedAt
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    submissions,
+		"meta": map[string]interface{}{
+			"total":        len(submissions),
+			"blindGrading": masked,
+		},
+	})
+}
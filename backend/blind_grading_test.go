@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdentitiesMasked(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		assignment Assignment
+		want       bool
+	}{
+		{
+			name:       "blind grading off",
+			assignment: Assignment{GradeRelease: GradeReleaseManual},
+			want:       false,
+		},
+		{
+			name:       "grades not released yet",
+			assignment: Assignment{BlindGrading: true, GradeRelease: GradeReleaseManual},
+			want:       true,
+		},
+		{
+			name:       "grades released by hand",
+			assignment: Assignment{BlindGrading: true, GradeRelease: GradeReleaseManual, GradesReleasedAt: "2026-05-09T10:00:00Z"},
+			want:       false,
+		},
+		{
+			name:       "scheduled release still ahead",
+			assignment: Assignment{BlindGrading: true, GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "2026-05-11T00:00:00Z"},
+			want:       true,
+		},
+		{
+			name:       "scheduled release passed",
+			assignment: Assignment{BlindGrading: true, GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "2026-05-10T00:00:00Z"},
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := identitiesMasked(&tt.assignment, &Course{}, now); got != tt.want {
+				t.Errorf("identitiesMasked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPseudonym(t *testing.T) {
+	t.Setenv("BLIND_GRADING_SECRET", "secret")
+
+	name := pseudonym("assignment-1", "student-1")
+	if !strings.HasPrefix(name, pseudonymPrefix) {
+		t.Errorf("pseudonym %q does not start with %q", name, pseudonymPrefix)
+	}
+	if strings.Contains(name, "student-1") {
+		t.Errorf("pseudonym %q reveals the student ID", name)
+	}
+	if again := pseudonym("assignment-1", "student-1"); again != name {
+		t.Errorf("pseudonym changed from %q to %q", name, again)
+	}
+	if other := pseudonym("assignment-2", "student-1"); other == name {
+		t.Errorf("pseudonym %q is the same on another assignment", name)
+	}
+	if other := pseudonym("assignment-1", "student-2"); other == name {
+		t.Errorf("pseudonym %q is shared by another student", name)
+	}
+
+	t.Setenv("BLIND_GRADING_SECRET", "another secret")
+	if other := pseudonym("assignment-1", "student-1"); other == name {
+		t.Errorf("pseudonym %q does not depend on the secret", name)
+	}
+}
+
+func TestMaskStudent(t *testing.T) {
+	t.Setenv("BLIND_GRADING_SECRET", "secret")
+	assignment := &Assignment{ID: "assignment-1"}
+
+	if got := maskStudent(assignment, false, "student-1"); got != "student-1" {
+		t.Errorf("unmasked student = %q, want student-1", got)
+	}
+	if got, want := maskStudent(assignment, true, "student-1"), pseudonym("assignment-1", "student-1"); got != want {
+		t.Errorf("masked student = %q, want %q", got, want)
+	}
+	if got := maskStudent(assignment, true, ""); got != "" {
+		t.Errorf("masked empty student = %q, want empty", got)
+	}
+}
+
+func TestResolvePseudonym(t *testing.T) {
+	t.Setenv("BLIND_GRADING_SECRET", "secret")
+	assignment := &Assignment{ID: "assignment-1"}
+	course := &Course{StudentIDs: []string{"student-1", "student-2"}}
+
+	got, err := resolvePseudonym(assignment, course, pseudonym("assignment-1", "student-2"))
+	if err != nil || got != "student-2" {
+		t.Errorf("resolvePseudonym = %q, %v, want student-2", got, err)
+	}
+
+	for _, name := range []string{
+		"student-1",                            // Plain student IDs are not accepted
+		pseudonym("assignment-2", "student-1"), // Pseudonym of another assignment
+		pseudonym("assignment-1", "student-3"), // Student outside the course
+		pseudonymPrefix + "000000000000",
+	} {
+		if got, err := resolvePseudonym(assignment, course, name); err == nil {
+			t.Errorf("resolvePseudonym(%q) = %q, want error", name, got)
+		}
+	}
+}
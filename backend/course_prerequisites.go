@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// A course can require students to have completed other courses before they
+// enroll. A prerequisite course counts as completed once it is archived with
+// the student on its roster, and, when the prerequisite sets a minimum grade,
+// with a final gradebook total of at least that grade. Teachers and section
+// instructors with the override_prerequisites permission can exempt
+// individual students.
+
+// unmetCoursePrerequisite returns why the student cannot enroll in the course
+// yet, or an empty string when all prerequisite courses are met
+func (s *LMSService) unmetCoursePrerequisite(ctx context.Context, course *Course, studentID string) (string, error) {
+	if contains(course.PrerequisiteOverrides, studentID) {
+		return "", nil
+	}
+
+	for i, id := range course.PrerequisiteCourseIDs {
+		required, err := s.getCourse(id, course.TenantID)
+		if err != nil {
+			log.Printf("Warning: prerequisite course %s of course %s not found: %v", id, course.ID, err)
+			return fmt.Sprintf("Prerequisite course %s is not available", id), nil
+		}
+
+		if !contains(required.StudentIDs, studentID) || required.Status != CourseStatusArchived {
+			return fmt.Sprintf("Enrollment requires completing %s", required.Title), nil
+		}
+
+		minGrade := 0.0
+		if i < len(course.PrerequisiteMinGrades) {
+			minGrade = course.PrerequisiteMinGrades[i]
+		}
+		if minGrade <= 0 {
+			continue
+		}
+
+		gradebook, err := s.buildGradebook(ctx, required, []string{studentID}, true)
+		if err != nil {
+			return "", err
+		}
+		total := gradebook.Students[0].Total
+		if total == nil || *total < minGrade {
+			return fmt.Sprintf("Enrollment requires a final grade of at least %g in %s", minGrade, required.Title), nil
+		}
+	}
+	return "", nil
+}
+
+// coursePrerequisiteCycle reports whether requiring the given courses for the
+// course would make it, directly or through their own prerequisites, require
+// itself
+func (s *LMSService) coursePrerequisiteCycle(course *Course, requiredIDs []string) bool {
+	return prerequisiteCycle(course.ID, requiredIDs, func(id string) []string {
+		required, err := s.getCourse(id, course.TenantID)
+		if err != nil {
+			return nil
+		}
+		return required.PrerequisiteCourseIDs
+	})
+}
+
+// prerequisiteCycle reports whether the course is among the required courses
+// or their prerequisites, which prerequisitesOf looks up
+func prerequisiteCycle(courseID string, requiredIDs []string, prerequisitesOf func(id string) []string) bool {
+	visited := make(map[string]bool)
+	pending := append([]string{}, requiredIDs...)
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == courseID {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		pending = append(pending, prerequisitesOf(id)...)
+	}
+	return false
+}
+
+// UpdateCoursePrerequisites replaces the prerequisite courses of a course
+func (s *LMSService) UpdateCoursePrerequisites(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Prerequisites []struct {
+			CourseID string  `json:"courseId"`
+			MinGrade float64 `json:"minGrade"` // 0 means no minimum
+		} `json:"prerequisites"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	courseIDs := []string{}
+	minGrades := []float64{}
+	for _, prerequisite := range requestData.Prerequisites {
+		if _, err := s.getCourse(prerequisite.CourseID, course.TenantID); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Course %s not found", prerequisite.CourseID))
+			return
+		}
+		if contains(courseIDs, prerequisite.CourseID) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Course %s is listed more than once", prerequisite.CourseID))
+			return
+		}
+		if prerequisite.MinGrade < 0 || prerequisite.MinGrade > 100 {
+			respondWithError(w, http.StatusBadRequest, "Minimum grade must be between 0 and 100")
+			return
+		}
+		courseIDs = append(courseIDs, prerequisite.CourseID)
+		minGrades = append(minGrades, prerequisite.MinGrade)
+	}
+
+	if s.coursePrerequisiteCycle(course, courseIDs) {
+		respondWithError(w, http.StatusBadRequest, "A course cannot require itself, directly or through other courses")
+		return
+	}
+
+	data := map[string]interface{}{
+		"prerequisiteCourseIds": courseIDs,
+		"prerequisiteMinGrades": minGrades,
+	}
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		getEnv("APPWRITE_COLLECTION_ID", "courses"),
+		course.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update course prerequisites: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update course prerequisites")
+		return
+	}
+
+	log.Printf("User %s set %d prerequisite courses for course %s", userID, len(courseIDs), course.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// updatePrerequisiteOverrides stores the students exempted from the
+// prerequisite courses of a course
+func (s *LMSService) updatePrerequisiteOverrides(w http.ResponseWriter, course *Course, overrides []string) bool {
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		getEnv("APPWRITE_COLLECTION_ID", "courses"),
+		course.ID,
+		map[string]interface{}{
+			"prerequisiteOverrides": overrides,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update prerequisite overrides: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update prerequisite overrides")
+		return false
+	}
+	return true
+}
+
+// OverrideCoursePrerequisites exempts a student from the prerequisite courses
+// of a course
+func (s *LMSService) OverrideCoursePrerequisites(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "override_prerequisites")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		StudentID string `json:"studentId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.StudentID == "" {
+		respondWithError(w, http.StatusBadRequest, "Student ID is required")
+		return
+	}
+
+	overrides := course.PrerequisiteOverrides
+	if !contains(overrides, requestData.StudentID) {
+		overrides = append(overrides, requestData.StudentID)
+		if !s.updatePrerequisiteOverrides(w, course, overrides) {
+			return
+		}
+	}
+
+	log.Printf("User %s exempted student %s from the prerequisites of course %s", userID, requestData.StudentID, course.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    overrides,
+	})
+}
+
+// RevokeCoursePrerequisiteOverride removes a student's exemption from the
+// prerequisite courses of a course. Students who already enrolled stay
+// enrolled.
+func (s *LMSService) RevokeCoursePrerequisiteOverride(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, course, ok := s.loadCourse(w, r, vars["id"], "override_prerequisites")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	overrides := []string{}
+	for _, id := range course.PrerequisiteOverrides {
+		if id != vars["studentId"] {
+			overrides = append(overrides, id)
+		}
+	}
+	if len(overrides) == len(course.PrerequisiteOverrides) {
+		respondWithError(w, http.StatusNotFound, "Student has no prerequisite override")
+		return
+	}
+	if !s.updatePrerequisiteOverrides(w, course, overrides) {
+		return
+	}
+
+	log.Printf("User %s revoked the prerequisite override of student %s in course %s", userID, vars["studentId"], course.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    overrides,
+	})
+}
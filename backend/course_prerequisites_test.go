@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestPrerequisiteCycle(t *testing.T) {
+	// intro <- data <- ml, and stats <- ml
+	prerequisites := map[string][]string{
+		"data":  {"intro"},
+		"ml":    {"data", "stats"},
+		"stats": {},
+	}
+	prerequisitesOf := func(id string) []string {
+		return prerequisites[id]
+	}
+
+	tests := []struct {
+		name        string
+		courseID    string
+		requiredIDs []string
+		want        bool
+	}{
+		{
+			name:        "no prerequisites",
+			courseID:    "intro",
+			requiredIDs: nil,
+			want:        false,
+		},
+		{
+			name:        "unrelated courses",
+			courseID:    "ml",
+			requiredIDs: []string{"data", "stats"},
+			want:        false,
+		},
+		{
+			name:        "course requires itself",
+			courseID:    "intro",
+			requiredIDs: []string{"intro"},
+			want:        true,
+		},
+		{
+			name:        "course required by its prerequisite",
+			courseID:    "intro",
+			requiredIDs: []string{"data"},
+			want:        true,
+		},
+		{
+			name:        "course required further down",
+			courseID:    "intro",
+			requiredIDs: []string{"stats", "ml"},
+			want:        true,
+		},
+		{
+			name:        "unknown course",
+			courseID:    "intro",
+			requiredIDs: []string{"deleted"},
+			want:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prerequisiteCycle(tt.courseID, tt.requiredIDs, prerequisitesOf); got != tt.want {
+				t.Errorf("prerequisiteCycle(%q, %v) = %v, want %v", tt.courseID, tt.requiredIDs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrerequisiteCycleStopsOnExistingCycles(t *testing.T) {
+	// a and b already require each other
+	prerequisites := map[string][]string{
+		"a": {"b"},
+		"b": {"a"},
+	}
+	if prerequisiteCycle("c", []string{"a"}, func(id string) []string { return prerequisites[id] }) {
+		t.Error("prerequisiteCycle = true, want false")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+)
+
+// Deadlines are stored as RFC3339 instants. Older documents hold plain
+// YYYY-MM-DD dates, which mean the end of that day in the course's timezone
+// rather than midnight UTC.
+
+// courseLocation returns the timezone of the course, defaulting to UTC
+func courseLocation(course *Course) (*time.Location, error) {
+	if course.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(course.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid course timezone %q: %w", course.Timezone, err)
+	}
+	return loc, nil
+}
+
+// parseDeadline parses an RFC3339 instant, or a YYYY-MM-DD date as the last
+// second of that day in loc
+func parseDeadline(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q: expected RFC3339 timestamp or YYYY-MM-DD date", value)
+	}
+	// Adding 24 hours to midnight would be off by an hour on DST changes
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 23, 59, 59, 0, loc), nil
+}
+
+// parseStartDate parses an RFC3339 instant, or a YYYY-MM-DD date as the start
+// of that day in loc
+func parseStartDate(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected RFC3339 timestamp or YYYY-MM-DD date", value)
+	}
+	return date, nil
+}
+
+// normalizeDeadline validates a deadline from a request and returns it as an
+// RFC3339 instant in UTC
+func normalizeDeadline(value string, loc *time.Location) (string, error) {
+	t, err := parseDeadline(value, loc)
+	if err != nil {
+		return "", err
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// studentDueDate returns the due date of the assignment for the student
+func (s *LMSService) studentDueDate(ctx context.Context, assignment *Assignment, course *Course, studentID string) (time.Time, error) {
+	loc, err := courseLocation(course)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		extensionsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", studentID),
+		},
+	)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to list extensions: %w", err)
+	}
+	var extensions []Extension
+	if err := json.Unmarshal([]byte(documents.(string)), &extensions); err != nil {
+		return time.Time{}, fmt.Errorf("failed to unmarshal extensions: %w", err)
+	}
+	extensionDueDate := ""
+	if len(extensions) > 0 {
+		extensionDueDate = extensions[0].NewDueDate
+	}
+
+	sectionDueDate := ""
+	if extensionDueDate == "" {
+		sectionDueDate, err = s.sectionDueDate(ctx, assignment, course, studentID)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return effectiveDueDate(assignment.DueDate, sectionDueDate, extensionDueDate, loc)
+}
+
+// sectionDueDate returns the due date of the assignment for the student's
+// section, or an empty string if the section keeps the assignment's own
+func (s *LMSService) sectionDueDate(ctx context.Context, assignment *Assignment, course *Course, studentID string) (string, error) {
+	sections, err := s.listCourseSections(ctx, course.ID, course.TenantID)
+	if err != nil {
+		return "", err
+	}
+	for _, section := range sections {
+		if !contains(section.StudentIDs, studentID) {
+			continue
+		}
+		documents, err := s.db.ListDocuments(
+			ctx,
+			s.databaseID,
+			sectionDueDatesCollectionID(),
+			[]interface{}{
+				query.Equal("sectionId", section.ID),
+				query.Equal("assignmentId", assignment.ID),
+			},
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to list due date overrides: %w", err)
+		}
+		var overrides []SectionDueDate
+		if err := json.Unmarshal([]byte(documents.(string)), &overrides); err != nil {
+			return "", fmt.Errorf("failed to unmarshal due date overrides: %w", err)
+		}
+		if len(overrides) > 0 {
+			return overrides[0].DueDate, nil
+		}
+		break
+	}
+	return "", nil
+}
+
+// effectiveDueDate parses the due date that applies to a student: an
+// extension wins over the due date of the student's section, which wins over
+// the assignment's own. Empty dates are skipped.
+func effectiveDueDate(assignmentDueDate, sectionDueDate, extensionDueDate string, loc *time.Location) (time.Time, error) {
+	for _, dueDate := range []string{extensionDueDate, sectionDueDate} {
+		if dueDate != "" {
+			return parseDeadline(dueDate, loc)
+		}
+	}
+	return parseDeadline(assignmentDueDate, loc)
+}
+
+// submissionDeadline returns the last moment the assignment's late policy
+// accepts submissions due at dueDate
+func submissionDeadline(assignment *Assignment, dueDate time.Time, loc *time.Location) (time.Time, error) {
+	switch assignment.LatePolicy {
+	case "grace":
+		return dueDate.Add(time.Duration(assignment.GraceMinutes) * time.Minute), nil
+	case "penalty", "accept_until":
+		if assignment.AcceptUntil == "" {
+			if assignment.LatePolicy == "penalty" {
+				// Late work is accepted indefinitely
+				return time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), nil
+			}
+			return dueDate, nil
+		}
+		return parseDeadline(assignment.AcceptUntil, loc)
+	default:
+		// Hard close at the due date
+		return dueDate, nil
+	}
+}
+
+// studentSubmissionDeadline returns the last moment the student may submit
+// the assignment, as submit_assignment computes it
+func (s *LMSService) studentSubmissionDeadline(ctx context.Context, assignment *Assignment, course *Course, studentID string) (time.Time, error) {
+	dueDate, err := s.studentDueDate(ctx, assignment, course, studentID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := courseLocation(course)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return submissionDeadline(assignment, dueDate, loc)
+}
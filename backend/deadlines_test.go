@@ -0,0 +1,199 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDeadline(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		loc     *time.Location
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "RFC3339 instant",
+			value: "2026-11-02T23:59:00-05:00",
+			loc:   newYork,
+			want:  "2026-11-03T04:59:00Z",
+		},
+		{
+			name:  "date in UTC",
+			value: "2026-05-10",
+			loc:   time.UTC,
+			want:  "2026-05-10T23:59:59Z",
+		},
+		{
+			name:  "date in course timezone",
+			value: "2026-05-10",
+			loc:   newYork,
+			want:  "2026-05-11T03:59:59Z",
+		},
+		{
+			name:  "date when DST starts",
+			value: "2026-03-08",
+			loc:   newYork,
+			want:  "2026-03-09T03:59:59Z",
+		},
+		{
+			name:  "date when DST ends",
+			value: "2026-11-01",
+			loc:   newYork,
+			want:  "2026-11-02T04:59:59Z",
+		},
+		{
+			name:    "invalid value",
+			value:   "next friday",
+			loc:     time.UTC,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDeadline(tt.value, tt.loc)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDeadline(%q) = %v, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDeadline(%q) returned error: %v", tt.value, err)
+			}
+			if got := got.UTC().Format(time.RFC3339); got != tt.want {
+				t.Errorf("parseDeadline(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubmissionDeadline(t *testing.T) {
+	dueDate := time.Date(2026, 5, 10, 23, 59, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		assignment Assignment
+		want       time.Time
+	}{
+		{
+			name:       "hard close by default",
+			assignment: Assignment{},
+			want:       dueDate,
+		},
+		{
+			name:       "hard close ignores accept until",
+			assignment: Assignment{LatePolicy: "hard_close", AcceptUntil: "2026-05-20"},
+			want:       dueDate,
+		},
+		{
+			name:       "grace window",
+			assignment: Assignment{LatePolicy: "grace", GraceMinutes: 30},
+			want:       dueDate.Add(30 * time.Minute),
+		},
+		{
+			name:       "penalty until accept until",
+			assignment: Assignment{LatePolicy: "penalty", AcceptUntil: "2026-05-17T12:00:00Z"},
+			want:       time.Date(2026, 5, 17, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "penalty without accept until",
+			assignment: Assignment{LatePolicy: "penalty"},
+			want:       time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:       "accept until date",
+			assignment: Assignment{LatePolicy: "accept_until", AcceptUntil: "2026-05-12"},
+			want:       time.Date(2026, 5, 12, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:       "accept until without date",
+			assignment: Assignment{LatePolicy: "accept_until"},
+			want:       dueDate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := submissionDeadline(&tt.assignment, dueDate, time.UTC)
+			if err != nil {
+				t.Fatalf("submissionDeadline returned error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("submissionDeadline = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveDueDate(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name              string
+		assignmentDueDate string
+		sectionDueDate    string
+		extensionDueDate  string
+		want              string
+		wantErr           bool
+	}{
+		{
+			name:              "assignment due date",
+			assignmentDueDate: "2026-05-10T12:00:00Z",
+			want:              "2026-05-10T12:00:00Z",
+		},
+		{
+			name:              "section due date wins over the assignment's",
+			assignmentDueDate: "2026-05-10T12:00:00Z",
+			sectionDueDate:    "2026-05-12T12:00:00Z",
+			want:              "2026-05-12T12:00:00Z",
+		},
+		{
+			name:              "extension wins over the section's due date",
+			assignmentDueDate: "2026-05-10T12:00:00Z",
+			sectionDueDate:    "2026-05-12T12:00:00Z",
+			extensionDueDate:  "2026-05-11T12:00:00Z",
+			want:              "2026-05-11T12:00:00Z",
+		},
+		{
+			name:              "extension as a plain date in the course timezone",
+			assignmentDueDate: "2026-05-10T12:00:00Z",
+			extensionDueDate:  "2026-05-14",
+			want:              "2026-05-14T21:59:59Z",
+		},
+		{
+			name:              "invalid extension due date",
+			assignmentDueDate: "2026-05-10T12:00:00Z",
+			extensionDueDate:  "friday",
+			wantErr:           true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := effectiveDueDate(tt.assignmentDueDate, tt.sectionDueDate, tt.extensionDueDate, berlin)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("effectiveDueDate = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("effectiveDueDate returned error: %v", err)
+			}
+			if got := got.UTC().Format(time.RFC3339); got != tt.want {
+				t.Errorf("effectiveDueDate = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// Submission states. A student has at most one draft per assignment; it is
+// only visible to the student and becomes an attempt when submitted.
+const (
+	SubmissionStatusDraft     = "draft"
+	SubmissionStatusSubmitted = "submitted"
+)
+
+// findDraft returns the student's draft for the assignment, or nil if none is
+// saved
+func (s *LMSService) findDraft(ctx context.Context, assignment *Assignment, studentID string) (*Submission, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		submissionsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", assignment.TenantID),
+			query.Equal("status", SubmissionStatusDraft),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list drafts: %w", err)
+	}
+
+	var drafts []Submission
+	if err := json.Unmarshal([]byte(documents.(string)), &drafts); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal drafts: %w", err)
+	}
+	if len(drafts) == 0 {
+		return nil, nil
+	}
+	return &drafts[0], nil
+}
+
+// GetDraft returns the current student's draft for an assignment
+func (s *LMSService) GetDraft(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, _, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	draft, err := s.findDraft(r.Context(), assignment, userID)
+	if err != nil {
+		log.Printf("Failed to get draft: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve draft")
+		return
+	}
+	if draft == nil {
+		respondWithError(w, http.StatusNotFound, "No draft saved")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    draft,
+	})
+}
+
+// SaveDraft creates or overwrites the current student's draft for an
+// assignment. Clients call it repeatedly to autosave.
+func (s *LMSService) SaveDraft(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	if !contains(course.StudentIDs, userID) {
+		respondWithError(w, http.StatusForbidden, "Only enrolled students can save drafts")
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Content       string   `json:"content"`
+		AttachmentIDs []string `json:"attachmentIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	for _, attachmentID := range requestData.AttachmentIDs {
+		attachment, err := s.getAttachment(attachmentID, assignment.TenantID)
+		if err != nil || attachment.AssignmentID != assignment.ID || attachment.StudentID != userID {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid attachment %s", attachmentID))
+			return
+		}
+	}
+
+	draft, err := s.findDraft(r.Context(), assignment, userID)
+	if err != nil {
+		log.Printf("Failed to get draft: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve draft")
+		return
+	}
+
+	// Quiz answers are saved while the quiz is in progress
+	if assignment.Type == AssignmentTypeQuiz {
+		if draft == nil || draft.StartedAt == "" {
+			respondWithError(w, http.StatusConflict, "Quiz was not started")
+			return
+		}
+		if endsAt, ok := quizEndsAt(assignment, draft); ok && time.Now().After(endsAt.Add(quizTimeLimitGrace)) {
+			respondWithError(w, http.StatusConflict, "Time limit of the quiz has passed")
+			return
+		}
+	}
+
+	data := map[string]interface{}{
+		"content":       requestData.Content,
+		"attachmentIds": requestData.AttachmentIDs,
+		"savedAt":       time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if draft != nil {
+		_, err = s.db.UpdateDocument(
+			s.databaseID,
+			submissionsCollectionID(),
+			draft.ID,
+			data,
+			nil, // permissions
+		)
+	} else {
+		data["assignmentId"] = assignment.ID
+		data["studentId"] = userID
+		data["tenantId"] = assignment.TenantID
+		data["status"] = SubmissionStatusDraft
+		_, err = s.db.CreateDocument(
+			r.Context(),
+			s.databaseID,
+			submissionsCollectionID(),
+			"unique()",
+			data,
+		)
+	}
+	if err != nil {
+		log.Printf("Failed to save draft: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save draft")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
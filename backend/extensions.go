@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// Extension gives one student a later due date for one assignment
+type Extension struct {
+	ID           string `json:"$id"`
+	AssignmentID string `json:"assignmentId"`
+	StudentID    string `json:"studentId"`
+	NewDueDate   string `json:"newDueDate"` // RFC3339, UTC
+	Reason       string `json:"reason"`
+	GrantedBy    string `json:"grantedBy"`
+	TenantID     string `json:"tenantId"`
+}
+
+func extensionsCollectionID() string {
+	return getEnv("APPWRITE_EXTENSIONS_COLLECTION_ID", "extensions")
+}
+
+// ListExtensions returns the extensions granted for an assignment
+func (s *LMSService) ListExtensions(w http.ResponseWriter, r *http.Request) {
+	_, assignment, _, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "extend")
+	if !ok {
+		return
+	}
+
+	documents, err := s.db.ListDocuments(
+		r.Context(),
+		s.databaseID,
+		extensionsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to get extensions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve extensions")
+		return
+	}
+
+	var extensions []Extension
+	if err := json.Unmarshal([]byte(documents.(string)), &extensions); err != nil {
+		log.Printf("Failed to unmarshal extensions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process extensions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    extensions,
+		"meta": map[string]interface{}{
+			"total": len(extensions),
+		},
+	})
+}
+
+// GrantExtension gives a student a new due date for an assignment. A later
+// grant for the same student replaces the earlier one.
+func (s *LMSService) GrantExtension(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "extend")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		StudentID  string `json:"studentId"`
+		NewDueDate string `json:"newDueDate"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if !contains(course.StudentIDs, requestData.StudentID) {
+		respondWithError(w, http.StatusBadRequest, "Student is not enrolled in the course")
+		return
+	}
+
+	if requestData.Reason == "" {
+		respondWithError(w, http.StatusBadRequest, "Reason is required")
+		return
+	}
+
+	// Plain dates end at 23:59:59 in the course's timezone
+	loc, err := courseLocation(course)
+	if err != nil {
+		log.Printf("Failed to load course timezone: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process course timezone")
+		return
+	}
+	newDueDate, err := normalizeDeadline(requestData.NewDueDate, loc)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	documents, err := s.db.ListDocuments(
+		r.Context(),
+		s.databaseID,
+		extensionsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", requestData.StudentID),
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to get extensions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve extensions")
+		return
+	}
+	var existing []Extension
+	if err := json.Unmarshal([]byte(documents.(string)), &existing); err != nil {
+		log.Printf("Failed to unmarshal extensions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process extensions")
+		return
+	}
+
+	data := map[string]interface{}{
+		"assignmentId": assignment.ID,
+		"studentId":    requestData.StudentID,
+		"newDueDate":   newDueDate,
+		"reason":       requestData.Reason,
+		"grantedBy":    userID,
+		"tenantId":     assignment.TenantID,
+	}
+
+	if len(existing) > 0 {
+		_, err = s.db.UpdateDocument(
+			s.databaseID,
+			extensionsCollectionID(),
+			existing[0].ID,
+			data,
+			nil, // permissions
+		)
+	} else {
+		_, err = s.db.CreateDocument(
+			r.Context(),
+			s.databaseID,
+			extensionsCollectionID(),
+			"unique()",
+			data,
+		)
+	}
+	if err != nil {
+		log.Printf("Failed to save extension: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save extension")
+		return
+	}
+
+	log.Printf("User %s extended assignment %s for student %s until %s: %s",
+		userID, assignment.ID, requestData.StudentID, newDueDate, requestData.Reason)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/appwrite/sdk-for-go"
 	"github.com/appwrite/sdk-for-go/database"
@@ -14,11 +15,17 @@ import (
 
 // Course represents a course in the LMS
 type Course struct {
-	ID          string   `json:"id"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	TeacherID   string   `json:"teacherId"`
-	StudentIDs  []string `json:"studentIds"`
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	TeacherID       string   `json:"teacherId"`
+	StudentIDs      []string `json:"studentIds"`
+	TenantID        string   `json:"tenantId"`
+	TermID          string   `json:"termId"`
+	Status          string   `json:"status"`
+	EnrollmentStart string   `json:"enrollmentStart"`
+	EnrollmentEnd   string   `json:"enrollmentEnd"`
+	Timezone        string   `json:"timezone"`
 }
 
 // Response is the standard response format for Appwrite functions
@@ -49,22 +56,45 @@ func main() {
 
 	// Parse request
 	var req struct {
-		UserID      string `json:"userId"`
-		UserRole    string `json:"userRole"`
-		Title       string `json:"title"`
-		Description string `json:"description"`
+		UserID          string `json:"userId"`
+		UserRole        string `json:"userRole"`
+		Title           string `json:"title"`
+		Description     string `json:"description"`
+		TenantID        string `json:"tenantId"`
+		TermID          string `json:"termId"`
+		EnrollmentStart string `json:"enrollmentStart"` // RFC3339 or YYYY-MM-DD, inclusive
+		EnrollmentEnd   string `json:"enrollmentEnd"`   // RFC3339 or YYYY-MM-DD, inclusive
+		Timezone        string `json:"timezone"`
 	}
 	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
 		respondWithError("Failed to parse request", err)
 		return
 	}
 
+	// Requests without an organization act in the default tenant
+	if req.TenantID == "" {
+		req.TenantID = os.Getenv("DEFAULT_TENANT")
+	}
+	if req.TenantID == "" {
+		req.TenantID = "default"
+	}
+
+	// Deadlines without a time of day end at 23:59:59 in this timezone
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		respondWithError("Invalid timezone", err)
+		return
+	}
+
 	// Check if user can create a course using Permit
 	allowed, err := permitClient.Check(
 		context.Background(),
 		req.UserID,  // User ID
 		"create",    // Action
 		"course",    // Resource
+		permit.WithTenant(req.TenantID),
 	)
 	if err != nil {
 		respondWithError("Failed to check permissions", err)
@@ -78,10 +108,16 @@ func main() {
 
 	// Create course
 	course := Course{
-		Title:       req.Title,
-		Description: req.Description,
-		TeacherID:   req.UserID,
-		StudentIDs:  []string{},
+		Title:           req.Title,
+		Description:     req.Description,
+		TeacherID:       req.UserID,
+		StudentIDs:      []string{},
+		TenantID:        req.TenantID,
+		TermID:          req.TermID,
+		Status:          "draft", // Not enrollable until published
+		EnrollmentStart: req.EnrollmentStart,
+		EnrollmentEnd:   req.EnrollmentEnd,
+		Timezone:        req.Timezone,
 	}
 
 	// Initialize database client
@@ -93,10 +129,16 @@ func main() {
 		"courses",
 		"unique()",
 		map[string]interface{}{
-			"title":       course.Title,
-			"description": course.Description,
-			"teacherId":   course.TeacherID,
-			"studentIds":  course.StudentIDs,
+			"title":           course.Title,
+			"description":     course.Description,
+			"teacherId":       course.TeacherID,
+			"studentIds":      course.StudentIDs,
+			"tenantId":        course.TenantID,
+			"termId":          course.TermID,
+			"status":          course.Status,
+			"enrollmentStart": course.EnrollmentStart,
+			"enrollmentEnd":   course.EnrollmentEnd,
+			"timezone":        course.Timezone,
 		},
 	)
 	if err != nil {
@@ -115,7 +157,9 @@ func main() {
 	_, err = permitClient.SyncResource(context.Background(), "course", createdCourse.ID, map[string]interface{}{
 		"teacherId":  createdCourse.TeacherID,
 		"studentIds": createdCourse.StudentIDs,
-	})
+		"status":     createdCourse.Status,
+		"termId":     createdCourse.TermID,
+	}, permit.WithTenant(createdCourse.TenantID))
 	if err != nil {
 		log.Printf("Failed to sync course %s: %v", createdCourse.ID, err)
 	}
@@ -5,20 +5,58 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/appwrite/sdk-for-go"
 	"github.com/appwrite/sdk-for-go/database"
+	"github.com/appwrite/sdk-for-go/query"
 	"github.com/permitio/permit-golang/pkg/permit"
 )
 
 // Course represents a course in the LMS
 type Course struct {
-	ID          string   `json:"id"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	TeacherID   string   `json:"teacherId"`
-	StudentIDs  []string `json:"studentIds"`
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	TeacherID       string   `json:"teacherId"`
+	StudentIDs      []string `json:"studentIds"`
+	TenantID        string   `json:"tenantId"`
+	TermID          string   `json:"termId"`
+	Status          string   `json:"status"`
+	EnrollmentStart string   `json:"enrollmentStart"`
+	EnrollmentEnd   string   `json:"enrollmentEnd"`
+	Timezone        string   `json:"timezone"`
+	// Prerequisite courses with minimum final grades, 0 meaning none, and
+	// the students exempted from them
+	PrerequisiteCourseIDs []string  `json:"prerequisiteCourseIds"`
+	PrerequisiteMinGrades []float64 `json:"prerequisiteMinGrades"`
+	PrerequisiteOverrides []string  `json:"prerequisiteOverrides"`
+}
+
+// Assignment is the part of an assignment needed to compute final grades
+type Assignment struct {
+	ID               string `json:"id"`
+	GradeRelease     string `json:"gradeRelease"`     // immediate, manual or scheduled
+	GradeReleaseDate string `json:"gradeReleaseDate"` // RFC3339
+	GradesReleasedAt string `json:"gradesReleasedAt"`
+}
+
+// Submission is the part of a submission needed to compute final grades
+type Submission struct {
+	AssignmentID string `json:"assignmentId"`
+	Grade        int    `json:"grade"`
+	Status       string `json:"status"`
+	GradedAt     string `json:"gradedAt"`
+}
+
+// GradeCategory groups assignments of a course with a weight
+type GradeCategory struct {
+	Weight        float64  `json:"weight"`
+	DropLowest    int      `json:"dropLowest"`
+	AssignmentIDs []string `json:"assignmentIds"`
 }
 
 // Response is the standard response format for Appwrite functions
@@ -52,12 +90,21 @@ func main() {
 		UserID    string `json:"userId"`
 		UserRole  string `json:"userRole"`
 		CourseID  string `json:"courseId"`
+		TenantID  string `json:"tenantId"`
 	}
 	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
 		respondWithError("Failed to parse request", err)
 		return
 	}
 
+	// Requests without an organization act in the default tenant
+	if req.TenantID == "" {
+		req.TenantID = os.Getenv("DEFAULT_TENANT")
+	}
+	if req.TenantID == "" {
+		req.TenantID = "default"
+	}
+
 	// Only students can enroll in courses
 	if req.UserRole != "student" {
 		respondWithError("Only students can enroll in courses", fmt.Errorf("user role is %s", req.UserRole))
@@ -70,6 +117,7 @@ func main() {
 		req.UserID,                // User ID
 		"enroll",                  // Action
 		"course:"+req.CourseID,    // Resource
+		permit.WithTenant(req.TenantID),
 	)
 	if err != nil {
 		respondWithError("Failed to check permissions", err)
@@ -102,6 +150,52 @@ func main() {
 		return
 	}
 
+	// Courses of other organizations are invisible to the user
+	if course.TenantID != req.TenantID {
+		respondWithError("Failed to get course", fmt.Errorf("course %s not found", req.CourseID))
+		return
+	}
+
+	// Only published courses accept students
+	if course.Status != "published" {
+		respondWithError("Enrollment closed", fmt.Errorf("course is not open for enrollment"))
+		return
+	}
+
+	// Check the enrollment window, both dates inclusive in the course's timezone
+	loc := time.UTC
+	if course.Timezone != "" {
+		loc, err = time.LoadLocation(course.Timezone)
+		if err != nil {
+			respondWithError("Failed to load course timezone", err)
+			return
+		}
+	}
+
+	now := time.Now()
+	if course.EnrollmentStart != "" {
+		start, err := parseStartDate(course.EnrollmentStart, loc)
+		if err != nil {
+			respondWithError("Failed to parse enrollment start date", err)
+			return
+		}
+		if now.Before(start) {
+			respondWithError("Enrollment closed", fmt.Errorf("enrollment opens on %s", course.EnrollmentStart))
+			return
+		}
+	}
+	if course.EnrollmentEnd != "" {
+		end, err := parseDeadline(course.EnrollmentEnd, loc)
+		if err != nil {
+			respondWithError("Failed to parse enrollment end date", err)
+			return
+		}
+		if now.After(end) {
+			respondWithError("Enrollment closed", fmt.Errorf("enrollment closed on %s", course.EnrollmentEnd))
+			return
+		}
+	}
+
 	// Check if student is already enrolled
 	for _, studentID := range course.StudentIDs {
 		if studentID == req.UserID {
@@ -110,6 +204,18 @@ func main() {
 		}
 	}
 
+	// Prerequisite courses must be completed unless an instructor exempted
+	// the student
+	reason, err := unmetPrerequisite(db, course, req.UserID)
+	if err != nil {
+		respondWithError("Failed to check course prerequisites", err)
+		return
+	}
+	if reason != "" {
+		respondWithError("Prerequisites not met", fmt.Errorf("%s", reason))
+		return
+	}
+
 	// Add student to course
 	course.StudentIDs = append(course.StudentIDs, req.UserID)
 
@@ -138,7 +244,9 @@ func main() {
 	_, err = permitClient.SyncResource(context.Background(), "course", req.CourseID, map[string]interface{}{
 		"teacherId":  updatedCourse.TeacherID,
 		"studentIds": updatedCourse.StudentIDs,
-	})
+		"status":     updatedCourse.Status,
+		"termId":     updatedCourse.TermID,
+	}, permit.WithTenant(req.TenantID))
 	if err != nil {
 		log.Printf("Failed to sync course %s: %v", req.CourseID, err)
 	}
@@ -147,6 +255,196 @@ func main() {
 	respondWithSuccess("Successfully enrolled in course", updatedCourse)
 }
 
+// unmetPrerequisite returns why the student cannot enroll in the course yet,
+// or an empty string when all prerequisite courses are met. A prerequisite
+// course counts as completed once it is archived with the student on its
+// roster and a final grade of at least its minimum.
+func unmetPrerequisite(db *database.Client, course Course, studentID string) (string, error) {
+	for _, id := range course.PrerequisiteOverrides {
+		if id == studentID {
+			return "", nil
+		}
+	}
+
+	for i, id := range course.PrerequisiteCourseIDs {
+		result, err := db.GetDocument(
+			context.Background(),
+			"courses",
+			id,
+		)
+		if err != nil {
+			return fmt.Sprintf("prerequisite course %s is not available", id), nil
+		}
+
+		var required Course
+		if err := json.Unmarshal([]byte(result.String()), &required); err != nil {
+			return "", fmt.Errorf("failed to parse course %s: %w", id, err)
+		}
+		if required.TenantID != course.TenantID {
+			return fmt.Sprintf("prerequisite course %s is not available", id), nil
+		}
+
+		enrolled := false
+		for _, enrolledID := range required.StudentIDs {
+			if enrolledID == studentID {
+				enrolled = true
+			}
+		}
+		if !enrolled || required.Status != "archived" {
+			return fmt.Sprintf("enrollment requires completing %s", required.Title), nil
+		}
+
+		minGrade := 0.0
+		if i < len(course.PrerequisiteMinGrades) {
+			minGrade = course.PrerequisiteMinGrades[i]
+		}
+		if minGrade <= 0 {
+			continue
+		}
+
+		total, err := finalGrade(db, required, studentID)
+		if err != nil {
+			return "", err
+		}
+		if total == nil || *total < minGrade {
+			return fmt.Sprintf("enrollment requires a final grade of at least %g in %s", minGrade, required.Title), nil
+		}
+	}
+	return "", nil
+}
+
+// finalGrade returns the student's gradebook total in a course from released
+// grades: category averages after dropping the lowest grades, weighted over
+// the categories with graded work. It is nil while nothing is graded.
+func finalGrade(db *database.Client, course Course, studentID string) (*float64, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"grade_categories",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get grade categories: %w", err)
+	}
+
+	var categories []GradeCategory
+	if err := json.Unmarshal([]byte(result.String()), &categories); err != nil {
+		return nil, fmt.Errorf("failed to parse grade categories: %w", err)
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"assignments",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignments: %w", err)
+	}
+
+	var assignments []Assignment
+	if err := json.Unmarshal([]byte(result.String()), &assignments); err != nil {
+		return nil, fmt.Errorf("failed to parse assignments: %w", err)
+	}
+	if len(assignments) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	var released []string
+	for _, assignment := range assignments {
+		if gradesReleased(assignment, now) {
+			released = append(released, assignment.ID)
+		}
+	}
+	if len(released) == 0 {
+		return nil, nil
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"submissions",
+		[]interface{}{
+			query.Equal("assignmentId", released),
+			query.Equal("studentId", studentID),
+			query.Equal("counted", true),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submissions: %w", err)
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(result.String()), &submissions); err != nil {
+		return nil, fmt.Errorf("failed to parse submissions: %w", err)
+	}
+
+	grades := make(map[string]int)
+	for _, submission := range submissions {
+		if submission.Status != "draft" && submission.GradedAt != "" {
+			grades[submission.AssignmentID] = submission.Grade
+		}
+	}
+
+	weighted, weights := 0.0, 0.0
+	for _, category := range categories {
+		var categoryGrades []int
+		for _, id := range category.AssignmentIDs {
+			if grade, ok := grades[id]; ok {
+				categoryGrades = append(categoryGrades, grade)
+			}
+		}
+		if len(categoryGrades) == 0 {
+			continue
+		}
+		sort.Ints(categoryGrades)
+
+		// Always keep at least one grade
+		drop := category.DropLowest
+		if drop > len(categoryGrades)-1 {
+			drop = len(categoryGrades) - 1
+		}
+		if drop > 0 {
+			categoryGrades = categoryGrades[drop:]
+		}
+
+		sum := 0
+		for _, grade := range categoryGrades {
+			sum += grade
+		}
+		weighted += float64(sum) / float64(len(categoryGrades)) * category.Weight
+		weights += category.Weight
+	}
+
+	if weights == 0 {
+		return nil, nil
+	}
+	total := math.Round(weighted/weights*100) / 100
+	return &total, nil
+}
+
+// gradesReleased reports whether students may see their grades for the
+// assignment. Scheduled release dates are stored as RFC3339 instants.
+func gradesReleased(assignment Assignment, now time.Time) bool {
+	switch assignment.GradeRelease {
+	case "manual":
+		return assignment.GradesReleasedAt != ""
+	case "scheduled":
+		if assignment.GradesReleasedAt != "" {
+			return true
+		}
+		releaseDate, err := time.Parse(time.RFC3339, assignment.GradeReleaseDate)
+		return err == nil && !now.Before(releaseDate)
+	default:
+		return true
+	}
+}
+
 func respondWithSuccess(message string, data interface{}) {
 	response := Response{
 		Success: true,
@@ -163,3 +461,33 @@ func respondWithError(message string, err error) {
 	}
 	json.NewEncoder(os.Stdout).Encode(response)
 }
+
+// parseStartDate parses an RFC3339 instant, or a YYYY-MM-DD date as the start
+// of that day in loc
+func parseStartDate(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected RFC3339 timestamp or YYYY-MM-DD date", value)
+	}
+	return date, nil
+}
+
+// parseDeadline parses an RFC3339 instant, or a YYYY-MM-DD date as the last
+// second of that day in loc
+func parseDeadline(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q: expected RFC3339 timestamp or YYYY-MM-DD date", value)
+	}
+	// Adding 24 hours to midnight would be off by an hour on DST changes
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 23, 59, 59, 0, loc), nil
+}
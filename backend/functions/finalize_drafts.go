@@ -0,0 +1,658 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/appwrite/sdk-for-go"
+	"github.com/appwrite/sdk-for-go/database"
+	"github.com/appwrite/sdk-for-go/query"
+)
+
+// finalize_drafts runs on a schedule. It turns the drafts of assignments with
+// autoSubmitDrafts enabled into submissions once the student's due date has
+// passed, and quiz attempts once their time limit has passed. Quizzes are
+// graded and programming assignments queued for the autograder like in
+// submit_assignment. Drafts saved after the due date are left
+// for the student to submit late through submit_assignment.
+
+// Assignment represents an assignment in the LMS
+type Assignment struct {
+	ID               string `json:"id"`
+	CourseID         string `json:"courseId"`
+	DueDate          string `json:"dueDate"`
+	TenantID         string `json:"tenantId"`
+	MaxAttempts      int    `json:"maxAttempts"`
+	GradingRule      string `json:"gradingRule"`
+	AutoSubmitDrafts bool   `json:"autoSubmitDrafts"`
+	Type             string `json:"type"`
+	TimeLimitMinutes int    `json:"timeLimitMinutes"`
+}
+
+// Submission represents a student's submission for an assignment
+type Submission struct {
+	ID           string `json:"id"`
+	AssignmentID string `json:"assignmentId"`
+	StudentID    string `json:"studentId"`
+	TenantID     string `json:"tenantId"`
+	Attempt      int    `json:"attempt"`
+	Counted      bool   `json:"counted"`
+	Status       string `json:"status"`
+	SavedAt      string `json:"savedAt"`
+	Content      string `json:"content"`
+	Grade        int    `json:"grade"`
+	GradedAt     string `json:"gradedAt"`
+	StartedAt    string `json:"startedAt"`
+}
+
+// Course represents a course in the LMS
+type Course struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Timezone string `json:"timezone"`
+}
+
+// Section represents a cohort of a course
+type Section struct {
+	ID         string   `json:"id"`
+	CourseID   string   `json:"courseId"`
+	StudentIDs []string `json:"studentIds"`
+}
+
+// SectionDueDate overrides the due date of an assignment for one section
+type SectionDueDate struct {
+	SectionID    string `json:"sectionId"`
+	AssignmentID string `json:"assignmentId"`
+	DueDate      string `json:"dueDate"`
+}
+
+// Extension represents a per-student due date granted by an instructor
+type Extension struct {
+	AssignmentID string `json:"assignmentId"`
+	StudentID    string `json:"studentId"`
+	NewDueDate   string `json:"newDueDate"`
+}
+
+// QuizQuestion is one question of a quiz with its answers
+type QuizQuestion struct {
+	ID              string   `json:"id"`
+	Type            string   `json:"type"`
+	CorrectChoices  []int    `json:"correctChoices"`
+	NumericAnswer   *float64 `json:"numericAnswer"`
+	Tolerance       float64  `json:"tolerance"`
+	AcceptedAnswers []string `json:"acceptedAnswers"`
+	Points          int      `json:"points"`
+}
+
+// Response is the standard response format for Appwrite functions
+type Response struct {
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func main() {
+	// Initialize Appwrite client
+	client := sdk.NewClient()
+	client.SetEndpoint(os.Getenv("APPWRITE_ENDPOINT"))
+	client.SetProject(os.Getenv("APPWRITE_FUNCTION_PROJECT_ID"))
+	client.SetKey(os.Getenv("APPWRITE_API_KEY"))
+
+	// Initialize database client
+	db := database.NewClient(client)
+
+	// Get all saved drafts
+	result, err := db.ListDocuments(
+		context.Background(),
+		"submissions",
+		[]interface{}{
+			query.Equal("status", "draft"),
+		},
+	)
+	if err != nil {
+		respondWithError("Failed to get drafts", err)
+		return
+	}
+
+	var drafts []Submission
+	if err := json.Unmarshal([]byte(result.String()), &drafts); err != nil {
+		respondWithError("Failed to parse drafts", err)
+		return
+	}
+
+	now := time.Now()
+	finalized := []string{}
+	for _, draft := range drafts {
+		ok, err := finalizeDraft(db, draft, now)
+		if err != nil {
+			// Keep going so one broken draft does not block the others
+			log.Printf("Failed to finalize draft %s: %v", draft.ID, err)
+			continue
+		}
+		if ok {
+			finalized = append(finalized, draft.ID)
+		}
+	}
+
+	respondWithSuccess("Drafts finalized", map[string]interface{}{
+		"finalized": finalized,
+	})
+}
+
+// finalizeDraft submits the draft if its assignment auto-submits drafts and
+// the student's due date has passed, or if it is a quiz attempt whose time
+// limit has passed. It reports whether the draft was submitted.
+func finalizeDraft(db *database.Client, draft Submission, now time.Time) (bool, error) {
+	result, err := db.GetDocument(
+		context.Background(),
+		"assignments",
+		draft.AssignmentID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to get assignment: %w", err)
+	}
+
+	var assignment Assignment
+	if err := json.Unmarshal([]byte(result.String()), &assignment); err != nil {
+		return false, fmt.Errorf("failed to parse assignment: %w", err)
+	}
+
+	timedOut := assignment.Type == "quiz" && quizTimedOut(assignment, draft, now)
+	if !assignment.AutoSubmitDrafts && !timedOut {
+		return false, nil
+	}
+
+	result, err = db.GetDocument(
+		context.Background(),
+		"courses",
+		assignment.CourseID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to get course: %w", err)
+	}
+
+	var course Course
+	if err := json.Unmarshal([]byte(result.String()), &course); err != nil {
+		return false, fmt.Errorf("failed to parse course: %w", err)
+	}
+
+	// Archived courses are read-only
+	if course.Status == "archived" {
+		return false, nil
+	}
+
+	// An extension wins over the due date of the student's section
+	dueDateValue, err := extensionDueDate(db, assignment, draft.StudentID)
+	if err != nil {
+		return false, err
+	}
+	if dueDateValue == "" {
+		dueDateValue, err = sectionDueDate(db, assignment, draft.StudentID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	loc := time.UTC
+	if course.Timezone != "" {
+		loc, err = time.LoadLocation(course.Timezone)
+		if err != nil {
+			return false, fmt.Errorf("failed to load course timezone: %w", err)
+		}
+	}
+
+	dueDate, err := parseDeadline(dueDateValue, loc)
+	if err != nil {
+		return false, err
+	}
+
+	if !draftDue(draft, dueDate, now, timedOut) {
+		return false, nil
+	}
+
+	// Number the attempt and enforce the attempt limit
+	result, err = db.ListDocuments(
+		context.Background(),
+		"submissions",
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", draft.StudentID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to get submissions: %w", err)
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(result.String()), &submissions); err != nil {
+		return false, fmt.Errorf("failed to parse submissions: %w", err)
+	}
+
+	var attempts []Submission
+	for _, submission := range submissions {
+		if submission.Status != "draft" {
+			attempts = append(attempts, submission)
+		}
+	}
+
+	if assignment.MaxAttempts > 0 && len(attempts) >= assignment.MaxAttempts {
+		return false, nil
+	}
+
+	// Quizzes are graded right away. The draft is on time, so no late
+	// penalty applies.
+	grade := -1
+	if assignment.Type == "quiz" {
+		questions, err := quizQuestions(db, assignment)
+		if err != nil {
+			return false, err
+		}
+		grade, err = scoreQuiz(questions, draft.Content)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	counted := len(attempts) == 0 || assignment.GradingRule == "" || assignment.GradingRule == "latest"
+
+	// A graded quiz attempt counts under "best" when it beats the counted one
+	if grade >= 0 && assignment.GradingRule == "best" {
+		counted = true
+		for _, attempt := range attempts {
+			if attempt.Counted && attempt.GradedAt != "" && attempt.Grade >= grade {
+				counted = false
+			}
+		}
+	}
+
+	// The draft was saved before the due date, so it is on time
+	data := map[string]interface{}{
+		"status":             "submitted",
+		"submittedAt":        draft.SavedAt,
+		"grade":              0,
+		"feedback":           "",
+		"late":               false,
+		"minutesLate":        0,
+		"latePenaltyPercent": 0,
+		"attempt":            len(attempts) + 1,
+		"counted":            counted,
+	}
+	if grade >= 0 {
+		data["grade"] = grade
+		data["rawGrade"] = grade
+		data["gradedAt"] = draft.SavedAt
+	}
+
+	_, err = db.UpdateDocument(
+		context.Background(),
+		"submissions",
+		draft.ID,
+		data,
+	)
+	if isConflict(err) {
+		// The student submitted at the same time and took the attempt
+		// number. The next run counts the attempts again.
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to submit draft: %w", err)
+	}
+
+	// Record the automatic grade in the grade history
+	if grade >= 0 {
+		_, err = db.CreateDocument(
+			context.Background(),
+			"grade_history",
+			"unique()",
+			map[string]interface{}{
+				"submissionId": draft.ID,
+				"assignmentId": assignment.ID,
+				"studentId":    draft.StudentID,
+				"gradedBy":     "",
+				"changedAt":    now.Format(time.RFC3339),
+				"oldGrade":     nil,
+				"newGrade":     grade,
+				"oldRawGrade":  nil,
+				"newRawGrade":  grade,
+				"oldFeedback":  "",
+				"newFeedback":  "",
+				"reason":       "Graded automatically",
+				"source":       "quiz",
+				"tenantId":     assignment.TenantID,
+			},
+		)
+		if err != nil {
+			return true, fmt.Errorf("failed to record grade history: %w", err)
+		}
+	}
+
+	// Only one attempt counts at a time
+	if counted {
+		for _, attempt := range attempts {
+			if !attempt.Counted {
+				continue
+			}
+			_, err = db.UpdateDocument(
+				context.Background(),
+				"submissions",
+				attempt.ID,
+				map[string]interface{}{
+					"counted": false,
+				},
+			)
+			if err != nil {
+				return true, fmt.Errorf("failed to update previous attempt: %w", err)
+			}
+		}
+	}
+
+	// Programming assignments are graded by running the test suite
+	if assignment.Type == "programming" {
+		if _, err := queueAutograde(db, draft); err != nil {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// draftDue reports whether a draft is ready to be submitted: the student's
+// due date or the quiz's time limit has passed, and the draft was saved by
+// the due date
+func draftDue(draft Submission, dueDate, now time.Time, timedOut bool) bool {
+	if now.Before(dueDate) && !timedOut {
+		return false
+	}
+	savedAt, err := time.Parse(time.RFC3339, draft.SavedAt)
+	return err == nil && !savedAt.After(dueDate)
+}
+
+// queueAutograde adds a run of the assignment's test suite against the
+// submission to the autograder's queue, which the backend works through
+func queueAutograde(db *database.Client, submission Submission) (string, error) {
+	result, err := db.CreateDocument(
+		context.Background(),
+		"autograde_runs",
+		"unique()",
+		map[string]interface{}{
+			"submissionId": submission.ID,
+			"assignmentId": submission.AssignmentID,
+			"studentId":    submission.StudentID,
+			"status":       "queued",
+			"queuedAt":     time.Now().Format(time.RFC3339),
+			"tenantId":     submission.TenantID,
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to queue autograde run: %w", err)
+	}
+
+	var run struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(result.String()), &run); err != nil {
+		return "", fmt.Errorf("failed to parse autograde run: %w", err)
+	}
+
+	_, err = db.UpdateDocument(
+		context.Background(),
+		"submissions",
+		submission.ID,
+		map[string]interface{}{
+			"autogradeRunId":  run.ID,
+			"autogradeStatus": "queued",
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to update autograde status: %w", err)
+	}
+	return run.ID, nil
+}
+
+// quizTimedOut reports whether the time limit of a started quiz has passed,
+// allowing a minute for network delays
+func quizTimedOut(assignment Assignment, draft Submission, now time.Time) bool {
+	if assignment.TimeLimitMinutes == 0 {
+		return false
+	}
+	startedAt, err := time.Parse(time.RFC3339, draft.StartedAt)
+	if err != nil {
+		return false
+	}
+	limit := time.Duration(assignment.TimeLimitMinutes)*time.Minute + time.Minute
+	return now.After(startedAt.Add(limit))
+}
+
+// quizQuestions returns the questions of a quiz
+func quizQuestions(db *database.Client, assignment Assignment) ([]QuizQuestion, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"quiz_questions",
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quiz questions: %w", err)
+	}
+
+	var questions []QuizQuestion
+	if err := json.Unmarshal([]byte(result.String()), &questions); err != nil {
+		return nil, fmt.Errorf("failed to parse quiz questions: %w", err)
+	}
+	return questions, nil
+}
+
+// scoreQuiz grades quiz answers, a JSON object from question ID to answer.
+// The grade is the share of the quiz's points earned, scaled to 0-100.
+// Unanswered questions earn nothing.
+func scoreQuiz(questions []QuizQuestion, content string) (int, error) {
+	answers := make(map[string]json.RawMessage)
+	if content != "" {
+		if err := json.Unmarshal([]byte(content), &answers); err != nil {
+			return 0, fmt.Errorf("answers must be a JSON object: %w", err)
+		}
+	}
+
+	earned, possible := 0, 0
+	for _, question := range questions {
+		possible += question.Points
+		if answer, ok := answers[question.ID]; ok && answerCorrect(question, answer) {
+			earned += question.Points
+		}
+	}
+	if possible == 0 {
+		return 0, fmt.Errorf("quiz is worth 0 points")
+	}
+
+	return int(math.Round(float64(earned) * 100 / float64(possible))), nil
+}
+
+// answerCorrect reports whether an answer to a question is right. Answers of
+// the wrong JSON type are wrong.
+func answerCorrect(question QuizQuestion, answer json.RawMessage) bool {
+	switch question.Type {
+	case "multiple_choice", "true_false":
+		var choice int
+		if err := json.Unmarshal(answer, &choice); err != nil {
+			return false
+		}
+		return len(question.CorrectChoices) == 1 && choice == question.CorrectChoices[0]
+
+	case "multi_select":
+		var choices []int
+		if err := json.Unmarshal(answer, &choices); err != nil {
+			return false
+		}
+		picked := make(map[int]bool)
+		for _, choice := range choices {
+			picked[choice] = true
+		}
+		if len(picked) != len(question.CorrectChoices) {
+			return false
+		}
+		for _, choice := range question.CorrectChoices {
+			if !picked[choice] {
+				return false
+			}
+		}
+		return true
+
+	case "numeric":
+		var value float64
+		if err := json.Unmarshal(answer, &value); err != nil || question.NumericAnswer == nil {
+			return false
+		}
+		return math.Abs(value-*question.NumericAnswer) <= question.Tolerance
+
+	case "short_answer":
+		var text string
+		if err := json.Unmarshal(answer, &text); err != nil {
+			return false
+		}
+		for _, accepted := range question.AcceptedAnswers {
+			if normalizeAnswer(text) == normalizeAnswer(accepted) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// normalizeAnswer ignores case and extra spaces in short answers
+func normalizeAnswer(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// isConflict reports whether Appwrite rejected a write because it violates
+// a unique index
+func isConflict(err error) bool {
+	var appwriteErr interface{ GetStatusCode() int }
+	return errors.As(err, &appwriteErr) && appwriteErr.GetStatusCode() == http.StatusConflict
+}
+
+// parseDeadline parses an RFC3339 instant, or a YYYY-MM-DD date as the last
+// second of that day in loc
+func parseDeadline(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q: expected RFC3339 timestamp or YYYY-MM-DD date", value)
+	}
+	// Adding 24 hours to midnight would be off by an hour on DST changes
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 23, 59, 59, 0, loc), nil
+}
+
+// extensionDueDate returns the due date of the extension granted to the
+// student for the assignment, or an empty string if there is none.
+func extensionDueDate(db *database.Client, assignment Assignment, studentID string) (string, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"extensions",
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", studentID),
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get extensions: %w", err)
+	}
+
+	var extensions []Extension
+	if err := json.Unmarshal([]byte(result.String()), &extensions); err != nil {
+		return "", fmt.Errorf("failed to parse extensions: %w", err)
+	}
+	if len(extensions) == 0 {
+		return "", nil
+	}
+	return extensions[0].NewDueDate, nil
+}
+
+// sectionDueDate returns the due date of the assignment for the section the
+// student is enrolled in, falling back to the assignment's own due date.
+func sectionDueDate(db *database.Client, assignment Assignment, studentID string) (string, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"sections",
+		[]interface{}{
+			query.Equal("courseId", assignment.CourseID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get sections: %w", err)
+	}
+
+	var sections []Section
+	if err := json.Unmarshal([]byte(result.String()), &sections); err != nil {
+		return "", fmt.Errorf("failed to parse sections: %w", err)
+	}
+
+	for _, section := range sections {
+		enrolled := false
+		for _, id := range section.StudentIDs {
+			if id == studentID {
+				enrolled = true
+				break
+			}
+		}
+		if !enrolled {
+			continue
+		}
+
+		result, err := db.ListDocuments(
+			context.Background(),
+			"section_due_dates",
+			[]interface{}{
+				query.Equal("sectionId", section.ID),
+				query.Equal("assignmentId", assignment.ID),
+			},
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to get due date overrides: %w", err)
+		}
+
+		var overrides []SectionDueDate
+		if err := json.Unmarshal([]byte(result.String()), &overrides); err != nil {
+			return "", fmt.Errorf("failed to parse due date overrides: %w", err)
+		}
+		if len(overrides) > 0 {
+			return overrides[0].DueDate, nil
+		}
+		break
+	}
+
+	return assignment.DueDate, nil
+}
+
+func respondWithSuccess(message string, data interface{}) {
+	response := Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+	}
+	json.NewEncoder(os.Stdout).Encode(response)
+}
+
+func respondWithError(message string, err error) {
+	response := Response{
+		Success: false,
+		Message: fmt.Sprintf("%s: %v", message, err),
+	}
+	json.NewEncoder(os.Stdout).Encode(response)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDraftDue(t *testing.T) {
+	dueDate := time.Date(2026, 5, 10, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		draft    Submission
+		now      time.Time
+		timedOut bool
+		want     bool
+	}{
+		{
+			name:  "due date still ahead",
+			draft: Submission{SavedAt: "2026-05-10T20:00:00Z"},
+			now:   dueDate.Add(-time.Minute),
+			want:  false,
+		},
+		{
+			name:  "saved before the due date",
+			draft: Submission{SavedAt: "2026-05-10T20:00:00Z"},
+			now:   dueDate.Add(time.Minute),
+			want:  true,
+		},
+		{
+			name:  "saved at the due date",
+			draft: Submission{SavedAt: "2026-05-10T23:59:59Z"},
+			now:   dueDate.Add(time.Minute),
+			want:  true,
+		},
+		{
+			name:  "saved after the due date",
+			draft: Submission{SavedAt: "2026-05-11T00:00:00Z"},
+			now:   dueDate.Add(time.Hour),
+			want:  false,
+		},
+		{
+			name:  "never saved",
+			draft: Submission{},
+			now:   dueDate.Add(time.Minute),
+			want:  false,
+		},
+		{
+			name:     "quiz time limit passed before the due date",
+			draft:    Submission{SavedAt: "2026-05-10T20:00:00Z"},
+			now:      dueDate.Add(-time.Hour),
+			timedOut: true,
+			want:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := draftDue(tt.draft, dueDate, tt.now, tt.timedOut); got != tt.want {
+				t.Errorf("draftDue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
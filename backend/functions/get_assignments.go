@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/appwrite/sdk-for-go"
 	"github.com/appwrite/sdk-for-go/database"
@@ -15,11 +16,55 @@ import (
 
 // Assignment represents an assignment in the LMS
 type Assignment struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	CourseID         string `json:"courseId"`
+	DueDate          string `json:"dueDate"`
+	TenantID         string `json:"tenantId"`
+	GradeRelease     string `json:"gradeRelease"` // immediate, manual or scheduled
+	GradeReleaseDate string `json:"gradeReleaseDate"`
+	GradesReleasedAt string `json:"gradesReleasedAt"`
+}
+
+// Submission is an attempt at an assignment, as far as prerequisites need it
+type Submission struct {
+	AssignmentID string `json:"assignmentId"`
+	Status       string `json:"status"` // draft or submitted
+	Grade        int    `json:"grade"`
+	Counted      bool   `json:"counted"`
+	GradedAt     string `json:"gradedAt"`
+}
+
+// Prerequisite is a condition a student must meet to unlock a module or an
+// assignment
+type Prerequisite struct {
+	TargetType string `json:"targetType"` // module or assignment
+	TargetID   string `json:"targetId"`
+	Type       string `json:"type"` // lesson_completed or min_score
+	ItemID     string `json:"itemId"`
+	MinScore   int    `json:"minScore"`
+}
+
+// Course represents a course in the LMS
+type Course struct {
+	ID         string   `json:"id"`
+	TenantID   string   `json:"tenantId"`
+	StudentIDs []string `json:"studentIds"`
+}
+
+// Module is an ordered section of a course's content
+type Module struct {
 	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	CourseID    string `json:"courseId"`
-	DueDate     string `json:"dueDate"`
+	PublishDate string `json:"publishDate"` // RFC3339, empty means published
+}
+
+// ModuleItem places a lesson or an assignment in a module
+type ModuleItem struct {
+	ModuleID    string `json:"moduleId"`
+	Type        string `json:"type"`
+	ItemID      string `json:"itemId"`
+	PublishDate string `json:"publishDate"` // RFC3339, empty means published
 }
 
 // Response is the standard response format for Appwrite functions
@@ -53,18 +98,28 @@ func main() {
 		UserID    string `json:"userId"`
 		UserRole  string `json:"userRole"`
 		CourseID  string `json:"courseId"`
+		TenantID  string `json:"tenantId"`
 	}
 	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
 		respondWithError("Failed to parse request", err)
 		return
 	}
 
+	// Requests without an organization act in the default tenant
+	if req.TenantID == "" {
+		req.TenantID = os.Getenv("DEFAULT_TENANT")
+	}
+	if req.TenantID == "" {
+		req.TenantID = "default"
+	}
+
 	// Check if user can access this course using Permit
 	allowed, err := permitClient.Check(
 		context.Background(),
 		req.UserID,                // User ID
 		"read",                    // Action
 		"course:"+req.CourseID,    // Resource
+		permit.WithTenant(req.TenantID),
 	)
 	if err != nil {
 		respondWithError("Failed to check permissions", err)
@@ -83,7 +138,10 @@ func main() {
 	result, err := db.ListDocuments(
 		context.Background(),
 		"assignments",
-		[]interface{}{query.Equal("courseId", req.CourseID)},
+		[]interface{}{
+			query.Equal("courseId", req.CourseID),
+			query.Equal("tenantId", req.TenantID),
+		},
 	)
 	if err != nil {
 		respondWithError("Failed to get assignments", err)
@@ -97,10 +155,305 @@ func main() {
 		return
 	}
 
+	// Students only see the assignments they can open
+	result, err = db.GetDocument(
+		context.Background(),
+		"courses",
+		req.CourseID,
+	)
+	if err != nil {
+		respondWithError("Failed to get course", err)
+		return
+	}
+
+	var course Course
+	if err := json.Unmarshal([]byte(result.String()), &course); err != nil {
+		respondWithError("Failed to parse course", err)
+		return
+	}
+
+	student := false
+	for _, id := range course.StudentIDs {
+		if id == req.UserID {
+			student = true
+			break
+		}
+	}
+	if student {
+		now := time.Now()
+		items, err := courseModuleItems(db, course)
+		if err != nil {
+			respondWithError("Failed to get module items", err)
+			return
+		}
+		unpublished, err := unpublishedAssignments(db, course, items, now)
+		if err != nil {
+			respondWithError("Failed to get modules", err)
+			return
+		}
+		progress, err := loadProgress(db, course, req.UserID, now)
+		if err != nil {
+			respondWithError("Failed to evaluate prerequisites", err)
+			return
+		}
+		visible := []Assignment{}
+		for _, assignment := range assignments {
+			if !unpublished[assignment.ID] && !progress.locked("assignment", assignment.ID) {
+				visible = append(visible, assignment)
+			}
+		}
+		assignments = visible
+	}
+
 	// Return assignments
 	respondWithSuccess("Assignments retrieved successfully", assignments)
 }
 
+// courseModuleItems returns the items of all modules of the course
+func courseModuleItems(db *database.Client, course Course) ([]ModuleItem, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"module_items",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module items: %w", err)
+	}
+
+	var items []ModuleItem
+	if err := json.Unmarshal([]byte(result.String()), &items); err != nil {
+		return nil, fmt.Errorf("failed to parse module items: %w", err)
+	}
+	return items, nil
+}
+
+// unpublishedAssignments returns the IDs of the course's assignments that
+// students cannot see yet. It must match the backend: assignments outside
+// every module are published, and those in modules once one of their items
+// and its module are.
+func unpublishedAssignments(db *database.Client, course Course, items []ModuleItem, now time.Time) (map[string]bool, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"modules",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get modules: %w", err)
+	}
+
+	var modules []Module
+	if err := json.Unmarshal([]byte(result.String()), &modules); err != nil {
+		return nil, fmt.Errorf("failed to parse modules: %w", err)
+	}
+
+	modulePublished := make(map[string]bool)
+	for _, module := range modules {
+		modulePublished[module.ID] = isPublished(module.PublishDate, now)
+	}
+
+	unpublished := make(map[string]bool)
+	published := make(map[string]bool)
+	for _, item := range items {
+		if item.Type != "assignment" {
+			continue
+		}
+		if modulePublished[item.ModuleID] && isPublished(item.PublishDate, now) {
+			published[item.ItemID] = true
+		} else {
+			unpublished[item.ItemID] = true
+		}
+	}
+	for id := range published {
+		delete(unpublished, id)
+	}
+	return unpublished, nil
+}
+
+// contentProgress is what a student has done in a course, to evaluate the
+// course's prerequisites the same way as the backend
+type contentProgress struct {
+	prerequisites []Prerequisite
+	moduleOf      map[string]string // Module ID by assignment ID
+	completed     map[string]bool   // Completed lesson IDs
+	scores        map[string]int    // Released grades by assignment ID
+}
+
+// met reports whether the student meets a prerequisite
+func (p *contentProgress) met(prerequisite Prerequisite) bool {
+	switch prerequisite.Type {
+	case "lesson_completed":
+		return p.completed[prerequisite.ItemID]
+	case "min_score":
+		score, ok := p.scores[prerequisite.ItemID]
+		return ok && score >= prerequisite.MinScore
+	default:
+		return false
+	}
+}
+
+// locked reports whether a module or assignment is locked for the student.
+// Assignments are also locked by the prerequisites of their module.
+func (p *contentProgress) locked(targetType, targetID string) bool {
+	for _, prerequisite := range p.prerequisites {
+		if prerequisite.TargetType == targetType && prerequisite.TargetID == targetID && !p.met(prerequisite) {
+			return true
+		}
+	}
+	if moduleID, ok := p.moduleOf[targetID]; ok && targetType == "assignment" {
+		return p.locked("module", moduleID)
+	}
+	return false
+}
+
+// loadProgress loads what a student has done in a course. Scores are the
+// counted attempts at the course's assignments, and count only once the
+// assignment's grades are released.
+func loadProgress(db *database.Client, course Course, studentID string, now time.Time) (*contentProgress, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"prerequisites",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+
+	progress := &contentProgress{
+		moduleOf:  make(map[string]string),
+		completed: make(map[string]bool),
+		scores:    make(map[string]int),
+	}
+	if err := json.Unmarshal([]byte(result.String()), &progress.prerequisites); err != nil {
+		return nil, fmt.Errorf("failed to parse prerequisites: %w", err)
+	}
+	if len(progress.prerequisites) == 0 {
+		return progress, nil
+	}
+
+	items, err := courseModuleItems(db, course)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Type == "assignment" {
+			progress.moduleOf[item.ItemID] = item.ModuleID
+		}
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"lesson_completions",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lesson completions: %w", err)
+	}
+
+	var completions []struct {
+		LessonID string `json:"lessonId"`
+	}
+	if err := json.Unmarshal([]byte(result.String()), &completions); err != nil {
+		return nil, fmt.Errorf("failed to parse lesson completions: %w", err)
+	}
+	for _, completion := range completions {
+		progress.completed[completion.LessonID] = true
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"assignments",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignments: %w", err)
+	}
+
+	var assignments []Assignment
+	if err := json.Unmarshal([]byte(result.String()), &assignments); err != nil {
+		return nil, fmt.Errorf("failed to parse assignments: %w", err)
+	}
+	if len(assignments) == 0 {
+		return progress, nil
+	}
+	byID := make(map[string]Assignment)
+	var assignmentIDs []string
+	for _, assignment := range assignments {
+		byID[assignment.ID] = assignment
+		assignmentIDs = append(assignmentIDs, assignment.ID)
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"submissions",
+		[]interface{}{
+			query.Equal("assignmentId", assignmentIDs),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", course.TenantID),
+			query.Equal("counted", true),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submissions: %w", err)
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(result.String()), &submissions); err != nil {
+		return nil, fmt.Errorf("failed to parse submissions: %w", err)
+	}
+	for _, submission := range submissions {
+		if submission.Status == "draft" || submission.GradedAt == "" {
+			continue
+		}
+		if gradesReleased(byID[submission.AssignmentID], now) {
+			progress.scores[submission.AssignmentID] = submission.Grade
+		}
+	}
+	return progress, nil
+}
+
+// gradesReleased reports whether students may see their grades for the
+// assignment. Scheduled release dates are stored as RFC3339 instants.
+func gradesReleased(assignment Assignment, now time.Time) bool {
+	switch assignment.GradeRelease {
+	case "manual":
+		return assignment.GradesReleasedAt != ""
+	case "scheduled":
+		if assignment.GradesReleasedAt != "" {
+			return true
+		}
+		releaseDate, err := time.Parse(time.RFC3339, assignment.GradeReleaseDate)
+		return err == nil && !now.Before(releaseDate)
+	default:
+		return true
+	}
+}
+
+// isPublished reports whether content with the publish date is published at
+// the given time
+func isPublished(publishDate string, now time.Time) bool {
+	if publishDate == "" {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, publishDate)
+	return err == nil && !now.Before(t)
+}
+
 func respondWithSuccess(message string, data interface{}) {
 	response := Response{
 		Success: true,
@@ -16,11 +16,17 @@ import (
 
 // Course represents a course in the LMS
 type Course struct {
-	ID          string   `json:"id"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	TeacherID   string   `json:"teacherId"`
-	StudentIDs  []string `json:"studentIds"`
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	TeacherID       string   `json:"teacherId"`
+	StudentIDs      []string `json:"studentIds"`
+	TenantID        string   `json:"tenantId"`
+	TermID          string   `json:"termId"`
+	Status          string   `json:"status"`
+	EnrollmentStart string   `json:"enrollmentStart"`
+	EnrollmentEnd   string   `json:"enrollmentEnd"`
+	Timezone        string   `json:"timezone"`
 }
 
 // Response is the standard response format for Appwrite functions
@@ -51,16 +57,27 @@ func main() {
 
 	// Parse request
 	var req struct {
-		UserID   string `json:"userId"`
-		UserRole string `json:"userRole"`
+		UserID          string `json:"userId"`
+		UserRole        string `json:"userRole"`
+		TenantID        string `json:"tenantId"`
+		TermID          string `json:"termId"`
+		IncludeArchived bool   `json:"includeArchived"`
 	}
 	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
 		respondWithError("Failed to parse request", err)
 		return
 	}
 
+	// Requests without an organization act in the default tenant
+	if req.TenantID == "" {
+		req.TenantID = os.Getenv("DEFAULT_TENANT")
+	}
+	if req.TenantID == "" {
+		req.TenantID = "default"
+	}
+
 	// Get courses based on user role
-	courses, err := getCourses(client, permitClient, req.UserID, req.UserRole)
+	courses, err := getCourses(client, permitClient, req.UserID, req.UserRole, req.TenantID, req.TermID, req.IncludeArchived)
 	if err != nil {
 		respondWithError("Failed to get courses", err)
 		return
@@ -70,18 +87,28 @@ func main() {
 	respondWithSuccess("Courses retrieved successfully", courses)
 }
 
-func getCourses(client *sdk.Client, permitClient *permit.Permit, userID, userRole string) ([]Course, error) {
+func getCourses(client *sdk.Client, permitClient *permit.Permit, userID, userRole, tenantID, termID string, includeArchived bool) ([]Course, error) {
 	// Initialize database client
 	db := database.NewClient(client)
 	var courses []Course
 
+	// Queries shared by all roles: the organization, the term and, unless
+	// requested, no archived courses
+	filters := []interface{}{query.Equal("tenantId", tenantID)}
+	if termID != "" {
+		filters = append(filters, query.Equal("termId", termID))
+	}
+	if !includeArchived {
+		filters = append(filters, query.NotEqual("status", "archived"))
+	}
+
 	switch userRole {
 	case "admin":
-		// Admins can see all courses
+		// Admins can see all courses of their organization
 		result, err := db.ListDocuments(
 			context.Background(),
 			"courses",
-			[]interface{}{}, // No queries, get all
+			filters,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get courses: %w", err)
@@ -97,7 +124,7 @@ func getCourses(client *sdk.Client, permitClient *permit.Permit, userID, userRol
 		result, err := db.ListDocuments(
 			context.Background(),
 			"courses",
-			[]interface{}{query.Equal("teacherId", userID)},
+			append(filters, query.Equal("teacherId", userID)),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get courses: %w", err)
@@ -110,11 +137,12 @@ func getCourses(client *sdk.Client, permitClient *permit.Permit, userID, userRol
 
 	case "student":
 		// Students can see courses they're enrolled in
-		// First, get all courses
+		// First, get all courses of their organization; drafts are never
+		// shown to students
 		result, err := db.ListDocuments(
 			context.Background(),
 			"courses",
-			[]interface{}{}, // No queries, get all
+			append(filters, query.NotEqual("status", "draft")),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get courses: %w", err)
@@ -134,6 +162,7 @@ func getCourses(client *sdk.Client, permitClient *permit.Permit, userID, userRol
 				userID,                // User ID
 				"read",                // Action
 				"course:"+course.ID,   // Resource
+				permit.WithTenant(tenantID),
 			)
 			if err != nil {
 				log.Printf("Permit check error: %v", err)
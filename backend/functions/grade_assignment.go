@@ -2,25 +2,80 @@ package main
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"time"
 
 	"github.com/appwrite/sdk-for-go"
 	"github.com/appwrite/sdk-for-go/database"
+	"github.com/appwrite/sdk-for-go/query"
 	"github.com/permitio/permit-golang/pkg/permit"
 )
 
 // Submission represents a student's submission for an assignment
 type Submission struct {
+	ID                 string        `json:"id"`
+	AssignmentID       string        `json:"assignmentId"`
+	StudentID          string        `json:"studentId"`
+	Content            string        `json:"content"`
+	SubmittedAt        string        `json:"submittedAt"`
+	Grade              int           `json:"grade"`
+	RawGrade           int           `json:"rawGrade"` // Grade before the late penalty
+	Feedback           string        `json:"feedback"`
+	TenantID           string        `json:"tenantId"`
+	Late               bool          `json:"late"`
+	MinutesLate        int           `json:"minutesLate"`
+	LatePenaltyPercent int           `json:"latePenaltyPercent"`
+	Attempt            int           `json:"attempt"`
+	Counted            bool          `json:"counted"`
+	GradedAt           string        `json:"gradedAt"`
+	AttachmentIDs      []string      `json:"attachmentIds"`
+	Status             string        `json:"status"` // draft or submitted
+	RubricScores       []RubricScore `json:"rubricScores,omitempty"`
+}
+
+// RubricCriterion is one row of an assignment's rubric
+type RubricCriterion struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	LevelTitles []string `json:"levelTitles"`
+	LevelPoints []int    `json:"levelPoints"`
+}
+
+// RubricScore is the level picked for one criterion of a submission
+type RubricScore struct {
 	ID           string `json:"id"`
-	AssignmentID string `json:"assignmentId"`
-	StudentID    string `json:"studentId"`
-	Content      string `json:"content"`
-	SubmittedAt  string `json:"submittedAt"`
-	Grade        int    `json:"grade"`
-	Feedback     string `json:"feedback"`
+	SubmissionID string `json:"submissionId"`
+	CriterionID  string `json:"criterionId"`
+	Level        int    `json:"level"`
+	Points       int    `json:"points"`
+	Comment      string `json:"comment"`
+	GradedBy     string `json:"gradedBy"`
+	TenantID     string `json:"tenantId"`
+}
+
+// Assignment represents an assignment in the LMS
+type Assignment struct {
+	ID               string `json:"id"`
+	CourseID         string `json:"courseId"`
+	GradingRule      string `json:"gradingRule"` // "latest" (default), "best" or "first"
+	TenantID         string `json:"tenantId"`
+	BlindGrading     bool   `json:"blindGrading"`
+	GradeRelease     string `json:"gradeRelease"`     // "immediate" (default), "manual" or "scheduled"
+	GradeReleaseDate string `json:"gradeReleaseDate"` // RFC3339
+	GradesReleasedAt string `json:"gradesReleasedAt"`
+}
+
+// Course represents a course in the LMS
+type Course struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
 }
 
 // Response is the standard response format for Appwrite functions
@@ -51,17 +106,28 @@ func main() {
 
 	// Parse request
 	var req struct {
-		UserID       string `json:"userId"`
-		UserRole     string `json:"userRole"`
-		SubmissionID string `json:"submissionId"`
-		Grade        int    `json:"grade"`
-		Feedback     string `json:"feedback"`
+		UserID       string        `json:"userId"`
+		UserRole     string        `json:"userRole"`
+		SubmissionID string        `json:"submissionId"`
+		Grade        int           `json:"grade"`
+		RubricScores []RubricScore `json:"rubricScores"` // Required when the assignment has a rubric
+		Feedback     string        `json:"feedback"`
+		Reason       string        `json:"reason"` // Required when changing an existing grade
+		TenantID     string        `json:"tenantId"`
 	}
 	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
 		respondWithError("Failed to parse request", err)
 		return
 	}
 
+	// Requests without an organization act in the default tenant
+	if req.TenantID == "" {
+		req.TenantID = os.Getenv("DEFAULT_TENANT")
+	}
+	if req.TenantID == "" {
+		req.TenantID = "default"
+	}
+
 	// Only teachers and admins can grade assignments
 	if req.UserRole != "teacher" && req.UserRole != "admin" {
 		respondWithError("Only teachers and admins can grade assignments", fmt.Errorf("user role is %s", req.UserRole))
@@ -89,12 +155,25 @@ func main() {
 		return
 	}
 
+	// Submissions of other organizations are invisible to the user
+	if submission.TenantID != req.TenantID {
+		respondWithError("Failed to get submission", fmt.Errorf("submission %s not found", req.SubmissionID))
+		return
+	}
+
+	// Drafts are private to the student until submitted
+	if submission.Status == "draft" {
+		respondWithError("Failed to get submission", fmt.Errorf("submission %s not found", req.SubmissionID))
+		return
+	}
+
 	// Check if user can grade this assignment using Permit
 	allowed, err := permitClient.Check(
 		context.Background(),
 		req.UserID,                            // User ID
 		"grade",                               // Action
 		"assignment:"+submission.AssignmentID, // Resource
+		permit.WithTenant(req.TenantID),
 	)
 	if err != nil {
 		respondWithError("Failed to check permissions", err)
@@ -106,14 +185,90 @@ func main() {
 		return
 	}
 
+	// Archived courses are read-only
+	result, err = db.GetDocument(
+		context.Background(),
+		"assignments",
+		submission.AssignmentID,
+	)
+	if err != nil {
+		respondWithError("Failed to get assignment", err)
+		return
+	}
+
+	var assignment Assignment
+	if err := json.Unmarshal([]byte(result.String()), &assignment); err != nil {
+		respondWithError("Failed to parse assignment", err)
+		return
+	}
+
+	result, err = db.GetDocument(
+		context.Background(),
+		"courses",
+		assignment.CourseID,
+	)
+	if err != nil {
+		respondWithError("Failed to get course", err)
+		return
+	}
+
+	var course Course
+	if err := json.Unmarshal([]byte(result.String()), &course); err != nil {
+		respondWithError("Failed to parse course", err)
+		return
+	}
+
+	if course.Status == "archived" {
+		respondWithError("Course is archived", fmt.Errorf("course %s is read-only", course.ID))
+		return
+	}
+
+	// Pseudonyms derived without a secret could be computed by anyone who
+	// knows the IDs
+	if identitiesMasked(assignment) && os.Getenv("BLIND_GRADING_SECRET") == "" {
+		respondWithError("Blind grading is not configured", fmt.Errorf("BLIND_GRADING_SECRET is not set"))
+		return
+	}
+
+	// Assignments with a rubric are graded per criterion, and the grade is the
+	// share of the rubric's points the submission earned
+	criteria, err := rubricCriteria(db, assignment)
+	if err != nil {
+		respondWithError("Failed to get rubric", err)
+		return
+	}
+
+	if len(criteria) > 0 {
+		req.Grade, err = scoreRubric(criteria, req.RubricScores)
+		if err != nil {
+			respondWithError("Invalid rubric scores", err)
+			return
+		}
+	}
+
+	// Changing a grade needs a reason for the audit trail
+	if submission.GradedAt != "" && req.Reason == "" {
+		respondWithError("Reason is required", fmt.Errorf("submission %s is already graded", submission.ID))
+		return
+	}
+
+	// Apply the late penalty recorded when the work was submitted
+	grade := req.Grade
+	if submission.LatePenaltyPercent > 0 {
+		grade = req.Grade * (100 - submission.LatePenaltyPercent) / 100
+	}
+
 	// Update submission with grade and feedback
+	gradedAt := time.Now().Format(time.RFC3339)
 	result, err = db.UpdateDocument(
 		context.Background(),
 		"submissions",
 		req.SubmissionID,
 		map[string]interface{}{
-			"grade":    req.Grade,
+			"grade":    grade,
+			"rawGrade": req.Grade,
 			"feedback": req.Feedback,
+			"gradedAt": gradedAt,
 		},
 	)
 	if err != nil {
@@ -128,10 +283,262 @@ func main() {
 		return
 	}
 
+	// Record the change in the grade history
+	var oldGrade, oldRawGrade interface{}
+	if submission.GradedAt != "" {
+		oldGrade, oldRawGrade = submission.Grade, submission.RawGrade
+	}
+	_, err = db.CreateDocument(
+		context.Background(),
+		"grade_history",
+		"unique()",
+		map[string]interface{}{
+			"submissionId": submission.ID,
+			"assignmentId": submission.AssignmentID,
+			"studentId":    submission.StudentID,
+			"gradedBy":     req.UserID,
+			"changedAt":    gradedAt,
+			"oldGrade":     oldGrade,
+			"newGrade":     grade,
+			"oldRawGrade":  oldRawGrade,
+			"newRawGrade":  req.Grade,
+			"oldFeedback":  submission.Feedback,
+			"newFeedback":  req.Feedback,
+			"reason":       req.Reason,
+			"source":       "grade_assignment",
+			"tenantId":     submission.TenantID,
+		},
+	)
+	if err != nil {
+		respondWithError("Failed to record grade history", err)
+		return
+	}
+
+	// Store the rubric scores, replacing those of an earlier grading
+	if len(criteria) > 0 {
+		updatedSubmission.RubricScores, err = saveRubricScores(db, updatedSubmission, req.RubricScores, req.UserID)
+		if err != nil {
+			respondWithError("Failed to save rubric scores", err)
+			return
+		}
+	}
+
+	// Under "best" the highest graded attempt counts
+	if assignment.GradingRule == "best" {
+		if err := countBestAttempt(db, updatedSubmission); err != nil {
+			respondWithError("Failed to update counted attempt", err)
+			return
+		}
+	}
+
+	// Under blind grading the grader only sees the student's pseudonym
+	if identitiesMasked(assignment) {
+		updatedSubmission.StudentID = pseudonym(assignment.ID, updatedSubmission.StudentID)
+	}
+
 	// Return updated submission
 	respondWithSuccess("Submission graded successfully", updatedSubmission)
 }
 
+// identitiesMasked reports whether the assignment is blind graded and its
+// grades are not released yet
+func identitiesMasked(assignment Assignment) bool {
+	if !assignment.BlindGrading || assignment.GradesReleasedAt != "" {
+		return false
+	}
+	if assignment.GradeRelease == "scheduled" {
+		releaseDate, err := time.Parse(time.RFC3339, assignment.GradeReleaseDate)
+		return err != nil || time.Now().Before(releaseDate)
+	}
+	return assignment.GradeRelease == "manual"
+}
+
+// pseudonym returns the name a student goes by on a blind graded assignment.
+// It must match the backend's pseudonyms.
+func pseudonym(assignmentID, studentID string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("BLIND_GRADING_SECRET")))
+	mac.Write([]byte(assignmentID + ":" + studentID))
+	return "anon-" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// rubricCriteria returns the rubric of the assignment, if it has one
+func rubricCriteria(db *database.Client, assignment Assignment) ([]RubricCriterion, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"rubric_criteria",
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rubric criteria: %w", err)
+	}
+
+	var criteria []RubricCriterion
+	if err := json.Unmarshal([]byte(result.String()), &criteria); err != nil {
+		return nil, fmt.Errorf("failed to parse rubric criteria: %w", err)
+	}
+	return criteria, nil
+}
+
+// scoreRubric checks that every criterion was scored with one of its levels,
+// fills in the points of each score and returns the grade (0-100)
+func scoreRubric(criteria []RubricCriterion, scores []RubricScore) (int, error) {
+	byCriterion := make(map[string]*RubricScore)
+	for i := range scores {
+		byCriterion[scores[i].CriterionID] = &scores[i]
+	}
+
+	earned, possible := 0, 0
+	for _, criterion := range criteria {
+		max := 0
+		for _, points := range criterion.LevelPoints {
+			if points > max {
+				max = points
+			}
+		}
+		possible += max
+
+		score, ok := byCriterion[criterion.ID]
+		if !ok {
+			return 0, fmt.Errorf("criterion %q is not scored", criterion.Title)
+		}
+		if score.Level < 0 || score.Level >= len(criterion.LevelPoints) {
+			return 0, fmt.Errorf("criterion %q has no level %d", criterion.Title, score.Level)
+		}
+		score.Points = criterion.LevelPoints[score.Level]
+		earned += score.Points
+	}
+
+	if len(byCriterion) != len(criteria) {
+		return 0, fmt.Errorf("scores reference criteria that are not part of the rubric")
+	}
+	if possible == 0 {
+		return 0, fmt.Errorf("rubric is worth 0 points")
+	}
+
+	return int(math.Round(float64(earned) * 100 / float64(possible))), nil
+}
+
+// saveRubricScores stores the scores of a submission, updating the scores of
+// criteria that were graded before
+func saveRubricScores(db *database.Client, submission Submission, scores []RubricScore, graderID string) ([]RubricScore, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"rubric_scores",
+		[]interface{}{
+			query.Equal("submissionId", submission.ID),
+			query.Equal("tenantId", submission.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rubric scores: %w", err)
+	}
+
+	var existing []RubricScore
+	if err := json.Unmarshal([]byte(result.String()), &existing); err != nil {
+		return nil, fmt.Errorf("failed to parse rubric scores: %w", err)
+	}
+
+	existingIDs := make(map[string]string)
+	for _, score := range existing {
+		existingIDs[score.CriterionID] = score.ID
+	}
+
+	var saved []RubricScore
+	for _, score := range scores {
+		data := map[string]interface{}{
+			"submissionId": submission.ID,
+			"criterionId":  score.CriterionID,
+			"level":        score.Level,
+			"points":       score.Points,
+			"comment":      score.Comment,
+			"gradedBy":     graderID,
+			"tenantId":     submission.TenantID,
+		}
+
+		if id, ok := existingIDs[score.CriterionID]; ok {
+			result, err = db.UpdateDocument(context.Background(), "rubric_scores", id, data)
+		} else {
+			result, err = db.CreateDocument(context.Background(), "rubric_scores", "unique()", data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to save score for criterion %s: %w", score.CriterionID, err)
+		}
+
+		var savedScore RubricScore
+		if err := json.Unmarshal([]byte(result.String()), &savedScore); err != nil {
+			return nil, fmt.Errorf("failed to parse saved score: %w", err)
+		}
+		saved = append(saved, savedScore)
+	}
+	return saved, nil
+}
+
+// countBestAttempt marks the student's highest graded attempt as the one that
+// counts
+func countBestAttempt(db *database.Client, graded Submission) error {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"submissions",
+		[]interface{}{
+			query.Equal("assignmentId", graded.AssignmentID),
+			query.Equal("studentId", graded.StudentID),
+			query.Equal("tenantId", graded.TenantID),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get attempts: %w", err)
+	}
+
+	var attempts []Submission
+	if err := json.Unmarshal([]byte(result.String()), &attempts); err != nil {
+		return fmt.Errorf("failed to parse attempts: %w", err)
+	}
+
+	best := bestAttempt(attempts)
+	if best == nil {
+		return nil
+	}
+
+	for _, attempt := range attempts {
+		counted := attempt.ID == best.ID
+		if attempt.Counted == counted {
+			continue
+		}
+		_, err := db.UpdateDocument(
+			context.Background(),
+			"submissions",
+			attempt.ID,
+			map[string]interface{}{
+				"counted": counted,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update attempt %s: %w", attempt.ID, err)
+		}
+	}
+	return nil
+}
+
+// bestAttempt returns the highest graded attempt, or nil if none is graded.
+// Ties go to the earlier attempt.
+func bestAttempt(attempts []Submission) *Submission {
+	var best *Submission
+	for i := range attempts {
+		attempt := &attempts[i]
+		if attempt.Status == "draft" || attempt.GradedAt == "" {
+			continue
+		}
+		if best == nil || attempt.Grade > best.Grade ||
+			(attempt.Grade == best.Grade && attempt.Attempt < best.Attempt) {
+			best = attempt
+		}
+	}
+	return best
+}
+
 func respondWithSuccess(message string, data interface{}) {
 	response := Response{
 		Success: true,
@@ -0,0 +1,168 @@
+package main
+
+import "testing"
+
+func TestScoreRubric(t *testing.T) {
+	criteria := []RubricCriterion{
+		{ID: "code", Title: "Code", LevelPoints: []int{0, 5, 10}},
+		{ID: "docs", Title: "Docs", LevelPoints: []int{0, 2, 5}},
+	}
+
+	tests := []struct {
+		name       string
+		criteria   []RubricCriterion
+		scores     []RubricScore
+		want       int
+		wantPoints []int
+		wantErr    bool
+	}{
+		{
+			name:     "full marks",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 2},
+				{CriterionID: "docs", Level: 2},
+			},
+			want:       100,
+			wantPoints: []int{10, 5},
+		},
+		{
+			name:     "partial marks are rounded",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "docs", Level: 1},
+				{CriterionID: "code", Level: 1},
+			},
+			want:       47,
+			wantPoints: []int{2, 5},
+		},
+		{
+			name:     "no marks",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 0},
+				{CriterionID: "docs", Level: 0},
+			},
+			want:       0,
+			wantPoints: []int{0, 0},
+		},
+		{
+			name:     "missing criterion",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 2},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "level out of range",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 3},
+				{CriterionID: "docs", Level: 0},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "negative level",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: -1},
+				{CriterionID: "docs", Level: 0},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unknown criterion",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 2},
+				{CriterionID: "docs", Level: 2},
+				{CriterionID: "style", Level: 1},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "rubric worth nothing",
+			criteria: []RubricCriterion{{ID: "code", Title: "Code", LevelPoints: []int{0}}},
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 0},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scoreRubric(tt.criteria, tt.scores)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("scoreRubric = %d, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scoreRubric returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("scoreRubric = %d, want %d", got, tt.want)
+			}
+			for i, score := range tt.scores {
+				if score.Points != tt.wantPoints[i] {
+					t.Errorf("points of %s = %d, want %d", score.CriterionID, score.Points, tt.wantPoints[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBestAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []Submission
+		want     string
+	}{
+		{
+			name: "highest grade",
+			attempts: []Submission{
+				{ID: "a1", Attempt: 1, Grade: 70, GradedAt: "2026-05-01T10:00:00Z"},
+				{ID: "a2", Attempt: 2, Grade: 90, GradedAt: "2026-05-02T10:00:00Z"},
+			},
+			want: "a2",
+		},
+		{
+			name: "ties go to the earlier attempt",
+			attempts: []Submission{
+				{ID: "a2", Attempt: 2, Grade: 90, GradedAt: "2026-05-02T10:00:00Z"},
+				{ID: "a1", Attempt: 1, Grade: 90, GradedAt: "2026-05-01T10:00:00Z"},
+			},
+			want: "a1",
+		},
+		{
+			name: "drafts and ungraded attempts are skipped",
+			attempts: []Submission{
+				{ID: "a1", Attempt: 1, Grade: 40, GradedAt: "2026-05-01T10:00:00Z"},
+				{ID: "a2", Attempt: 2},
+				{ID: "draft", Status: "draft", Grade: 100, GradedAt: "2026-05-03T10:00:00Z"},
+			},
+			want: "a1",
+		},
+		{
+			name:     "nothing graded",
+			attempts: []Submission{{ID: "a1", Attempt: 1}},
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if best := bestAttempt(tt.attempts); best != nil {
+				got = best.ID
+			}
+			if got != tt.want {
+				t.Errorf("bestAttempt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
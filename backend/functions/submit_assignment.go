@@ -3,34 +3,146 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/appwrite/sdk-for-go"
 	"github.com/appwrite/sdk-for-go/database"
+	"github.com/appwrite/sdk-for-go/query"
 	"github.com/permitio/permit-golang/pkg/permit"
 )
 
 // Assignment represents an assignment in the LMS
+//
+// DueDate and AcceptUntil are RFC3339 instants; plain YYYY-MM-DD dates end at
+// 23:59:59 in the course's timezone. LatePolicy is one of "hard_close"
+// (default), "grace", "penalty" or "accept_until". GradingRule picks the
+// attempt that counts: "latest" (default), "best" or "first". Type is "quiz"
+// for quizzes, which are graded on submission, and "programming" for
+// assignments whose submissions are queued for the autograder.
 type Assignment struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	CourseID    string `json:"courseId"`
-	DueDate     string `json:"dueDate"`
+	ID                 string `json:"id"`
+	Title              string `json:"title"`
+	Description        string `json:"description"`
+	CourseID           string `json:"courseId"`
+	DueDate            string `json:"dueDate"`
+	TenantID           string `json:"tenantId"`
+	LatePolicy         string `json:"latePolicy"`
+	GraceMinutes       int    `json:"graceMinutes"`
+	LatePenaltyPercent int    `json:"latePenaltyPercent"` // Per started day late
+	AcceptUntil        string `json:"acceptUntil"`
+	MaxAttempts        int    `json:"maxAttempts"` // 0 means unlimited
+	GradingRule        string `json:"gradingRule"`
+	AutoSubmitDrafts   bool   `json:"autoSubmitDrafts"`
+	Type               string `json:"type"`
+	TimeLimitMinutes   int    `json:"timeLimitMinutes"` // Quiz time limit, 0 means none
+	GradeRelease       string `json:"gradeRelease"`     // immediate, manual or scheduled
+	GradeReleaseDate   string `json:"gradeReleaseDate"` // RFC3339
+	GradesReleasedAt   string `json:"gradesReleasedAt"`
 }
 
 // Submission represents a student's submission for an assignment
 type Submission struct {
+	ID                 string   `json:"id"`
+	AssignmentID       string   `json:"assignmentId"`
+	StudentID          string   `json:"studentId"`
+	Content            string   `json:"content"`
+	SubmittedAt        string   `json:"submittedAt"`
+	Grade              int      `json:"grade"`
+	RawGrade           int      `json:"rawGrade"`
+	Feedback           string   `json:"feedback"`
+	TenantID           string   `json:"tenantId"`
+	Late               bool     `json:"late"`
+	MinutesLate        int      `json:"minutesLate"`
+	LatePenaltyPercent int      `json:"latePenaltyPercent"` // Applied when graded
+	Attempt            int      `json:"attempt"`
+	Counted            bool     `json:"counted"` // Attempt used for the final grade
+	AttachmentIDs      []string `json:"attachmentIds"`
+	Status             string   `json:"status"` // draft or submitted
+	SavedAt            string   `json:"savedAt"`
+	StartedAt          string   `json:"startedAt"` // When a quiz attempt was started
+	GradedAt           string   `json:"gradedAt"`
+	AutogradeRunID     string   `json:"autogradeRunId"`
+	AutogradeStatus    string   `json:"autogradeStatus"`
+	GradeHidden        bool     `json:"gradeHidden,omitempty"` // Grades not released yet
+}
+
+// Course represents a course in the LMS
+type Course struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenantId"`
+	Status   string `json:"status"`
+	Timezone string `json:"timezone"`
+}
+
+// Section represents a cohort of a course
+type Section struct {
+	ID         string   `json:"id"`
+	CourseID   string   `json:"courseId"`
+	StudentIDs []string `json:"studentIds"`
+}
+
+// SectionDueDate overrides the due date of an assignment for one section
+type SectionDueDate struct {
+	SectionID    string `json:"sectionId"`
+	AssignmentID string `json:"assignmentId"`
+	DueDate      string `json:"dueDate"`
+}
+
+// Extension represents a per-student due date granted by an instructor
+type Extension struct {
+	AssignmentID string `json:"assignmentId"`
+	StudentID    string `json:"studentId"`
+	NewDueDate   string `json:"newDueDate"`
+}
+
+// QuizQuestion is one question of a quiz with its answers
+type QuizQuestion struct {
+	ID              string   `json:"id"`
+	Type            string   `json:"type"` // multiple_choice, multi_select, true_false, numeric or short_answer
+	CorrectChoices  []int    `json:"correctChoices"`
+	NumericAnswer   *float64 `json:"numericAnswer"`
+	Tolerance       float64  `json:"tolerance"`
+	AcceptedAnswers []string `json:"acceptedAnswers"`
+	Points          int      `json:"points"`
+}
+
+// Attachment is a file uploaded to the submissions bucket by a student
+type Attachment struct {
 	ID           string `json:"id"`
 	AssignmentID string `json:"assignmentId"`
 	StudentID    string `json:"studentId"`
-	Content      string `json:"content"`
-	SubmittedAt  string `json:"submittedAt"`
-	Grade        int    `json:"grade"`
-	Feedback     string `json:"feedback"`
+	TenantID     string `json:"tenantId"`
+}
+
+// Prerequisite is a condition a student must meet to unlock a module or an
+// assignment
+type Prerequisite struct {
+	TargetType string `json:"targetType"` // module or assignment
+	TargetID   string `json:"targetId"`
+	Type       string `json:"type"` // lesson_completed or min_score
+	ItemID     string `json:"itemId"`
+	MinScore   int    `json:"minScore"`
+}
+
+// Module is an ordered section of a course's content
+type Module struct {
+	ID          string `json:"id"`
+	PublishDate string `json:"publishDate"` // RFC3339, empty means published
+}
+
+// ModuleItem places a lesson or an assignment in a module
+type ModuleItem struct {
+	ModuleID    string `json:"moduleId"`
+	Type        string `json:"type"`
+	ItemID      string `json:"itemId"`
+	PublishDate string `json:"publishDate"` // RFC3339, empty means published
 }
 
 // Response is the standard response format for Appwrite functions
@@ -61,36 +173,29 @@ func main() {
 
 	// Parse request
 	var req struct {
-		UserID       string `json:"userId"`
-		UserRole     string `json:"userRole"`
-		AssignmentID string `json:"assignmentId"`
-		Content      string `json:"content"`
+		UserID        string   `json:"userId"`
+		UserRole      string   `json:"userRole"`
+		AssignmentID  string   `json:"assignmentId"`
+		Content       string   `json:"content"`
+		AttachmentIDs []string `json:"attachmentIds"`
+		TenantID      string   `json:"tenantId"`
 	}
 	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
 		respondWithError("Failed to parse request", err)
 		return
 	}
 
-	// Only students can submit assignments
-	if req.UserRole != "student" {
-		respondWithError("Only students can submit assignments", fmt.Errorf("user role is %s", req.UserRole))
-		return
+	// Requests without an organization act in the default tenant
+	if req.TenantID == "" {
+		req.TenantID = os.Getenv("DEFAULT_TENANT")
 	}
-
-	// Check if user can submit this assignment using Permit
-	allowed, err := permitClient.Check(
-		context.Background(),
-		req.UserID,                    // User ID
-		"submit",                      // Action
-		"assignment:"+req.AssignmentID, // Resource
-	)
-	if err != nil {
-		respondWithError("Failed to check permissions", err)
-		return
+	if req.TenantID == "" {
+		req.TenantID = "default"
 	}
 
-	if !allowed {
-		respondWithError("Permission denied", fmt.Errorf("user does not have permission to submit this assignment"))
+	// Only students can submit assignments
+	if req.UserRole != "student" {
+		respondWithError("Only students can submit assignments", fmt.Errorf("user role is %s", req.UserRole))
 		return
 	}
 
@@ -115,47 +220,284 @@ func main() {
 		return
 	}
 
-	// Check if assignment is past due date
-	dueDate, err := time.Parse("2006-01-02", assignment.DueDate)
+	// Assignments of other organizations are invisible to the user
+	if assignment.TenantID != req.TenantID {
+		respondWithError("Failed to get assignment", fmt.Errorf("assignment %s not found", req.AssignmentID))
+		return
+	}
+
+	// Archived courses are read-only
+	result, err = db.GetDocument(
+		context.Background(),
+		"courses",
+		assignment.CourseID,
+	)
+	if err != nil {
+		respondWithError("Failed to get course", err)
+		return
+	}
+
+	var course Course
+	if err := json.Unmarshal([]byte(result.String()), &course); err != nil {
+		respondWithError("Failed to parse course", err)
+		return
+	}
+
+	if course.Status == "archived" {
+		respondWithError("Course is archived", fmt.Errorf("course %s is read-only", course.ID))
+		return
+	}
+
+	// Unpublished assignments do not exist for students
+	published, err := assignmentPublished(db, assignment, time.Now())
+	if err != nil {
+		respondWithError("Failed to get module items", err)
+		return
+	}
+	if !published {
+		respondWithError("Failed to get assignment", fmt.Errorf("assignment %s not found", req.AssignmentID))
+		return
+	}
+
+	// Get the due date for the student: an extension wins over the due date
+	// of the student's section
+	dueDateValue, err := extensionDueDate(db, assignment, req.UserID)
+	if err != nil {
+		respondWithError("Failed to get extension", err)
+		return
+	}
+	if dueDateValue == "" {
+		dueDateValue, err = sectionDueDate(db, assignment, req.UserID)
+		if err != nil {
+			respondWithError("Failed to get section due date", err)
+			return
+		}
+	}
+
+	// Due dates without a time of day end at 23:59:59 in the course's timezone
+	loc := time.UTC
+	if course.Timezone != "" {
+		loc, err = time.LoadLocation(course.Timezone)
+		if err != nil {
+			respondWithError("Failed to load course timezone", err)
+			return
+		}
+	}
+
+	dueDate, err := parseDeadline(dueDateValue, loc)
 	if err != nil {
 		respondWithError("Failed to parse due date", err)
 		return
 	}
 
-	if time.Now().After(dueDate) {
-		respondWithError("Assignment is past due date", fmt.Errorf("due date was %s", assignment.DueDate))
+	deadline, err := submissionDeadline(assignment, dueDate, loc)
+	if err != nil {
+		respondWithError("Failed to parse late policy", err)
 		return
 	}
 
-	// Create submission
-	submission := Submission{
-		AssignmentID: req.AssignmentID,
-		StudentID:    req.UserID,
-		Content:      req.Content,
-		SubmittedAt:  time.Now().Format(time.RFC3339),
-		Grade:        0,
-		Feedback:     "",
+	// Assignments stay locked until the student meets their prerequisites
+	locked, err := assignmentLocked(db, course, assignment, req.UserID, time.Now())
+	if err != nil {
+		respondWithError("Failed to evaluate prerequisites", err)
+		return
 	}
 
-	// Create submission in Appwrite
-	result, err = db.CreateDocument(
+	// Check if user can submit this assignment using Permit. The due date and
+	// deadline that apply to this student are passed so the policy condition
+	// compares the same instants as the check below.
+	allowed, err := permitClient.Check(
 		context.Background(),
-		"submissions",
-		"unique()",
-		map[string]interface{}{
-			"assignmentId": submission.AssignmentID,
-			"studentId":    submission.StudentID,
-			"content":      submission.Content,
-			"submittedAt":  submission.SubmittedAt,
-			"grade":        submission.Grade,
-			"feedback":     submission.Feedback,
-		},
+		req.UserID,                    // User ID
+		"submit",                      // Action
+		"assignment:"+req.AssignmentID, // Resource
+		permit.WithTenant(req.TenantID),
+		permit.WithAttributes(map[string]interface{}{
+			"courseId":           assignment.CourseID,
+			"dueDate":            dueDate.UTC().Format(time.RFC3339),
+			"submissionDeadline": deadline.UTC().Format(time.RFC3339),
+			"locked":             locked,
+		}),
 	)
+	if err != nil {
+		respondWithError("Failed to check permissions", err)
+		return
+	}
+
+	if !allowed {
+		respondWithError("Permission denied", fmt.Errorf("user does not have permission to submit this assignment"))
+		return
+	}
+
+	// Apply the assignment's late policy
+	now := time.Now()
+	minutesLate, penalty, err := applyLatePolicy(assignment, dueDate, deadline, now)
+	if err != nil {
+		respondWithError("Assignment is past due date", err)
+		return
+	}
+
+	// Number the attempt and enforce the attempt limit
+	attempts, draft, err := previousAttempts(db, assignment, req.UserID)
+	if err != nil {
+		respondWithError("Failed to get previous attempts", err)
+		return
+	}
+
+	if assignment.MaxAttempts > 0 && len(attempts) >= assignment.MaxAttempts {
+		respondWithError("No attempts left", fmt.Errorf("assignment allows %d attempts", assignment.MaxAttempts))
+		return
+	}
+
+	// Quizzes are answered in the attempt started with the quiz. Once its time
+	// limit has passed, only the answers saved in time are submitted.
+	if assignment.Type == "quiz" {
+		if draft == nil || draft.StartedAt == "" {
+			respondWithError("Quiz was not started", fmt.Errorf("start quiz %s before submitting", assignment.ID))
+			return
+		}
+		if quizTimedOut(assignment, *draft, now) {
+			req.Content = draft.Content
+		}
+		req.AttachmentIDs = nil
+	}
+
+	// Submitting without content turns the saved draft into the submission
+	if draft != nil && req.Content == "" && len(req.AttachmentIDs) == 0 {
+		req.Content = draft.Content
+		req.AttachmentIDs = draft.AttachmentIDs
+	}
+
+	// Attachments must have been uploaded by the student for this assignment
+	for _, attachmentID := range req.AttachmentIDs {
+		if err := checkAttachment(db, attachmentID, assignment, req.UserID); err != nil {
+			respondWithError("Invalid attachment", err)
+			return
+		}
+	}
+
+	// Quizzes are graded right away
+	rawGrade := -1
+	if assignment.Type == "quiz" {
+		questions, err := quizQuestions(db, assignment)
+		if err != nil {
+			respondWithError("Failed to get quiz questions", err)
+			return
+		}
+		rawGrade, err = scoreQuiz(questions, req.Content)
+		if err != nil {
+			respondWithError("Invalid quiz answers", err)
+			return
+		}
+	}
+	grade := 0
+	if rawGrade >= 0 {
+		grade = rawGrade * (100 - penalty) / 100
+	}
+
+	// Create submission
+	submission := Submission{
+		AssignmentID:       req.AssignmentID,
+		StudentID:          req.UserID,
+		Content:            req.Content,
+		SubmittedAt:        now.Format(time.RFC3339),
+		Grade:              grade,
+		Feedback:           "",
+		TenantID:           assignment.TenantID,
+		Late:               minutesLate > 0,
+		MinutesLate:        minutesLate,
+		LatePenaltyPercent: penalty,
+		Attempt:            len(attempts) + 1,
+		Counted:            attemptCounted(assignment, attempts, rawGrade, grade),
+		AttachmentIDs:      req.AttachmentIDs,
+		Status:             "submitted",
+	}
+
+	data := map[string]interface{}{
+		"assignmentId":       submission.AssignmentID,
+		"studentId":          submission.StudentID,
+		"content":            submission.Content,
+		"submittedAt":        submission.SubmittedAt,
+		"grade":              submission.Grade,
+		"feedback":           submission.Feedback,
+		"tenantId":           submission.TenantID,
+		"late":               submission.Late,
+		"minutesLate":        submission.MinutesLate,
+		"latePenaltyPercent": submission.LatePenaltyPercent,
+		"attempt":            submission.Attempt,
+		"counted":            submission.Counted,
+		"attachmentIds":      submission.AttachmentIDs,
+		"status":             submission.Status,
+	}
+	if rawGrade >= 0 {
+		data["rawGrade"] = rawGrade
+		data["gradedAt"] = submission.SubmittedAt
+	}
+
+	// Create submission in Appwrite, reusing the draft document if there is one.
+	// The unique index on assignmentId, studentId and attempt rejects a
+	// concurrent submission that took the same attempt number, in which case
+	// the attempts are counted again and the submission renumbered.
+	for retries := 0; ; retries++ {
+		if draft != nil {
+			result, err = db.UpdateDocument(
+				context.Background(),
+				"submissions",
+				draft.ID,
+				data,
+			)
+		} else {
+			result, err = db.CreateDocument(
+				context.Background(),
+				"submissions",
+				"unique()",
+				data,
+			)
+		}
+		if err == nil || !isConflict(err) || retries == maxAttemptRetries {
+			break
+		}
+
+		attempts, draft, err = previousAttempts(db, assignment, req.UserID)
+		if err != nil {
+			respondWithError("Failed to get previous attempts", err)
+			return
+		}
+		if assignment.MaxAttempts > 0 && len(attempts) >= assignment.MaxAttempts {
+			respondWithError("No attempts left", fmt.Errorf("assignment allows %d attempts", assignment.MaxAttempts))
+			return
+		}
+		submission.Attempt = len(attempts) + 1
+		submission.Counted = attemptCounted(assignment, attempts, rawGrade, grade)
+		data["attempt"] = submission.Attempt
+		data["counted"] = submission.Counted
+	}
 	if err != nil {
 		respondWithError("Failed to create submission", err)
 		return
 	}
 
+	// Only one attempt counts at a time
+	if submission.Counted {
+		for _, attempt := range attempts {
+			if !attempt.Counted {
+				continue
+			}
+			_, err = db.UpdateDocument(
+				context.Background(),
+				"submissions",
+				attempt.ID,
+				map[string]interface{}{
+					"counted": false,
+				},
+			)
+			if err != nil {
+				respondWithError("Failed to update previous attempt", err)
+				return
+			}
+		}
+	}
+
 	// Parse created submission
 	var createdSubmission Submission
 	if err := json.Unmarshal([]byte(result.String()), &createdSubmission); err != nil {
@@ -163,10 +505,710 @@ func main() {
 		return
 	}
 
+	// Record the automatic grade in the grade history
+	if rawGrade >= 0 {
+		_, err = db.CreateDocument(
+			context.Background(),
+			"grade_history",
+			"unique()",
+			map[string]interface{}{
+				"submissionId": createdSubmission.ID,
+				"assignmentId": assignment.ID,
+				"studentId":    req.UserID,
+				"gradedBy":     "",
+				"changedAt":    submission.SubmittedAt,
+				"oldGrade":     nil,
+				"newGrade":     grade,
+				"oldRawGrade":  nil,
+				"newRawGrade":  rawGrade,
+				"oldFeedback":  "",
+				"newFeedback":  "",
+				"reason":       "Graded automatically",
+				"source":       "quiz",
+				"tenantId":     assignment.TenantID,
+			},
+		)
+		if err != nil {
+			respondWithError("Failed to record grade history", err)
+			return
+		}
+	}
+
+	// Programming assignments are graded by running the test suite
+	if assignment.Type == "programming" {
+		createdSubmission.AutogradeRunID, err = queueAutograde(db, createdSubmission)
+		if err != nil {
+			respondWithError("Failed to queue submission for autograding", err)
+			return
+		}
+		createdSubmission.AutogradeStatus = "queued"
+	}
+
+	// Quiz grades follow the assignment's release policy like any other grade
+	if rawGrade >= 0 && !gradesReleased(assignment, now) {
+		createdSubmission.Grade = 0
+		createdSubmission.RawGrade = 0
+		createdSubmission.Feedback = ""
+		createdSubmission.GradedAt = ""
+		createdSubmission.GradeHidden = true
+	}
+
 	// Return created submission
 	respondWithSuccess("Submission created successfully", createdSubmission)
 }
 
+// queueAutograde adds a run of the assignment's test suite against the
+// submission to the autograder's queue, which the backend works through
+func queueAutograde(db *database.Client, submission Submission) (string, error) {
+	result, err := db.CreateDocument(
+		context.Background(),
+		"autograde_runs",
+		"unique()",
+		map[string]interface{}{
+			"submissionId": submission.ID,
+			"assignmentId": submission.AssignmentID,
+			"studentId":    submission.StudentID,
+			"status":       "queued",
+			"queuedAt":     time.Now().Format(time.RFC3339),
+			"tenantId":     submission.TenantID,
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to queue autograde run: %w", err)
+	}
+
+	var run struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(result.String()), &run); err != nil {
+		return "", fmt.Errorf("failed to parse autograde run: %w", err)
+	}
+
+	_, err = db.UpdateDocument(
+		context.Background(),
+		"submissions",
+		submission.ID,
+		map[string]interface{}{
+			"autogradeRunId":  run.ID,
+			"autogradeStatus": "queued",
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to update autograde status: %w", err)
+	}
+	return run.ID, nil
+}
+
+// assignmentPublished reports whether students can see the assignment. It
+// must match the backend: assignments outside every module are published,
+// and those in modules once one of their items and its module are.
+func assignmentPublished(db *database.Client, assignment Assignment, now time.Time) (bool, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"module_items",
+		[]interface{}{
+			query.Equal("type", "assignment"),
+			query.Equal("itemId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to get module items: %w", err)
+	}
+
+	var items []ModuleItem
+	if err := json.Unmarshal([]byte(result.String()), &items); err != nil {
+		return false, fmt.Errorf("failed to parse module items: %w", err)
+	}
+	if len(items) == 0 {
+		return true, nil
+	}
+
+	for _, item := range items {
+		if !isPublished(item.PublishDate, now) {
+			continue
+		}
+		result, err := db.GetDocument(
+			context.Background(),
+			"modules",
+			item.ModuleID,
+		)
+		if err != nil {
+			return false, fmt.Errorf("failed to get module %s: %w", item.ModuleID, err)
+		}
+		var module Module
+		if err := json.Unmarshal([]byte(result.String()), &module); err != nil {
+			return false, fmt.Errorf("failed to parse module %s: %w", item.ModuleID, err)
+		}
+		if isPublished(module.PublishDate, now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isPublished reports whether content with the publish date is published at
+// the given time
+func isPublished(publishDate string, now time.Time) bool {
+	if publishDate == "" {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, publishDate)
+	return err == nil && !now.Before(t)
+}
+
+// assignmentLocked reports whether the student has yet to meet the
+// prerequisites of the assignment or of the module it is in
+func assignmentLocked(db *database.Client, course Course, assignment Assignment, studentID string, now time.Time) (bool, error) {
+	progress, err := loadProgress(db, course, studentID, now)
+	if err != nil {
+		return false, err
+	}
+	return progress.locked("assignment", assignment.ID), nil
+}
+
+// contentProgress is what a student has done in a course, to evaluate the
+// course's prerequisites the same way as the backend
+type contentProgress struct {
+	prerequisites []Prerequisite
+	moduleOf      map[string]string // Module ID by assignment ID
+	completed     map[string]bool   // Completed lesson IDs
+	scores        map[string]int    // Released grades by assignment ID
+}
+
+// met reports whether the student meets a prerequisite
+func (p *contentProgress) met(prerequisite Prerequisite) bool {
+	switch prerequisite.Type {
+	case "lesson_completed":
+		return p.completed[prerequisite.ItemID]
+	case "min_score":
+		score, ok := p.scores[prerequisite.ItemID]
+		return ok && score >= prerequisite.MinScore
+	default:
+		return false
+	}
+}
+
+// locked reports whether a module or assignment is locked for the student.
+// Assignments are also locked by the prerequisites of their module.
+func (p *contentProgress) locked(targetType, targetID string) bool {
+	for _, prerequisite := range p.prerequisites {
+		if prerequisite.TargetType == targetType && prerequisite.TargetID == targetID && !p.met(prerequisite) {
+			return true
+		}
+	}
+	if moduleID, ok := p.moduleOf[targetID]; ok && targetType == "assignment" {
+		return p.locked("module", moduleID)
+	}
+	return false
+}
+
+// loadProgress loads what a student has done in a course. Scores are the
+// counted attempts at the course's assignments, and count only once the
+// assignment's grades are released.
+func loadProgress(db *database.Client, course Course, studentID string, now time.Time) (*contentProgress, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"prerequisites",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prerequisites: %w", err)
+	}
+
+	progress := &contentProgress{
+		moduleOf:  make(map[string]string),
+		completed: make(map[string]bool),
+		scores:    make(map[string]int),
+	}
+	if err := json.Unmarshal([]byte(result.String()), &progress.prerequisites); err != nil {
+		return nil, fmt.Errorf("failed to parse prerequisites: %w", err)
+	}
+	if len(progress.prerequisites) == 0 {
+		return progress, nil
+	}
+
+	items, err := courseModuleItems(db, course)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Type == "assignment" {
+			progress.moduleOf[item.ItemID] = item.ModuleID
+		}
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"lesson_completions",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lesson completions: %w", err)
+	}
+
+	var completions []struct {
+		LessonID string `json:"lessonId"`
+	}
+	if err := json.Unmarshal([]byte(result.String()), &completions); err != nil {
+		return nil, fmt.Errorf("failed to parse lesson completions: %w", err)
+	}
+	for _, completion := range completions {
+		progress.completed[completion.LessonID] = true
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"assignments",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignments: %w", err)
+	}
+
+	var assignments []Assignment
+	if err := json.Unmarshal([]byte(result.String()), &assignments); err != nil {
+		return nil, fmt.Errorf("failed to parse assignments: %w", err)
+	}
+	if len(assignments) == 0 {
+		return progress, nil
+	}
+	byID := make(map[string]Assignment)
+	var assignmentIDs []string
+	for _, assignment := range assignments {
+		byID[assignment.ID] = assignment
+		assignmentIDs = append(assignmentIDs, assignment.ID)
+	}
+
+	result, err = db.ListDocuments(
+		context.Background(),
+		"submissions",
+		[]interface{}{
+			query.Equal("assignmentId", assignmentIDs),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", course.TenantID),
+			query.Equal("counted", true),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submissions: %w", err)
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(result.String()), &submissions); err != nil {
+		return nil, fmt.Errorf("failed to parse submissions: %w", err)
+	}
+	for _, submission := range submissions {
+		if submission.Status == "draft" || submission.GradedAt == "" {
+			continue
+		}
+		if gradesReleased(byID[submission.AssignmentID], now) {
+			progress.scores[submission.AssignmentID] = submission.Grade
+		}
+	}
+	return progress, nil
+}
+
+// courseModuleItems returns the items of all modules of the course
+func courseModuleItems(db *database.Client, course Course) ([]ModuleItem, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"module_items",
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module items: %w", err)
+	}
+
+	var items []ModuleItem
+	if err := json.Unmarshal([]byte(result.String()), &items); err != nil {
+		return nil, fmt.Errorf("failed to parse module items: %w", err)
+	}
+	return items, nil
+}
+
+// gradesReleased reports whether students may see their grades for the
+// assignment. Scheduled release dates are stored as RFC3339 instants.
+func gradesReleased(assignment Assignment, now time.Time) bool {
+	switch assignment.GradeRelease {
+	case "manual":
+		return assignment.GradesReleasedAt != ""
+	case "scheduled":
+		if assignment.GradesReleasedAt != "" {
+			return true
+		}
+		releaseDate, err := time.Parse(time.RFC3339, assignment.GradeReleaseDate)
+		return err == nil && !now.Before(releaseDate)
+	default:
+		return true
+	}
+}
+
+// parseDeadline parses an RFC3339 instant, or a YYYY-MM-DD date as the last
+// second of that day in loc
+func parseDeadline(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q: expected RFC3339 timestamp or YYYY-MM-DD date", value)
+	}
+	// Adding 24 hours to midnight would be off by an hour on DST changes
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 23, 59, 59, 0, loc), nil
+}
+
+// submissionDeadline returns the last moment the assignment's late policy
+// accepts submissions
+func submissionDeadline(assignment Assignment, dueDate time.Time, loc *time.Location) (time.Time, error) {
+	switch assignment.LatePolicy {
+	case "grace":
+		return dueDate.Add(time.Duration(assignment.GraceMinutes) * time.Minute), nil
+
+	case "penalty", "accept_until":
+		if assignment.AcceptUntil == "" {
+			if assignment.LatePolicy == "penalty" {
+				// Late work is accepted indefinitely
+				return time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), nil
+			}
+			return dueDate, nil
+		}
+		return parseDeadline(assignment.AcceptUntil, loc)
+
+	default:
+		// Hard close at the due date
+		return dueDate, nil
+	}
+}
+
+// applyLatePolicy checks a submission made at submittedAt against the
+// assignment's late policy. It returns how many minutes late the submission is
+// and the grade penalty in percent, or an error if it is no longer accepted.
+func applyLatePolicy(assignment Assignment, dueDate, deadline, submittedAt time.Time) (int, int, error) {
+	if !submittedAt.After(dueDate) {
+		return 0, 0, nil
+	}
+
+	if submittedAt.After(deadline) {
+		if deadline.Equal(dueDate) {
+			return 0, 0, fmt.Errorf("due date was %s", dueDate.Format(time.RFC3339))
+		}
+		return 0, 0, fmt.Errorf("late submissions were accepted until %s", deadline.Format(time.RFC3339))
+	}
+
+	minutesLate := int(math.Ceil(submittedAt.Sub(dueDate).Minutes()))
+
+	penalty := 0
+	if assignment.LatePolicy == "penalty" {
+		daysLate := int(math.Ceil(float64(minutesLate) / (24 * 60)))
+		penalty = daysLate * assignment.LatePenaltyPercent
+		if penalty > 100 {
+			penalty = 100
+		}
+	}
+
+	return minutesLate, penalty, nil
+}
+
+// checkAttachment returns an error unless the attachment was uploaded by the
+// student for the assignment
+func checkAttachment(db *database.Client, attachmentID string, assignment Assignment, studentID string) error {
+	result, err := db.GetDocument(
+		context.Background(),
+		"attachments",
+		attachmentID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get attachment %s: %w", attachmentID, err)
+	}
+
+	var attachment Attachment
+	if err := json.Unmarshal([]byte(result.String()), &attachment); err != nil {
+		return fmt.Errorf("failed to parse attachment %s: %w", attachmentID, err)
+	}
+
+	if attachment.TenantID != assignment.TenantID ||
+		attachment.AssignmentID != assignment.ID ||
+		attachment.StudentID != studentID {
+		return fmt.Errorf("attachment %s does not belong to this assignment", attachmentID)
+	}
+	return nil
+}
+
+// attemptCounted reports whether a new attempt counts for the final grade.
+// Under "latest" every new attempt replaces the counted one. Under "first"
+// and "best" the first attempt counts until grading picks a better one. A
+// graded quiz attempt counts under "best" when it beats the counted one.
+func attemptCounted(assignment Assignment, attempts []Submission, rawGrade, grade int) bool {
+	if rawGrade >= 0 && assignment.GradingRule == "best" {
+		for _, attempt := range attempts {
+			if attempt.Counted && attempt.GradedAt != "" && attempt.Grade >= grade {
+				return false
+			}
+		}
+		return true
+	}
+	return len(attempts) == 0 || assignment.GradingRule == "" || assignment.GradingRule == "latest"
+}
+
+// maxAttemptRetries is how often a submission is renumbered after losing a
+// race for its attempt number
+const maxAttemptRetries = 3
+
+// isConflict reports whether Appwrite rejected a write because it violates
+// a unique index
+func isConflict(err error) bool {
+	var appwriteErr interface{ GetStatusCode() int }
+	return errors.As(err, &appwriteErr) && appwriteErr.GetStatusCode() == http.StatusConflict
+}
+
+// previousAttempts returns the student's earlier submissions for the
+// assignment, and the student's draft if one is saved
+func previousAttempts(db *database.Client, assignment Assignment, studentID string) ([]Submission, *Submission, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"submissions",
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get submissions: %w", err)
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(result.String()), &submissions); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse submissions: %w", err)
+	}
+
+	var attempts []Submission
+	var draft *Submission
+	for i := range submissions {
+		if submissions[i].Status == "draft" {
+			draft = &submissions[i]
+			continue
+		}
+		attempts = append(attempts, submissions[i])
+	}
+	return attempts, draft, nil
+}
+
+// quizTimedOut reports whether the time limit of a started quiz has passed,
+// allowing a minute for network delays
+func quizTimedOut(assignment Assignment, draft Submission, now time.Time) bool {
+	if assignment.TimeLimitMinutes == 0 {
+		return false
+	}
+	startedAt, err := time.Parse(time.RFC3339, draft.StartedAt)
+	if err != nil {
+		return false
+	}
+	limit := time.Duration(assignment.TimeLimitMinutes)*time.Minute + time.Minute
+	return now.After(startedAt.Add(limit))
+}
+
+// quizQuestions returns the questions of a quiz
+func quizQuestions(db *database.Client, assignment Assignment) ([]QuizQuestion, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"quiz_questions",
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quiz questions: %w", err)
+	}
+
+	var questions []QuizQuestion
+	if err := json.Unmarshal([]byte(result.String()), &questions); err != nil {
+		return nil, fmt.Errorf("failed to parse quiz questions: %w", err)
+	}
+	return questions, nil
+}
+
+// scoreQuiz grades quiz answers, a JSON object from question ID to answer.
+// The grade is the share of the quiz's points earned, scaled to 0-100.
+// Unanswered questions earn nothing.
+func scoreQuiz(questions []QuizQuestion, content string) (int, error) {
+	answers := make(map[string]json.RawMessage)
+	if content != "" {
+		if err := json.Unmarshal([]byte(content), &answers); err != nil {
+			return 0, fmt.Errorf("answers must be a JSON object: %w", err)
+		}
+	}
+
+	earned, possible := 0, 0
+	for _, question := range questions {
+		possible += question.Points
+		if answer, ok := answers[question.ID]; ok && answerCorrect(question, answer) {
+			earned += question.Points
+		}
+	}
+	if possible == 0 {
+		return 0, fmt.Errorf("quiz is worth 0 points")
+	}
+
+	return int(math.Round(float64(earned) * 100 / float64(possible))), nil
+}
+
+// answerCorrect reports whether an answer to a question is right. Answers of
+// the wrong JSON type are wrong.
+func answerCorrect(question QuizQuestion, answer json.RawMessage) bool {
+	switch question.Type {
+	case "multiple_choice", "true_false":
+		var choice int
+		if err := json.Unmarshal(answer, &choice); err != nil {
+			return false
+		}
+		return len(question.CorrectChoices) == 1 && choice == question.CorrectChoices[0]
+
+	case "multi_select":
+		var choices []int
+		if err := json.Unmarshal(answer, &choices); err != nil {
+			return false
+		}
+		picked := make(map[int]bool)
+		for _, choice := range choices {
+			picked[choice] = true
+		}
+		if len(picked) != len(question.CorrectChoices) {
+			return false
+		}
+		for _, choice := range question.CorrectChoices {
+			if !picked[choice] {
+				return false
+			}
+		}
+		return true
+
+	case "numeric":
+		var value float64
+		if err := json.Unmarshal(answer, &value); err != nil || question.NumericAnswer == nil {
+			return false
+		}
+		return math.Abs(value-*question.NumericAnswer) <= question.Tolerance
+
+	case "short_answer":
+		var text string
+		if err := json.Unmarshal(answer, &text); err != nil {
+			return false
+		}
+		for _, accepted := range question.AcceptedAnswers {
+			if normalizeAnswer(text) == normalizeAnswer(accepted) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// normalizeAnswer ignores case and extra spaces in short answers
+func normalizeAnswer(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// extensionDueDate returns the due date of the extension granted to the
+// student for the assignment, or an empty string if there is none.
+func extensionDueDate(db *database.Client, assignment Assignment, studentID string) (string, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"extensions",
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", studentID),
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get extensions: %w", err)
+	}
+
+	var extensions []Extension
+	if err := json.Unmarshal([]byte(result.String()), &extensions); err != nil {
+		return "", fmt.Errorf("failed to parse extensions: %w", err)
+	}
+	if len(extensions) == 0 {
+		return "", nil
+	}
+	return extensions[0].NewDueDate, nil
+}
+
+// sectionDueDate returns the due date of the assignment for the section the
+// student is enrolled in, falling back to the assignment's own due date.
+func sectionDueDate(db *database.Client, assignment Assignment, studentID string) (string, error) {
+	result, err := db.ListDocuments(
+		context.Background(),
+		"sections",
+		[]interface{}{
+			query.Equal("courseId", assignment.CourseID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get sections: %w", err)
+	}
+
+	var sections []Section
+	if err := json.Unmarshal([]byte(result.String()), &sections); err != nil {
+		return "", fmt.Errorf("failed to parse sections: %w", err)
+	}
+
+	for _, section := range sections {
+		enrolled := false
+		for _, id := range section.StudentIDs {
+			if id == studentID {
+				enrolled = true
+				break
+			}
+		}
+		if !enrolled {
+			continue
+		}
+
+		result, err := db.ListDocuments(
+			context.Background(),
+			"section_due_dates",
+			[]interface{}{
+				query.Equal("sectionId", section.ID),
+				query.Equal("assignmentId", assignment.ID),
+			},
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to get due date overrides: %w", err)
+		}
+
+		var overrides []SectionDueDate
+		if err := json.Unmarshal([]byte(result.String()), &overrides); err != nil {
+			return "", fmt.Errorf("failed to parse due date overrides: %w", err)
+		}
+		if len(overrides) > 0 {
+			return overrides[0].DueDate, nil
+		}
+		break
+	}
+
+	return assignment.DueDate, nil
+}
+
 func respondWithSuccess(message string, data interface{}) {
 	response := Response{
 		Success: true,
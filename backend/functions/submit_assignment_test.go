@@ -0,0 +1,319 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
+
+func TestAnswerCorrect(t *testing.T) {
+	tests := []struct {
+		name     string
+		question QuizQuestion
+		answer   string
+		want     bool
+	}{
+		{
+			name:     "multiple choice",
+			question: QuizQuestion{Type: "multiple_choice", CorrectChoices: []int{2}},
+			answer:   `2`,
+			want:     true,
+		},
+		{
+			name:     "wrong multiple choice",
+			question: QuizQuestion{Type: "multiple_choice", CorrectChoices: []int{2}},
+			answer:   `1`,
+			want:     false,
+		},
+		{
+			name:     "true or false of the wrong type",
+			question: QuizQuestion{Type: "true_false", CorrectChoices: []int{0}},
+			answer:   `"0"`,
+			want:     false,
+		},
+		{
+			name:     "multi select in another order with repeats",
+			question: QuizQuestion{Type: "multi_select", CorrectChoices: []int{0, 3}},
+			answer:   `[3, 0, 3]`,
+			want:     true,
+		},
+		{
+			name:     "multi select missing a choice",
+			question: QuizQuestion{Type: "multi_select", CorrectChoices: []int{0, 3}},
+			answer:   `[0]`,
+			want:     false,
+		},
+		{
+			name:     "multi select with an extra choice",
+			question: QuizQuestion{Type: "multi_select", CorrectChoices: []int{0, 3}},
+			answer:   `[0, 1, 3]`,
+			want:     false,
+		},
+		{
+			name:     "numeric within the tolerance",
+			question: QuizQuestion{Type: "numeric", NumericAnswer: float64Ptr(3.14), Tolerance: 0.01},
+			answer:   `3.15`,
+			want:     true,
+		},
+		{
+			name:     "numeric outside the tolerance",
+			question: QuizQuestion{Type: "numeric", NumericAnswer: float64Ptr(3.14), Tolerance: 0.01},
+			answer:   `3.2`,
+			want:     false,
+		},
+		{
+			name:     "numeric without an answer key",
+			question: QuizQuestion{Type: "numeric"},
+			answer:   `0`,
+			want:     false,
+		},
+		{
+			name:     "short answer ignores case and spaces",
+			question: QuizQuestion{Type: "short_answer", AcceptedAnswers: []string{"Ada Lovelace"}},
+			answer:   `"  ada   LOVELACE "`,
+			want:     true,
+		},
+		{
+			name:     "short answer not accepted",
+			question: QuizQuestion{Type: "short_answer", AcceptedAnswers: []string{"Ada Lovelace"}},
+			answer:   `"Lovelace"`,
+			want:     false,
+		},
+		{
+			name:     "unknown question type",
+			question: QuizQuestion{Type: "essay"},
+			answer:   `"anything"`,
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := answerCorrect(tt.question, json.RawMessage(tt.answer)); got != tt.want {
+				t.Errorf("answerCorrect(%s) = %v, want %v", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreQuiz(t *testing.T) {
+	questions := []QuizQuestion{
+		{ID: "q1", Type: "multiple_choice", CorrectChoices: []int{1}, Points: 1},
+		{ID: "q2", Type: "true_false", CorrectChoices: []int{0}, Points: 1},
+		{ID: "q3", Type: "short_answer", AcceptedAnswers: []string{"Go"}, Points: 1},
+	}
+
+	tests := []struct {
+		name      string
+		questions []QuizQuestion
+		content   string
+		want      int
+		wantErr   bool
+	}{
+		{
+			name:      "all answers right",
+			questions: questions,
+			content:   `{"q1": 1, "q2": 0, "q3": "go"}`,
+			want:      100,
+		},
+		{
+			name:      "partial scores are rounded",
+			questions: questions,
+			content:   `{"q1": 1, "q2": 1, "q3": "go"}`,
+			want:      67,
+		},
+		{
+			name:      "unanswered questions earn nothing",
+			questions: questions,
+			content:   `{"q1": 1}`,
+			want:      33,
+		},
+		{
+			name:      "no answers",
+			questions: questions,
+			want:      0,
+		},
+		{
+			name: "points weigh the questions",
+			questions: []QuizQuestion{
+				{ID: "q1", Type: "multiple_choice", CorrectChoices: []int{1}, Points: 3},
+				{ID: "q2", Type: "multiple_choice", CorrectChoices: []int{1}, Points: 1},
+			},
+			content: `{"q1": 0, "q2": 1}`,
+			want:    25,
+		},
+		{
+			name:      "answers that are not an object",
+			questions: questions,
+			content:   `[1, 0, "go"]`,
+			wantErr:   true,
+		},
+		{
+			name:      "quiz worth no points",
+			questions: []QuizQuestion{{ID: "q1", Type: "multiple_choice", CorrectChoices: []int{1}}},
+			content:   `{"q1": 1}`,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scoreQuiz(tt.questions, tt.content)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("scoreQuiz = %d, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scoreQuiz returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("scoreQuiz = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuizTimedOut(t *testing.T) {
+	draft := Submission{StartedAt: "2026-05-10T12:00:00Z"}
+	started := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		assignment Assignment
+		draft      Submission
+		now        time.Time
+		want       bool
+	}{
+		{
+			name:       "no time limit",
+			assignment: Assignment{},
+			draft:      draft,
+			now:        started.Add(24 * time.Hour),
+			want:       false,
+		},
+		{
+			name:       "within the limit",
+			assignment: Assignment{TimeLimitMinutes: 30},
+			draft:      draft,
+			now:        started.Add(30 * time.Minute),
+			want:       false,
+		},
+		{
+			name:       "within the minute allowed for delays",
+			assignment: Assignment{TimeLimitMinutes: 30},
+			draft:      draft,
+			now:        started.Add(31 * time.Minute),
+			want:       false,
+		},
+		{
+			name:       "past the limit",
+			assignment: Assignment{TimeLimitMinutes: 30},
+			draft:      draft,
+			now:        started.Add(31*time.Minute + time.Second),
+			want:       true,
+		},
+		{
+			name:       "quiz not started",
+			assignment: Assignment{TimeLimitMinutes: 30},
+			draft:      Submission{},
+			now:        started.Add(24 * time.Hour),
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quizTimedOut(tt.assignment, tt.draft, tt.now); got != tt.want {
+				t.Errorf("quizTimedOut = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttemptCounted(t *testing.T) {
+	first := Submission{Attempt: 1, Counted: true}
+	graded := Submission{Attempt: 1, Counted: true, Grade: 70, GradedAt: "2026-05-10T12:00:00Z"}
+
+	tests := []struct {
+		name       string
+		assignment Assignment
+		attempts   []Submission
+		rawGrade   int
+		grade      int
+		want       bool
+	}{
+		{
+			name:       "first attempt",
+			assignment: Assignment{GradingRule: "first"},
+			rawGrade:   -1,
+			want:       true,
+		},
+		{
+			name:       "latest replaces the counted attempt",
+			assignment: Assignment{},
+			attempts:   []Submission{first},
+			rawGrade:   -1,
+			want:       true,
+		},
+		{
+			name:       "first keeps the counted attempt",
+			assignment: Assignment{GradingRule: "first"},
+			attempts:   []Submission{first},
+			rawGrade:   -1,
+			want:       false,
+		},
+		{
+			name:       "best waits for grading",
+			assignment: Assignment{GradingRule: "best"},
+			attempts:   []Submission{first},
+			rawGrade:   -1,
+			want:       false,
+		},
+		{
+			name:       "best quiz attempt beats the counted one",
+			assignment: Assignment{GradingRule: "best"},
+			attempts:   []Submission{graded},
+			rawGrade:   80,
+			grade:      80,
+			want:       true,
+		},
+		{
+			name:       "best quiz attempt that ties the counted one",
+			assignment: Assignment{GradingRule: "best"},
+			attempts:   []Submission{graded},
+			rawGrade:   70,
+			grade:      70,
+			want:       false,
+		},
+		{
+			name:       "best quiz attempt below the counted one",
+			assignment: Assignment{GradingRule: "best"},
+			attempts:   []Submission{graded},
+			rawGrade:   60,
+			grade:      60,
+			want:       false,
+		},
+		{
+			name:       "best quiz attempt against an ungraded counted one",
+			assignment: Assignment{GradingRule: "best"},
+			attempts:   []Submission{first},
+			rawGrade:   0,
+			grade:      0,
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attemptCounted(tt.assignment, tt.attempts, tt.rawGrade, tt.grade); got != tt.want {
+				t.Errorf("attemptCounted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// GradeHistoryEntry records one change of a submission's grade. Old values
+// are nil when the submission was graded for the first time.
+type GradeHistoryEntry struct {
+	ID           string `json:"$id"`
+	SubmissionID string `json:"submissionId"`
+	AssignmentID string `json:"assignmentId"`
+	StudentID    string `json:"studentId"`
+	GradedBy     string `json:"gradedBy"`
+	ChangedAt    string `json:"changedAt"`
+	OldGrade     *int   `json:"oldGrade"`
+	NewGrade     int    `json:"newGrade"`
+	OldRawGrade  *int   `json:"oldRawGrade"`
+	NewRawGrade  int    `json:"newRawGrade"`
+	OldFeedback  string `json:"oldFeedback"`
+	NewFeedback  string `json:"newFeedback"`
+	Reason       string `json:"reason"`
+	Source       string `json:"source"` // grade_assignment, import, regrade, peer_review, quiz or autograder
+	TenantID     string `json:"tenantId"`
+}
+
+// Sources of grade changes
+const (
+	GradeSourceImport     = "import"
+	GradeSourceRegrade    = "regrade"
+	GradeSourcePeerReview = "peer_review"
+	GradeSourceAutograder = "autograder"
+)
+
+func gradeHistoryCollectionID() string {
+	return getEnv("APPWRITE_GRADE_HISTORY_COLLECTION_ID", "grade_history")
+}
+
+// getSubmission loads a submission by ID. Submissions of other tenants are
+// reported as not found.
+func (s *LMSService) getSubmission(submissionID, tenantID string) (*Submission, error) {
+	doc, err := s.db.GetDocument(s.databaseID, submissionsCollectionID(), submissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var submission Submission
+	if err := json.Unmarshal([]byte(doc.(string)), &submission); err != nil {
+		return nil, fmt.Errorf("failed to parse submission: %w", err)
+	}
+
+	if submission.TenantID != tenantID {
+		return nil, fmt.Errorf("submission %s not found", submissionID)
+	}
+	return &submission, nil
+}
+
+// recordGradeChange adds an entry to the grade history. previous is the
+// submission before the change.
+func (s *LMSService) recordGradeChange(ctx context.Context, previous *Submission, grade, rawGrade int, feedback, graderID, reason, source, changedAt string) error {
+	var oldGrade, oldRawGrade interface{}
+	if previous.GradedAt != "" {
+		oldGrade, oldRawGrade = previous.Grade, previous.RawGrade
+	}
+
+	_, err := s.db.CreateDocument(
+		ctx,
+		s.databaseID,
+		gradeHistoryCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"submissionId": previous.ID,
+			"assignmentId": previous.AssignmentID,
+			"studentId":    previous.StudentID,
+			"gradedBy":     graderID,
+			"changedAt":    changedAt,
+			"oldGrade":     oldGrade,
+			"newGrade":     grade,
+			"oldRawGrade":  oldRawGrade,
+			"newRawGrade":  rawGrade,
+			"oldFeedback":  previous.Feedback,
+			"newFeedback":  feedback,
+			"reason":       reason,
+			"source":       source,
+			"tenantId":     previous.TenantID,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record grade change: %w", err)
+	}
+	return nil
+}
+
+// listGradeHistory returns the recorded grade changes of a submission
+func (s *LMSService) listGradeHistory(ctx context.Context, submission *Submission) ([]GradeHistoryEntry, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		gradeHistoryCollectionID(),
+		[]interface{}{
+			query.Equal("submissionId", submission.ID),
+			query.Equal("tenantId", submission.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grade history: %w", err)
+	}
+
+	var history []GradeHistoryEntry
+	if err := json.Unmarshal([]byte(documents.(string)), &history); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal grade history: %w", err)
+	}
+	return history, nil
+}
+
+// lastGradeSource returns where the current grade of a submission came from,
+// or an empty string when it was never graded
+func (s *LMSService) lastGradeSource(ctx context.Context, submission *Submission) (string, error) {
+	history, err := s.listGradeHistory(ctx, submission)
+	if err != nil {
+		return "", err
+	}
+	source, changedAt := "", ""
+	for _, entry := range history {
+		if entry.ChangedAt >= changedAt {
+			source, changedAt = entry.Source, entry.ChangedAt
+		}
+	}
+	return source, nil
+}
+
+// saveGrade grades a submission like grade_assignment does: the late penalty
+// recorded at submission time is applied, and the change is recorded in the
+// grade history
+func (s *LMSService) saveGrade(ctx context.Context, submission *Submission, rawGrade int, feedback, graderID, reason, source string) error {
+	grade := rawGrade
+	if submission.LatePenaltyPercent > 0 {
+		grade = rawGrade * (100 - submission.LatePenaltyPercent) / 100
+	}
+	return s.storeGrade(ctx, submission, grade, rawGrade, feedback, graderID, reason, source)
+}
+
+// saveFinalGrade grades a submission with a grade the late penalty was
+// already applied to, such as one exported from the gradebook. The raw grade
+// is set to the same value.
+func (s *LMSService) saveFinalGrade(ctx context.Context, submission *Submission, grade int, feedback, graderID, reason, source string) error {
+	return s.storeGrade(ctx, submission, grade, grade, feedback, graderID, reason, source)
+}
+
+// storeGrade saves the grade of a submission and records the change in the
+// grade history
+func (s *LMSService) storeGrade(ctx context.Context, submission *Submission, grade, rawGrade int, feedback, graderID, reason, source string) error {
+	gradedAt := time.Now().Format(time.RFC3339)
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		submissionsCollectionID(),
+		submission.ID,
+		map[string]interface{}{
+			"grade":    grade,
+			"rawGrade": rawGrade,
+			"feedback": feedback,
+			"gradedAt": gradedAt,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update submission: %w", err)
+	}
+
+	return s.recordGradeChange(ctx, submission, grade, rawGrade, feedback, graderID, reason, source, gradedAt)
+}
+
+// countBestAttempt makes the student's highest graded attempt the counted one,
+// like grade_assignment does for assignments graded by the "best" rule
+func (s *LMSService) countBestAttempt(ctx context.Context, assignment *Assignment, studentID string) error {
+	attempts, err := s.listStudentAttempts(ctx, assignment, studentID)
+	if err != nil {
+		return fmt.Errorf("failed to get attempts: %w", err)
+	}
+
+	best := bestAttempt(attempts)
+	if best == nil {
+		return nil
+	}
+
+	for _, attempt := range attempts {
+		counted := attempt.ID == best.ID
+		if attempt.Counted == counted {
+			continue
+		}
+		_, err := s.db.UpdateDocument(
+			s.databaseID,
+			submissionsCollectionID(),
+			attempt.ID,
+			map[string]interface{}{
+				"counted": counted,
+			},
+			nil, // permissions
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update attempt %s: %w", attempt.ID, err)
+		}
+	}
+	return nil
+}
+
+// bestAttempt returns the highest graded attempt, or nil if none is graded.
+// Ties go to the earlier attempt.
+func bestAttempt(attempts []Submission) *Submission {
+	var best *Submission
+	for i := range attempts {
+		attempt := &attempts[i]
+		if attempt.GradedAt == "" {
+			continue
+		}
+		if best == nil || attempt.Grade > best.Grade ||
+			(attempt.Grade == best.Grade && attempt.Attempt < best.Attempt) {
+			best = attempt
+		}
+	}
+	return best
+}
+
+// GetGradeHistory returns all grade changes of a submission, oldest first
+func (s *LMSService) GetGradeHistory(w http.ResponseWriter, r *http.Request) {
+	tenantID := getContextTenant(r)
+
+	submission, err := s.getSubmission(mux.Vars(r)["id"], tenantID)
+	if err != nil || submission.Status == SubmissionStatusDraft {
+		log.Printf("Submission not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+
+	_, assignment, course, ok := s.loadAssignmentCourse(w, r, submission.AssignmentID, "grade")
+	if !ok {
+		return
+	}
+
+	history, err := s.listGradeHistory(r.Context(), submission)
+	if err != nil {
+		log.Printf("Failed to get grade history: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve grade history")
+		return
+	}
+
+	masked := identitiesMasked(assignment, course, time.Now())
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+	for i := range history {
+		history[i].StudentID = maskStudent(assignment, masked, history[i].StudentID)
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].ChangedAt < history[j].ChangedAt
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    history,
+		"meta": map[string]interface{}{
+			"total": len(history),
+		},
+	})
+}
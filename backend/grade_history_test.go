@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestBestAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts []Submission
+		want     string
+	}{
+		{
+			name: "highest grade",
+			attempts: []Submission{
+				{ID: "a1", Attempt: 1, Grade: 70, GradedAt: "2026-05-01T10:00:00Z"},
+				{ID: "a2", Attempt: 2, Grade: 90, GradedAt: "2026-05-02T10:00:00Z"},
+				{ID: "a3", Attempt: 3, Grade: 80, GradedAt: "2026-05-03T10:00:00Z"},
+			},
+			want: "a2",
+		},
+		{
+			name: "ties go to the earlier attempt",
+			attempts: []Submission{
+				{ID: "a2", Attempt: 2, Grade: 90, GradedAt: "2026-05-02T10:00:00Z"},
+				{ID: "a1", Attempt: 1, Grade: 90, GradedAt: "2026-05-01T10:00:00Z"},
+			},
+			want: "a1",
+		},
+		{
+			name: "ungraded attempts are skipped",
+			attempts: []Submission{
+				{ID: "a1", Attempt: 1, Grade: 40, GradedAt: "2026-05-01T10:00:00Z"},
+				{ID: "a2", Attempt: 2},
+			},
+			want: "a1",
+		},
+		{
+			name: "graded zero beats ungraded",
+			attempts: []Submission{
+				{ID: "a1", Attempt: 1},
+				{ID: "a2", Attempt: 2, Grade: 0, GradedAt: "2026-05-02T10:00:00Z"},
+			},
+			want: "a2",
+		},
+		{
+			name:     "nothing graded",
+			attempts: []Submission{{ID: "a1", Attempt: 1}},
+			want:     "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if best := bestAttempt(tt.attempts); best != nil {
+				got = best.ID
+			}
+			if got != tt.want {
+				t.Errorf("bestAttempt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
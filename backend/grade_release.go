@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Grade release policies. Until an assignment's grades are released,
+// students see their attempts without grade, feedback or rubric scores.
+const (
+	GradeReleaseImmediate = "immediate"
+	GradeReleaseManual    = "manual"
+	GradeReleaseScheduled = "scheduled"
+)
+
+// gradesReleased reports whether students may see their grades for the
+// assignment at the given time. Assignments without a policy release grades
+// immediately.
+func gradesReleased(assignment *Assignment, course *Course, now time.Time) bool {
+	switch assignment.GradeRelease {
+	case GradeReleaseManual:
+		return assignment.GradesReleasedAt != ""
+	case GradeReleaseScheduled:
+		if assignment.GradesReleasedAt != "" {
+			return true
+		}
+		loc, err := courseLocation(course)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			loc = time.UTC
+		}
+		// Plain dates release at the start of that day in the course's timezone
+		releaseDate, err := parseStartDate(assignment.GradeReleaseDate, loc)
+		if err != nil {
+			log.Printf("Warning: invalid grade release date of assignment %s: %v", assignment.ID, err)
+			return false
+		}
+		return !now.Before(releaseDate)
+	default:
+		return true
+	}
+}
+
+// hideGrade removes everything a grader recorded from a submission
+func hideGrade(submission *Submission) {
+	submission.Grade = 0
+	submission.RawGrade = 0
+	submission.Feedback = ""
+	submission.GradedAt = ""
+	submission.RubricScores = nil
+	submission.GradeHidden = true
+}
+
+// UpdateGradeRelease sets when students see the grades of an assignment
+func (s *LMSService) UpdateGradeRelease(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Policy      string `json:"policy"`
+		ReleaseDate string `json:"releaseDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	data := map[string]interface{}{
+		"gradeRelease":     requestData.Policy,
+		"gradeReleaseDate": "",
+	}
+
+	if requestData.Policy == GradeReleaseImmediate && assignment.BlindGrading {
+		respondWithError(w, http.StatusConflict, "Blind graded assignments cannot release grades immediately")
+		return
+	}
+
+	switch requestData.Policy {
+	case GradeReleaseImmediate, GradeReleaseManual:
+	case GradeReleaseScheduled:
+		loc, err := courseLocation(course)
+		if err != nil {
+			log.Printf("Failed to load course timezone: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to process course timezone")
+			return
+		}
+		releaseDate, err := parseStartDate(requestData.ReleaseDate, loc)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		data["gradeReleaseDate"] = releaseDate.UTC().Format(time.RFC3339)
+	default:
+		respondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("Policy must be %s, %s or %s", GradeReleaseImmediate, GradeReleaseManual, GradeReleaseScheduled))
+		return
+	}
+
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignment.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update grade release: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update grade release")
+		return
+	}
+
+	log.Printf("User %s set the grade release of assignment %s to %s", userID, assignment.ID, requestData.Policy)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// ReleaseGrades releases the grades of an assignment to students now
+func (s *LMSService) ReleaseGrades(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "grade")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if assignment.GradesReleasedAt != "" {
+		respondWithError(w, http.StatusConflict, "Grades were already released")
+		return
+	}
+
+	releasedAt := time.Now().UTC().Format(time.RFC3339)
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignment.ID,
+		map[string]interface{}{
+			"gradesReleasedAt": releasedAt,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to release grades: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to release grades")
+		return
+	}
+
+	log.Printf("User %s released the grades of assignment %s", userID, assignment.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"assignmentId":     assignment.ID,
+			"gradesReleasedAt": releasedAt,
+		},
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGradesReleased(t *testing.T) {
+	berlin := &Course{Timezone: "Europe/Berlin"}
+	now := time.Date(2026, 5, 9, 22, 30, 0, 0, time.UTC) // 00:30 on May 10 in Berlin
+
+	tests := []struct {
+		name       string
+		assignment Assignment
+		course     *Course
+		want       bool
+	}{
+		{
+			name:       "no policy releases immediately",
+			assignment: Assignment{},
+			course:     &Course{},
+			want:       true,
+		},
+		{
+			name:       "immediate",
+			assignment: Assignment{GradeRelease: GradeReleaseImmediate},
+			course:     &Course{},
+			want:       true,
+		},
+		{
+			name:       "manual before release",
+			assignment: Assignment{GradeRelease: GradeReleaseManual},
+			course:     &Course{},
+			want:       false,
+		},
+		{
+			name:       "manual after release",
+			assignment: Assignment{GradeRelease: GradeReleaseManual, GradesReleasedAt: "2026-05-01T10:00:00Z"},
+			course:     &Course{},
+			want:       true,
+		},
+		{
+			name:       "scheduled instant has passed",
+			assignment: Assignment{GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "2026-05-09T22:30:00Z"},
+			course:     &Course{},
+			want:       true,
+		},
+		{
+			name:       "scheduled instant is still ahead",
+			assignment: Assignment{GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "2026-05-09T22:31:00Z"},
+			course:     &Course{},
+			want:       false,
+		},
+		{
+			name:       "scheduled date starts in the course timezone",
+			assignment: Assignment{GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "2026-05-10"},
+			course:     berlin,
+			want:       true,
+		},
+		{
+			name:       "scheduled date has not started in UTC",
+			assignment: Assignment{GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "2026-05-10"},
+			course:     &Course{},
+			want:       false,
+		},
+		{
+			name:       "scheduled grades released early",
+			assignment: Assignment{GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "2026-06-01", GradesReleasedAt: "2026-05-01T10:00:00Z"},
+			course:     &Course{},
+			want:       true,
+		},
+		{
+			name:       "invalid scheduled date keeps grades hidden",
+			assignment: Assignment{GradeRelease: GradeReleaseScheduled, GradeReleaseDate: "next week"},
+			course:     &Course{},
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gradesReleased(&tt.assignment, tt.course, now); got != tt.want {
+				t.Errorf("gradesReleased = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHideGrade(t *testing.T) {
+	submission := Submission{
+		ID:           "submission-1",
+		Content:      "answer",
+		Grade:        85,
+		RawGrade:     90,
+		Feedback:     "Well done",
+		GradedAt:     "2026-05-01T10:00:00Z",
+		RubricScores: []RubricScore{{CriterionID: "code", Level: 2, Points: 10}},
+	}
+
+	hideGrade(&submission)
+
+	if submission.Grade != 0 || submission.RawGrade != 0 || submission.Feedback != "" || submission.GradedAt != "" || submission.RubricScores != nil {
+		t.Errorf("grade is still visible: %+v", submission)
+	}
+	if !submission.GradeHidden {
+		t.Error("GradeHidden = false, want true")
+	}
+	if submission.ID != "submission-1" || submission.Content != "answer" {
+		t.Errorf("hideGrade changed the attempt itself: %+v", submission)
+	}
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// GradeCategory groups assignments of a course, e.g. homework or exams.
+// Weights of a course's categories add up to 100.
+type GradeCategory struct {
+	ID            string   `json:"$id"`
+	CourseID      string   `json:"courseId"`
+	Name          string   `json:"name"`
+	Weight        float64  `json:"weight"`
+	DropLowest    int      `json:"dropLowest"`
+	AssignmentIDs []string `json:"assignmentIds"`
+	TenantID      string   `json:"tenantId"`
+}
+
+// CategoryGrade is a student's average in one category. Average is nil while
+// no assignment of the category is graded.
+type CategoryGrade struct {
+	CategoryID string   `json:"categoryId"`
+	Name       string   `json:"name"`
+	Weight     float64  `json:"weight"`
+	Average    *float64 `json:"average"`
+	Dropped    []string `json:"dropped"`
+}
+
+// StudentGrades is one row of the gradebook
+type StudentGrades struct {
+	StudentID  string          `json:"studentId"`
+	Grades     map[string]int  `json:"grades"` // By assignment ID, graded assignments only
+	Categories []CategoryGrade `json:"categories"`
+	Total      *float64        `json:"total"`
+	Letter     string          `json:"letter"`
+}
+
+// Gradebook is the full grade overview of a course
+type Gradebook struct {
+	Assignments []Assignment    `json:"assignments"`
+	Categories  []GradeCategory `json:"categories"`
+	Students    []StudentGrades `json:"students"`
+}
+
+// Default letter grade scale for courses that define none
+var (
+	defaultGradeLetters  = []string{"A", "B", "C", "D", "F"}
+	defaultGradeMinimums = []float64{90, 80, 70, 60, 0}
+)
+
+func gradeCategoriesCollectionID() string {
+	return getEnv("APPWRITE_GRADE_CATEGORIES_COLLECTION_ID", "grade_categories")
+}
+
+// letterGrade returns the letter of the first scale entry whose minimum the
+// total reaches
+func letterGrade(course *Course, total float64) string {
+	letters, minimums := course.GradeLetters, course.GradeMinimums
+	if len(letters) == 0 {
+		letters, minimums = defaultGradeLetters, defaultGradeMinimums
+	}
+	for i, minimum := range minimums {
+		if total >= minimum {
+			return letters[i]
+		}
+	}
+	return letters[len(letters)-1]
+}
+
+// computeStudentGrades averages each category after dropping its lowest
+// grades, and weights the averages into a running total. Categories without
+// graded work are left out and the remaining weights scaled up, so the total
+// reflects the work graded so far. Courses without categories weight every
+// graded assignment equally.
+func computeStudentGrades(course *Course, studentID string, categories []GradeCategory, grades map[string]int) StudentGrades {
+	result := StudentGrades{
+		StudentID: studentID,
+		Grades:    grades,
+	}
+
+	weighted, weights := 0.0, 0.0
+	for _, category := range categories {
+		categoryGrade := CategoryGrade{
+			CategoryID: category.ID,
+			Name:       category.Name,
+			Weight:     category.Weight,
+		}
+
+		var ids []string
+		for _, id := range category.AssignmentIDs {
+			if _, ok := grades[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			return grades[ids[i]] < grades[ids[j]]
+		})
+
+		// Always keep at least one grade
+		drop := category.DropLowest
+		if drop > len(ids)-1 {
+			drop = len(ids) - 1
+		}
+		if drop > 0 {
+			categoryGrade.Dropped = ids[:drop]
+			ids = ids[drop:]
+		}
+
+		if len(ids) > 0 {
+			sum := 0
+			for _, id := range ids {
+				sum += grades[id]
+			}
+			average := float64(sum) / float64(len(ids))
+			categoryGrade.Average = &average
+			weighted += average * category.Weight
+			weights += category.Weight
+		}
+
+		result.Categories = append(result.Categories, categoryGrade)
+	}
+
+	if len(categories) == 0 {
+		for _, grade := range grades {
+			weighted += float64(grade)
+			weights++
+		}
+	}
+
+	if weights > 0 {
+		total := math.Round(weighted/weights*100) / 100
+		result.Total = &total
+		result.Letter = letterGrade(course, total)
+	}
+	return result
+}
+
+// listGradeCategories returns the grade categories of a course
+func (s *LMSService) listGradeCategories(ctx context.Context, course *Course) ([]GradeCategory, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		gradeCategoriesCollectionID(),
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list grade categories: %w", err)
+	}
+
+	var categories []GradeCategory
+	if err := json.Unmarshal([]byte(documents.(string)), &categories); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal grade categories: %w", err)
+	}
+	return categories, nil
+}
+
+// listCourseAssignments returns the assignments of a course
+func (s *LMSService) listCourseAssignments(ctx context.Context, course *Course) ([]Assignment, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		assignmentsCollectionID(),
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list assignments: %w", err)
+	}
+
+	var assignments []Assignment
+	if err := json.Unmarshal([]byte(documents.(string)), &assignments); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal assignments: %w", err)
+	}
+	return assignments, nil
+}
+
+// listCountedSubmissions returns the counted attempts for the assignments, by
+// student ID and assignment ID. If studentID is set only that student's
+// attempts are loaded.
+func (s *LMSService) listCountedSubmissions(ctx context.Context, course *Course, assignments []Assignment, studentID string) (map[string]map[string]Submission, error) {
+	counted := make(map[string]map[string]Submission)
+	if len(assignments) == 0 {
+		return counted, nil
+	}
+
+	var assignmentIDs []string
+	for _, assignment := range assignments {
+		assignmentIDs = append(assignmentIDs, assignment.ID)
+	}
+
+	queries := []interface{}{
+		query.Equal("assignmentId", assignmentIDs),
+		query.Equal("tenantId", course.TenantID),
+		query.Equal("counted", true),
+	}
+	if studentID != "" {
+		queries = append(queries, query.Equal("studentId", studentID))
+	}
+
+	documents, err := s.db.ListDocuments(ctx, s.databaseID, submissionsCollectionID(), queries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list submissions: %w", err)
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(documents.(string)), &submissions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal submissions: %w", err)
+	}
+
+	for _, submission := range submissions {
+		if submission.Status == SubmissionStatusDraft {
+			continue
+		}
+		if counted[submission.StudentID] == nil {
+			counted[submission.StudentID] = make(map[string]Submission)
+		}
+		counted[submission.StudentID][submission.AssignmentID] = submission
+	}
+	return counted, nil
+}
+
+// listCountedGrades returns the grades of the counted, graded attempts for the
+// assignments, by student ID and assignment ID
+func (s *LMSService) listCountedGrades(ctx context.Context, course *Course, assignments []Assignment, studentID string) (map[string]map[string]int, error) {
+	counted, err := s.listCountedSubmissions(ctx, course, assignments, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	grades := make(map[string]map[string]int)
+	for student, submissions := range counted {
+		for assignmentID, submission := range submissions {
+			if submission.GradedAt == "" {
+				continue
+			}
+			if grades[student] == nil {
+				grades[student] = make(map[string]int)
+			}
+			grades[student][assignmentID] = submission.Grade
+		}
+	}
+	return grades, nil
+}
+
+// buildGradebook computes the gradebook of the given students. With
+// releasedOnly, grades of assignments whose grades are not released yet are
+// left out. Grades of blind graded assignments are always left out until
+// they are released.
+func (s *LMSService) buildGradebook(ctx context.Context, course *Course, studentIDs []string, releasedOnly bool) (*Gradebook, error) {
+	assignments, err := s.listCourseAssignments(ctx, course)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.listGradeCategories(ctx, course)
+	if err != nil {
+		return nil, err
+	}
+
+	studentID := ""
+	if len(studentIDs) == 1 {
+		studentID = studentIDs[0]
+	}
+	grades, err := s.listCountedGrades(ctx, course, assignments, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unreleased grades are left out for students, and for graders while the
+	// assignment is blind graded
+	now := time.Now()
+	for i := range assignments {
+		if gradesReleased(&assignments[i], course, now) || !(releasedOnly || assignments[i].BlindGrading) {
+			continue
+		}
+		for _, studentGrades := range grades {
+			delete(studentGrades, assignments[i].ID)
+		}
+	}
+
+	gradebook := &Gradebook{
+		Assignments: assignments,
+		Categories:  categories,
+	}
+	for _, id := range studentIDs {
+		studentGrades := grades[id]
+		if studentGrades == nil {
+			studentGrades = make(map[string]int)
+		}
+		gradebook.Students = append(gradebook.Students, computeStudentGrades(course, id, categories, studentGrades))
+	}
+	return gradebook, nil
+}
+
+// ListGradeCategories returns the grade categories of a course
+func (s *LMSService) ListGradeCategories(w http.ResponseWriter, r *http.Request) {
+	_, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	categories, err := s.listGradeCategories(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get grade categories: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve grade categories")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    categories,
+		"meta": map[string]interface{}{
+			"total": len(categories),
+		},
+	})
+}
+
+// UpdateGradeCategories replaces the grade categories of a course
+func (s *LMSService) UpdateGradeCategories(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Categories []struct {
+			Name          string   `json:"name"`
+			Weight        float64  `json:"weight"`
+			DropLowest    int      `json:"dropLowest"`
+			AssignmentIDs []string `json:"assignmentIds"`
+		} `json:"categories"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	assignments, err := s.listCourseAssignments(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get assignments: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	courseAssignments := make(map[string]bool)
+	for _, assignment := range assignments {
+		courseAssignments[assignment.ID] = true
+	}
+
+	totalWeight := 0.0
+	categorized := make(map[string]bool)
+	for _, category := range requestData.Categories {
+		if category.Name == "" {
+			respondWithError(w, http.StatusBadRequest, "Category name is required")
+			return
+		}
+		if category.Weight < 0 || category.DropLowest < 0 {
+			respondWithError(w, http.StatusBadRequest,
+				fmt.Sprintf("Category %q must not have a negative weight or drop count", category.Name))
+			return
+		}
+		for _, id := range category.AssignmentIDs {
+			if !courseAssignments[id] {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Assignment %s is not part of the course", id))
+				return
+			}
+			if categorized[id] {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Assignment %s is in more than one category", id))
+				return
+			}
+			categorized[id] = true
+		}
+		totalWeight += category.Weight
+	}
+	if len(requestData.Categories) > 0 && math.Abs(totalWeight-100) > 0.001 {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Category weights add up to %g, expected 100", totalWeight))
+		return
+	}
+
+	existing, err := s.listGradeCategories(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get grade categories: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve grade categories")
+		return
+	}
+
+	for _, category := range existing {
+		if _, err := s.db.DeleteDocument(s.databaseID, gradeCategoriesCollectionID(), category.ID); err != nil {
+			log.Printf("Failed to delete grade category: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update grade categories")
+			return
+		}
+	}
+
+	var created []interface{}
+	for _, category := range requestData.Categories {
+		doc, err := s.db.CreateDocument(
+			r.Context(),
+			s.databaseID,
+			gradeCategoriesCollectionID(),
+			"unique()",
+			map[string]interface{}{
+				"courseId":      course.ID,
+				"name":          category.Name,
+				"weight":        category.Weight,
+				"dropLowest":    category.DropLowest,
+				"assignmentIds": category.AssignmentIDs,
+				"tenantId":      course.TenantID,
+			},
+		)
+		if err != nil {
+			log.Printf("Failed to create grade category: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update grade categories")
+			return
+		}
+		created = append(created, doc)
+	}
+
+	log.Printf("User %s updated the grade categories of course %s", userID, course.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    created,
+		"meta": map[string]interface{}{
+			"total": len(created),
+		},
+	})
+}
+
+// UpdateGradeScale sets the letter grade scale of a course
+func (s *LMSService) UpdateGradeScale(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Letters  []string  `json:"letters"`
+		Minimums []float64 `json:"minimums"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if len(requestData.Letters) == 0 || len(requestData.Letters) != len(requestData.Minimums) {
+		respondWithError(w, http.StatusBadRequest, "Every letter needs a minimum total")
+		return
+	}
+	for i := 1; i < len(requestData.Minimums); i++ {
+		if requestData.Minimums[i] >= requestData.Minimums[i-1] {
+			respondWithError(w, http.StatusBadRequest, "Minimums must be in descending order")
+			return
+		}
+	}
+
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		getEnv("APPWRITE_COLLECTION_ID", "courses"),
+		course.ID,
+		map[string]interface{}{
+			"gradeLetters":  requestData.Letters,
+			"gradeMinimums": requestData.Minimums,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update grade scale: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update grade scale")
+		return
+	}
+
+	log.Printf("User %s updated the grade scale of course %s", userID, course.ID)
+
+	course.GradeLetters = requestData.Letters
+	course.GradeMinimums = requestData.Minimums
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    course,
+	})
+}
+
+// GetGradebook returns the grades of all students of a course
+func (s *LMSService) GetGradebook(w http.ResponseWriter, r *http.Request) {
+	_, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "gradebook")
+	if !ok {
+		return
+	}
+
+	gradebook, err := s.buildGradebook(r.Context(), course, course.StudentIDs, false)
+	if err != nil {
+		log.Printf("Failed to build gradebook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to build gradebook")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    gradebook,
+		"meta": map[string]interface{}{
+			"total": len(gradebook.Students),
+		},
+	})
+}
+
+// GetMyGrades returns the current student's grades in a course
+func (s *LMSService) GetMyGrades(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	if !contains(course.StudentIDs, userID) {
+		respondWithError(w, http.StatusForbidden, "Only enrolled students have grades in this course")
+		return
+	}
+
+	gradebook, err := s.buildGradebook(r.Context(), course, []string{userID}, true)
+	if err != nil {
+		log.Printf("Failed to build gradebook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to build gradebook")
+		return
+	}
+
+	// Students only see the assignments they can open
+	unpublished, err := s.unpublishedAssignments(r.Context(), course, time.Now())
+	if err != nil {
+		log.Printf("Failed to get module items: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+		return
+	}
+	progress, err := s.loadProgress(r.Context(), course, userID)
+	if err != nil {
+		log.Printf("Failed to evaluate prerequisites: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to evaluate prerequisites")
+		return
+	}
+	assignments := []Assignment{}
+	for _, assignment := range gradebook.Assignments {
+		if !unpublished[assignment.ID] && !progress.locked(PrerequisiteTargetAssignment, assignment.ID) {
+			assignments = append(assignments, assignment)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"assignments": assignments,
+			"categories":  gradebook.Categories,
+			"grades":      gradebook.Students[0],
+		},
+	})
+}
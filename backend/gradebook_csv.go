@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// Gradebook CSV files have one row per student. The first columns are the
+// student's ID, name and email, followed by one column per assignment headed
+// "<title> [<assignment ID>]". Exports end with the course total and letter.
+// Assignment cells hold final grades, after late penalties, and imports store
+// them as final grades without applying the penalty again.
+
+// assignmentHeader matches the assignment ID at the end of a column header
+var assignmentHeader = regexp.MustCompile(`\[([^\]]+)\]\s*$`)
+
+// csvCell keeps text from being run as a formula when the file is opened in
+// a spreadsheet, by prefixing cells that start like one with a quote
+func csvCell(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@") {
+		return "'" + value
+	}
+	return value
+}
+
+// parseGradebookHeader maps the columns of an imported CSV file to
+// assignment IDs and finds the studentId column. Name, email, total and
+// letter columns are skipped.
+func parseGradebookHeader(header []string, assignmentsByID map[string]*Assignment) (int, map[int]string, error) {
+	columns := make(map[int]string)
+	studentColumn := -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "studentId":
+			studentColumn = i
+		case name == "name" || name == "email" || name == "total" || name == "letter":
+		default:
+			assignmentID := name
+			if match := assignmentHeader.FindStringSubmatch(name); match != nil {
+				assignmentID = match[1]
+			}
+			if assignmentsByID[assignmentID] == nil {
+				return 0, nil, fmt.Errorf("column %q is not an assignment of the course", name)
+			}
+			columns[i] = assignmentID
+		}
+	}
+	if studentColumn < 0 {
+		return 0, nil, fmt.Errorf("CSV file needs a studentId column")
+	}
+	return studentColumn, columns, nil
+}
+
+// GradeChange is one cell of an imported CSV that differs from the gradebook
+type GradeChange struct {
+	StudentID    string `json:"studentId"`
+	AssignmentID string `json:"assignmentId"`
+	OldGrade     *int   `json:"oldGrade"`
+	NewGrade     int    `json:"newGrade"`
+}
+
+// ExportGradebook returns the gradebook of a course as CSV
+func (s *LMSService) ExportGradebook(w http.ResponseWriter, r *http.Request) {
+	_, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "gradebook")
+	if !ok {
+		return
+	}
+
+	gradebook, err := s.buildGradebook(r.Context(), course, course.StudentIDs, false)
+	if err != nil {
+		log.Printf("Failed to build gradebook: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to build gradebook")
+		return
+	}
+
+	studentIDs := make([]string, 0, len(gradebook.Students))
+	for _, student := range gradebook.Students {
+		studentIDs = append(studentIDs, student.StudentID)
+	}
+	accounts, err := s.getUserAccounts(r.Context(), studentIDs)
+	if err != nil {
+		log.Printf("Failed to get students: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve students")
+		return
+	}
+
+	header := []string{"studentId", "name", "email"}
+	for _, assignment := range gradebook.Assignments {
+		header = append(header, csvCell(fmt.Sprintf("%s [%s]", assignment.Title, assignment.ID)))
+	}
+	header = append(header, "total", "letter")
+
+	rows := [][]string{header}
+	for _, student := range gradebook.Students {
+		account := accounts[student.StudentID]
+		row := []string{csvCell(student.StudentID), csvCell(account.Name), csvCell(account.Email)}
+		for _, assignment := range gradebook.Assignments {
+			if grade, ok := student.Grades[assignment.ID]; ok {
+				row = append(row, strconv.Itoa(grade))
+			} else {
+				row = append(row, "")
+			}
+		}
+		if student.Total != nil {
+			row = append(row, strconv.FormatFloat(*student.Total, 'f', 2, 64), student.Letter)
+		} else {
+			row = append(row, "", "")
+		}
+		rows = append(rows, row)
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "gradebook-"+course.ID+".csv"))
+	w.WriteHeader(http.StatusOK)
+	if err := csv.NewWriter(w).WriteAll(rows); err != nil {
+		log.Printf("Failed to write gradebook CSV: %v", err)
+	}
+}
+
+// ImportGradebook reads grades from a CSV file in the export format and
+// returns the cells that differ from the gradebook. With ?apply=true the
+// changes are saved, after checking that the user may grade every changed
+// assignment. Empty cells are ignored; total and letter columns are not read.
+// Blind graded assignments cannot be imported until their grades are
+// released.
+func (s *LMSService) ImportGradebook(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "gradebook")
+	if !ok {
+		return
+	}
+
+	apply := r.URL.Query().Get("apply") == "true"
+	if apply {
+		if err := checkCourseWritable(course); err != nil {
+			respondWithError(w, http.StatusConflict, err.Error())
+			return
+		}
+	}
+
+	assignments, err := s.listCourseAssignments(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get assignments: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	assignmentsByID := make(map[string]*Assignment)
+	for i := range assignments {
+		assignmentsByID[assignments[i].ID] = &assignments[i]
+	}
+
+	reader := csv.NewReader(r.Body)
+	header, err := reader.Read()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "CSV file is empty or invalid")
+		return
+	}
+
+	studentColumn, columns, err := parseGradebookHeader(header, assignmentsByID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	counted, err := s.listCountedSubmissions(r.Context(), course, assignments, "")
+	if err != nil {
+		log.Printf("Failed to get submissions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve submissions")
+		return
+	}
+
+	now := time.Now()
+	var changes []GradeChange
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Line %d: %v", line, err))
+			return
+		}
+
+		studentID := strings.TrimSpace(record[studentColumn])
+		if !contains(course.StudentIDs, studentID) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Line %d: student %q is not enrolled in the course", line, studentID))
+			return
+		}
+
+		for column, assignmentID := range columns {
+			value := strings.TrimSpace(record[column])
+			if value == "" {
+				continue
+			}
+			if identitiesMasked(assignmentsByID[assignmentID], course, now) {
+				respondWithError(w, http.StatusBadRequest,
+					fmt.Sprintf("Line %d: assignment %s is blind graded and cannot be imported until its grades are released", line, assignmentID))
+				return
+			}
+			grade, err := strconv.Atoi(value)
+			if err != nil || grade < 0 || grade > 100 {
+				respondWithError(w, http.StatusBadRequest,
+					fmt.Sprintf("Line %d: grade %q for assignment %s must be a whole number from 0 to 100", line, value, assignmentID))
+				return
+			}
+
+			var oldGrade *int
+			if submission, ok := counted[studentID][assignmentID]; ok && submission.GradedAt != "" {
+				previous := submission.Grade
+				oldGrade = &previous
+			}
+			if oldGrade != nil && *oldGrade == grade {
+				continue
+			}
+
+			changes = append(changes, GradeChange{
+				StudentID:    studentID,
+				AssignmentID: assignmentID,
+				OldGrade:     oldGrade,
+				NewGrade:     grade,
+			})
+		}
+	}
+
+	if !apply {
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    changes,
+			"meta": map[string]interface{}{
+				"total":   len(changes),
+				"applied": false,
+			},
+		})
+		return
+	}
+
+	// Check every changed assignment like grade_assignment does, and refuse
+	// to overwrite rubric grades with a single number
+	instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get course sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+		return
+	}
+	checked := make(map[string]bool)
+	for _, change := range changes {
+		if checked[change.AssignmentID] {
+			continue
+		}
+		assignment := assignmentsByID[change.AssignmentID]
+		if _, ok := s.authorize(w, r, "grade", &models.ResourceInput{
+			Type: "assignment",
+			Key:  assignment.ID,
+			Attributes: map[string]interface{}{
+				"courseId":      course.ID,
+				"teacherId":     course.TeacherID,
+				"instructorIds": instructorIDs,
+				"studentIds":    course.StudentIDs,
+			},
+		}); !ok {
+			return
+		}
+
+		criteria, err := s.listRubricCriteria(r.Context(), assignment)
+		if err != nil {
+			log.Printf("Failed to get rubric: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric")
+			return
+		}
+		if len(criteria) > 0 {
+			respondWithError(w, http.StatusBadRequest,
+				fmt.Sprintf("Assignment %s is graded with a rubric and cannot be imported", assignment.ID))
+			return
+		}
+		checked[change.AssignmentID] = true
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "Imported from CSV"
+	}
+
+	for _, change := range changes {
+		submission, ok := counted[change.StudentID][change.AssignmentID]
+		if ok {
+			err = s.saveFinalGrade(r.Context(), &submission, change.NewGrade, submission.Feedback, userID, reason, GradeSourceImport)
+		} else {
+			// Work graded outside the LMS, such as a paper exam
+			err = s.createGradedSubmission(r.Context(), course, change, userID, reason)
+		}
+		if err != nil {
+			log.Printf("Failed to import grade: %v", err)
+			respondWithError(w, http.StatusInternalServerError,
+				fmt.Sprintf("Failed to import grade of student %s for assignment %s", change.StudentID, change.AssignmentID))
+			return
+		}
+	}
+
+	log.Printf("User %s imported %d grades into course %s", userID, len(changes), course.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    changes,
+		"meta": map[string]interface{}{
+			"total":   len(changes),
+			"applied": true,
+		},
+	})
+}
+
+// createGradedSubmission records a grade for a student without a submission,
+// such as for a paper exam
+func (s *LMSService) createGradedSubmission(ctx context.Context, course *Course, change GradeChange, graderID, reason string) error {
+	now := time.Now().Format(time.RFC3339)
+	doc, err := s.db.CreateDocument(
+		ctx,
+		s.databaseID,
+		submissionsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"assignmentId": change.AssignmentID,
+			"studentId":    change.StudentID,
+			"content":      "",
+			"submittedAt":  now,
+			"grade":        change.NewGrade,
+			"rawGrade":     change.NewGrade,
+			"feedback":     "",
+			"tenantId":     course.TenantID,
+			"attempt":      1,
+			"counted":      true,
+			"status":       SubmissionStatusSubmitted,
+			"gradedAt":     now,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create submission: %w", err)
+	}
+
+	created := &Submission{
+		ID:           fmt.Sprint(doc.Get("$id")),
+		AssignmentID: change.AssignmentID,
+		StudentID:    change.StudentID,
+		TenantID:     course.TenantID,
+	}
+	return s.recordGradeChange(ctx, created, change.NewGrade, change.NewGrade, "", graderID, reason, GradeSourceImport, now)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "", want: ""},
+		{value: "Ada Lovelace", want: "Ada Lovelace"},
+		{value: "ada@example.com", want: "ada@example.com"},
+		{value: "=HYPERLINK(\"http://example.com\")", want: "'=HYPERLINK(\"http://example.com\")"},
+		{value: "+1+1", want: "'+1+1"},
+		{value: "-2+3", want: "'-2+3"},
+		{value: "@SUM(A1:A2)", want: "'@SUM(A1:A2)"},
+		{value: "Essay [a=1]", want: "Essay [a=1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := csvCell(tt.value); got != tt.want {
+				t.Errorf("csvCell(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGradebookHeader(t *testing.T) {
+	assignmentsByID := map[string]*Assignment{
+		"essay-1": {ID: "essay-1", Title: "Essay"},
+		"quiz-1":  {ID: "quiz-1", Title: "Quiz"},
+	}
+
+	tests := []struct {
+		name              string
+		header            []string
+		wantStudentColumn int
+		wantColumns       map[int]string
+		wantErr           bool
+	}{
+		{
+			name:              "exported header",
+			header:            []string{"studentId", "name", "email", "Essay [essay-1]", "Quiz [quiz-1]", "total", "letter"},
+			wantStudentColumn: 0,
+			wantColumns:       map[int]string{3: "essay-1", 4: "quiz-1"},
+		},
+		{
+			name:              "plain assignment IDs with spaces",
+			header:            []string{" quiz-1 ", "studentId"},
+			wantStudentColumn: 1,
+			wantColumns:       map[int]string{0: "quiz-1"},
+		},
+		{
+			name:              "title with brackets",
+			header:            []string{"studentId", "Essay [draft] [essay-1]"},
+			wantStudentColumn: 0,
+			wantColumns:       map[int]string{1: "essay-1"},
+		},
+		{
+			name:    "assignment of another course",
+			header:  []string{"studentId", "Lab [lab-1]"},
+			wantErr: true,
+		},
+		{
+			name:    "no studentId column",
+			header:  []string{"name", "Essay [essay-1]"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			studentColumn, columns, err := parseGradebookHeader(tt.header, assignmentsByID)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("parseGradebookHeader succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseGradebookHeader returned error: %v", err)
+			}
+			if studentColumn != tt.wantStudentColumn {
+				t.Errorf("student column = %d, want %d", studentColumn, tt.wantStudentColumn)
+			}
+			if !reflect.DeepEqual(columns, tt.wantColumns) {
+				t.Errorf("columns = %v, want %v", columns, tt.wantColumns)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import "testing"
+
+func TestComputeStudentGrades(t *testing.T) {
+	homework := GradeCategory{ID: "homework", Name: "Homework", Weight: 40, DropLowest: 1, AssignmentIDs: []string{"hw1", "hw2", "hw3"}}
+	exams := GradeCategory{ID: "exams", Name: "Exams", Weight: 60, AssignmentIDs: []string{"midterm", "final"}}
+
+	tests := []struct {
+		name         string
+		course       Course
+		categories   []GradeCategory
+		grades       map[string]int
+		wantTotal    *float64
+		wantLetter   string
+		wantDropped  map[string]int
+		wantAverages map[string]*float64
+	}{
+		{
+			name:         "weighted categories with the lowest homework dropped",
+			categories:   []GradeCategory{homework, exams},
+			grades:       map[string]int{"hw1": 50, "hw2": 90, "hw3": 100, "midterm": 80, "final": 70},
+			wantTotal:    float64Ptr(83),
+			wantLetter:   "B",
+			wantDropped:  map[string]int{"homework": 1, "exams": 0},
+			wantAverages: map[string]*float64{"homework": float64Ptr(95), "exams": float64Ptr(75)},
+		},
+		{
+			name:         "at least one grade is kept",
+			categories:   []GradeCategory{homework},
+			grades:       map[string]int{"hw2": 65},
+			wantTotal:    float64Ptr(65),
+			wantLetter:   "D",
+			wantDropped:  map[string]int{"homework": 0},
+			wantAverages: map[string]*float64{"homework": float64Ptr(65)},
+		},
+		{
+			name:         "categories without grades do not count",
+			categories:   []GradeCategory{homework, exams},
+			grades:       map[string]int{"midterm": 91},
+			wantTotal:    float64Ptr(91),
+			wantLetter:   "A",
+			wantAverages: map[string]*float64{"homework": nil, "exams": float64Ptr(91)},
+		},
+		{
+			name:         "assignments outside every category do not count",
+			categories:   []GradeCategory{exams},
+			grades:       map[string]int{"midterm": 70, "quiz": 0},
+			wantTotal:    float64Ptr(70),
+			wantLetter:   "C",
+			wantAverages: map[string]*float64{"exams": float64Ptr(70)},
+		},
+		{
+			name:       "equal weights without categories",
+			grades:     map[string]int{"hw1": 80, "hw2": 85, "midterm": 91},
+			wantTotal:  float64Ptr(85.33),
+			wantLetter: "B",
+		},
+		{
+			name:       "course grade scale",
+			course:     Course{GradeLetters: []string{"Pass", "Fail"}, GradeMinimums: []float64{50, 0}},
+			grades:     map[string]int{"hw1": 49},
+			wantTotal:  float64Ptr(49),
+			wantLetter: "Fail",
+		},
+		{
+			name:       "nothing graded",
+			categories: []GradeCategory{homework, exams},
+			grades:     map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := computeStudentGrades(&tt.course, "student", tt.categories, tt.grades)
+
+			if (got.Total == nil) != (tt.wantTotal == nil) || (got.Total != nil && *got.Total != *tt.wantTotal) {
+				t.Errorf("total = %v, want %v", formatFloat64Ptr(got.Total), formatFloat64Ptr(tt.wantTotal))
+			}
+			if got.Letter != tt.wantLetter {
+				t.Errorf("letter = %q, want %q", got.Letter, tt.wantLetter)
+			}
+			if len(got.Categories) != len(tt.categories) {
+				t.Fatalf("got %d categories, want %d", len(got.Categories), len(tt.categories))
+			}
+			for _, category := range got.Categories {
+				if want, ok := tt.wantDropped[category.CategoryID]; ok && len(category.Dropped) != want {
+					t.Errorf("%s dropped %v, want %d grades", category.CategoryID, category.Dropped, want)
+				}
+				want, ok := tt.wantAverages[category.CategoryID]
+				if !ok {
+					continue
+				}
+				if (category.Average == nil) != (want == nil) || (want != nil && *category.Average != *want) {
+					t.Errorf("%s average = %v, want %v", category.CategoryID, formatFloat64Ptr(category.Average), formatFloat64Ptr(want))
+				}
+			}
+		})
+	}
+}
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
+
+func formatFloat64Ptr(value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
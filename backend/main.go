@@ -7,10 +7,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/appwrite/go-sdk/appwrite"
 	"github.com/appwrite/go-sdk/appwrite/databases"
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/appwrite/go-sdk/appwrite/storage"
+	"github.com/appwrite/go-sdk/appwrite/teams"
+	"github.com/appwrite/go-sdk/appwrite/users"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/permitio/permit-golang/pkg/permit"
@@ -30,23 +36,60 @@ type Config struct {
 
 // Models
 type Course struct {
-	ID          string        `json:"$id"`
-	Title       string        `json:"title"`
-	Description string        `json:"description"`
-	TeacherID   string        `json:"teacherId"`
-	StudentIDs  []string      `json:"studentIds"`
-	Collection  string        `json:"$collection"`
-	Permissions []interface{} `json:"$permissions"`
-	CreatedAt   string        `json:"$createdAt"`
-	UpdatedAt   string        `json:"$updatedAt"`
+	ID                    string        `json:"$id"`
+	Title                 string        `json:"title"`
+	Description           string        `json:"description"`
+	TeacherID             string        `json:"teacherId"`
+	StudentIDs            []string      `json:"studentIds"`
+	TenantID              string        `json:"tenantId"`
+	TermID                string        `json:"termId"`
+	Status                string        `json:"status"`
+	EnrollmentStart       string        `json:"enrollmentStart"`
+	EnrollmentEnd         string        `json:"enrollmentEnd"`
+	Timezone              string        `json:"timezone"`
+	GradeLetters          []string      `json:"gradeLetters"`
+	GradeMinimums         []float64     `json:"gradeMinimums"`
+	PrerequisiteCourseIDs []string      `json:"prerequisiteCourseIds"`
+	PrerequisiteMinGrades []float64     `json:"prerequisiteMinGrades"` // Parallel to PrerequisiteCourseIDs, 0 means none
+	PrerequisiteOverrides []string      `json:"prerequisiteOverrides"` // Students exempted from the prerequisites
+	Collection            string        `json:"$collection"`
+	Permissions           []interface{} `json:"$permissions"`
+	CreatedAt             string        `json:"$createdAt"`
+	UpdatedAt             string        `json:"$updatedAt"`
 }
 
 type Assignment struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	CourseID    string `json:"courseId"`
-	DueDate     string `json:"dueDate"`
+	ID                    string   `json:"$id"`
+	Title                 string   `json:"title"`
+	Description           string   `json:"description"`
+	CourseID              string   `json:"courseId"`
+	DueDate               string   `json:"dueDate"`    // RFC3339, see parseDeadline
+	LatePolicy            string   `json:"latePolicy"` // hard_close (default), grace, penalty or accept_until
+	GraceMinutes          int      `json:"graceMinutes"`
+	LatePenaltyPercent    int      `json:"latePenaltyPercent"` // Per started day late
+	AcceptUntil           string   `json:"acceptUntil"`        // RFC3339, see parseDeadline
+	TenantID              string   `json:"tenantId"`
+	MaxAttempts           int      `json:"maxAttempts"`      // 0 means unlimited
+	GradingRule           string   `json:"gradingRule"`      // latest, best or first
+	MaxFileSizeMB         int      `json:"maxFileSizeMB"`    // 0 means defaultMaxFileSizeMB
+	AllowedFileTypes      []string `json:"allowedFileTypes"` // File extensions, e.g. ".pdf"
+	AutoSubmitDrafts      bool     `json:"autoSubmitDrafts"`
+	GradeRelease          string   `json:"gradeRelease"`     // immediate, manual or scheduled
+	GradeReleaseDate      string   `json:"gradeReleaseDate"` // RFC3339, for scheduled releases
+	GradesReleasedAt      string   `json:"gradesReleasedAt"`
+	PeerReviewCount       int      `json:"peerReviewCount"` // Reviews per submission, 0 disables peer review
+	PeerReviewsAssignedAt string   `json:"peerReviewsAssignedAt"`
+	BlindGrading          bool     `json:"blindGrading"`     // Graders see pseudonyms until grades are released
+	Type                  string   `json:"type"`             // Empty for free text, quiz or programming
+	TimeLimitMinutes      int      `json:"timeLimitMinutes"` // Quiz time limit, 0 means none
+	ShuffleQuestions      bool     `json:"shuffleQuestions"`
+	TestSuiteFileID       string   `json:"testSuiteFileId"` // Test suite in the test suites bucket
+	TestSuiteName         string   `json:"testSuiteName"`
+	TestCommand           string   `json:"testCommand"`          // Runs the test suite, see sandbox.go
+	SandboxImage          string   `json:"sandboxImage"`         // Empty means AUTOGRADER_DEFAULT_IMAGE
+	TestTimeLimitSeconds  int      `json:"testTimeLimitSeconds"` // Limits of 0 use the defaults in sandbox.go
+	TestMemoryLimitMB     int      `json:"testMemoryLimitMB"`
+	TestCPULimit          float64  `json:"testCPULimit"`
 }
 
 type User struct {
@@ -60,6 +103,9 @@ type User struct {
 type LMSService struct {
 	client      *appwrite.Client
 	db          *databases.Service
+	users       *users.Service
+	teams       *teams.Service
+	storage     *storage.Service
 	permit      *permit.Client
 	config      Config
 	databaseID  string
@@ -78,6 +124,15 @@ func NewLMSService(config Config) (*LMSService, error) {
 	// Initialize Database client
 	dbClient := databases.New(client)
 
+	// Initialize Users client (server-side user management)
+	usersClient := users.New(client)
+
+	// Initialize Teams client (organizations are Appwrite teams)
+	teamsClient := teams.New(client)
+
+	// Initialize Storage client (submission attachments)
+	storageClient := storage.New(client)
+
 	// Initialize Permit client
 	permitCfg := permitConfig.NewConfigBuilder(config.PermitToken).
 		WithApiUrl(config.PermitAPIURL).
@@ -104,6 +159,9 @@ func NewLMSService(config Config) (*LMSService, error) {
 	return &LMSService{
 		client:       client,
 		db:           dbClient,
+		users:        usersClient,
+		teams:        teamsClient,
+		storage:      storageClient,
 		permit:       permitClient,
 		config:       config,
 		databaseID:   databaseID,
@@ -153,20 +211,20 @@ func (s *LMSService) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Get user preferences (where we store roles)
-		prefs, err := account.GetPrefs()
+		// Get roles from the server-controlled Appwrite labels. Preferences are
+		// writable by the user from the client SDK and must not be trusted.
 		userRoles := []string{"user"} // Default role
+		if account, err := s.getUserAccount(user.Get("$id")); err != nil {
+			log.Printf("Failed to load roles for user %s: %v", user.Get("$id"), err)
+		} else if roles := account.Roles(); len(roles) > 0 {
+			userRoles = roles
+		}
 
-		// Extract roles from user preferences if available
-		if err == nil && prefs != nil {
-			if roles, ok := prefs["roles"].([]interface{}); ok {
-				userRoles = make([]string, 0, len(roles))
-				for _, r := range roles {
-					if role, ok := r.(string); ok {
-						userRoles = append(userRoles, role)
-					}
-				}
-			}
+		// Resolve the organization (Permit.io tenant) the request acts in
+		tenant, err := s.resolveTenant(r, user.Get("$id"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
 		}
 
 		// Create user info context
@@ -175,6 +233,7 @@ func (s *LMSService) AuthMiddleware(next http.Handler) http.Handler {
 			"email":   user.Get("email"),
 			"name":    user.Get("name"),
 			"roles":   userRoles,
+			"tenant":  tenant,
 			"session": session,
 		}
 
@@ -186,6 +245,7 @@ func (s *LMSService) AuthMiddleware(next http.Handler) http.Handler {
 		r.Header.Set("X-User-Email", user.Get("email"))
 		r.Header.Set("X-User-Name", user.Get("name"))
 		r.Header.Set("X-User-Roles", strings.Join(userRoles, ","))
+		r.Header.Set("X-Tenant-ID", tenant)
 
 		// Continue with the next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -204,27 +264,69 @@ func (s *LMSService) GetCourses(w http.ResponseWriter, r *http.Request) {
 	userID, _ := user["id"].(string)
 	userRoles, _ := user["roles"].([]string)
 
+	filter := CourseFilter{
+		TermID:          r.URL.Query().Get("termId"),
+		IncludeArchived: r.URL.Query().Get("includeArchived") == "true",
+	}
+
+	filteredCourses, total, err := s.listVisibleCourses(r.Context(), userID, getContextTenant(r), filter)
+	if err != nil {
+		log.Printf("Failed to get courses: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve courses")
+		return
+	}
+
+	// Log access for auditing
+	log.Printf("User %s with roles %v accessed %d courses", 
+		userID, userRoles, len(filteredCourses))
+
+	// Return filtered courses
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    filteredCourses,
+		"meta": map[string]interface{}{
+			"total":   len(filteredCourses),
+			"filtered": len(filteredCourses) < total,
+		},
+	})
+}
+
+// CourseFilter narrows down course listings
+type CourseFilter struct {
+	TermID          string
+	IncludeArchived bool
+}
+
+// listVisibleCourses returns the courses of the tenant the given user may read
+// according to Permit.io, along with the total number of courses that were
+// considered. Archived courses are left out unless requested.
+func (s *LMSService) listVisibleCourses(ctx context.Context, userID, tenantID string, filter CourseFilter) ([]Course, int, error) {
 	// Get collection ID from environment or use default
 	collectionID := getEnv("APPWRITE_COLLECTION_ID", "courses")
 
-	// Get all courses from Appwrite
+	queries := []interface{}{query.Equal("tenantId", tenantID)}
+	if filter.TermID != "" {
+		queries = append(queries, query.Equal("termId", filter.TermID))
+	}
+	if !filter.IncludeArchived {
+		queries = append(queries, query.NotEqual("status", CourseStatusArchived))
+	}
+
+	// Get the tenant's courses from Appwrite
 	documents, err := s.db.ListDocuments(
-		r.Context(),
+		ctx,
 		s.databaseID,
 		collectionID,
+		queries,
 	)
 	if err != nil {
-		log.Printf("Failed to get courses: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve courses")
-		return
+		return nil, 0, fmt.Errorf("failed to list courses: %w", err)
 	}
 
 	// Convert documents to Course slice
 	var allCourses []Course
 	if err := json.Unmarshal([]byte(documents.(string)), &allCourses); err != nil {
-		log.Printf("Failed to unmarshal courses: %v", err)
-		respondWithError(w, http.StatusInternalServerError, "Failed to process courses")
-		return
+		return nil, 0, fmt.Errorf("failed to unmarshal courses: %w", err)
 	}
 
 	// Filter courses based on permissions
@@ -232,13 +334,18 @@ func (s *LMSService) GetCourses(w http.ResponseWriter, r *http.Request) {
 	for _, course := range allCourses {
 		// Check permission with Permit.io for each course
 		allowed, err := s.permit.Check(
-			r.Context(),
+			ctx,
 			userID,
-			"view",
-			"course",
-			map[string]string{
-				"id":        course.ID,
-				"teacherId": course.TeacherID,
+			"read",
+			&models.ResourceInput{
+				Type:   "course",
+				Key:    course.ID,
+				Tenant: tenantID,
+				Attributes: map[string]interface{}{
+					"teacherId":  course.TeacherID,
+					"studentIds": course.StudentIDs,
+					"status":     course.Status,
+				},
 			},
 		)
 
@@ -252,19 +359,216 @@ func (s *LMSService) GetCourses(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Log access for auditing
-	log.Printf("User %s with roles %v accessed %d courses", 
-		userID, userRoles, len(filteredCourses))
+	return filteredCourses, len(allCourses), nil
+}
 
-	// Return filtered courses
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"success": true,
-		"data":    filteredCourses,
-		"meta": map[string]interface{}{
-			"total":   len(filteredCourses),
-			"filtered": len(filteredCourses) < len(allCourses),
+// getCourse loads a course by ID. Courses of other tenants are reported as
+// not found.
+func (s *LMSService) getCourse(courseID, tenantID string) (*Course, error) {
+	doc, err := s.db.GetDocument(
+		s.databaseID,
+		getEnv("APPWRITE_COLLECTION_ID", "courses"),
+		courseID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var course Course
+	if err := json.Unmarshal([]byte(doc.(string)), &course); err != nil {
+		return nil, fmt.Errorf("failed to parse course: %w", err)
+	}
+
+	if course.TenantID != tenantID {
+		return nil, fmt.Errorf("course %s not found", courseID)
+	}
+	return &course, nil
+}
+
+func assignmentsCollectionID() string {
+	return getEnv("APPWRITE_ASSIGNMENTS_COLLECTION_ID", "assignments")
+}
+
+// getAssignment loads an assignment by ID. Assignments of other tenants are
+// reported as not found.
+func (s *LMSService) getAssignment(assignmentID, tenantID string) (*Assignment, error) {
+	doc, err := s.db.GetDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignmentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var assignment Assignment
+	if err := json.Unmarshal([]byte(doc.(string)), &assignment); err != nil {
+		return nil, fmt.Errorf("failed to parse assignment: %w", err)
+	}
+
+	if assignment.TenantID != tenantID {
+		return nil, fmt.Errorf("assignment %s not found", assignmentID)
+	}
+	return &assignment, nil
+}
+
+// loadAssignmentCourse loads an assignment and its course, and checks that the
+// current user may perform action on the assignment. Assignments whose
+// prerequisites the user has yet to meet are locked. It writes an error
+// response and returns false when the request must not proceed.
+func (s *LMSService) loadAssignmentCourse(w http.ResponseWriter, r *http.Request, assignmentID, action string) (string, *Assignment, *Course, bool) {
+	tenantID := getContextTenant(r)
+
+	assignment, err := s.getAssignment(assignmentID, tenantID)
+	if err != nil {
+		log.Printf("Assignment not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Assignment not found")
+		return "", nil, nil, false
+	}
+
+	course, err := s.getCourse(assignment.CourseID, tenantID)
+	if err != nil {
+		log.Printf("Course not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return "", nil, nil, false
+	}
+
+	user, _ := getContextUser(r)
+	currentUserID, _ := user["id"].(string)
+
+	// Unpublished assignments do not exist for students
+	if contains(course.StudentIDs, currentUserID) {
+		unpublished, err := s.unpublishedAssignments(r.Context(), course, time.Now())
+		if err != nil {
+			log.Printf("Failed to get module items: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+			return "", nil, nil, false
+		}
+		if unpublished[assignment.ID] {
+			respondWithError(w, http.StatusNotFound, "Assignment not found")
+			return "", nil, nil, false
+		}
+	}
+
+	instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get course sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+		return "", nil, nil, false
+	}
+
+	locked, err := s.contentLocked(r.Context(), course, currentUserID, PrerequisiteTargetAssignment, assignment.ID)
+	if err != nil {
+		log.Printf("Failed to evaluate prerequisites: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to evaluate prerequisites")
+		return "", nil, nil, false
+	}
+
+	userID, ok := s.authorize(w, r, action, &models.ResourceInput{
+		Type: "assignment",
+		Key:  assignment.ID,
+		Attributes: map[string]interface{}{
+			"courseId":      course.ID,
+			"teacherId":     course.TeacherID,
+			"instructorIds": instructorIDs,
+			"studentIds":    course.StudentIDs,
+			"locked":        locked,
 		},
 	})
+	if !ok {
+		return "", nil, nil, false
+	}
+
+	return userID, assignment, course, true
+}
+
+// loadCourse loads a course and checks that the current user may perform
+// action on it. It writes an error response and returns false when the
+// request must not proceed.
+func (s *LMSService) loadCourse(w http.ResponseWriter, r *http.Request, courseID, action string) (string, *Course, bool) {
+	course, err := s.getCourse(courseID, getContextTenant(r))
+	if err != nil {
+		log.Printf("Course not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return "", nil, false
+	}
+
+	instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get course sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+		return "", nil, false
+	}
+
+	userID, ok := s.authorize(w, r, action, &models.ResourceInput{
+		Type: "course",
+		Key:  course.ID,
+		Attributes: map[string]interface{}{
+			"teacherId":     course.TeacherID,
+			"studentIds":    course.StudentIDs,
+			"instructorIds": instructorIDs,
+			"status":        course.Status,
+		},
+	})
+	if !ok {
+		return "", nil, false
+	}
+
+	return userID, course, true
+}
+
+// syncCourse pushes the course attributes used by policy conditions to
+// Permit.io. Instructors of all sections are synced as instructorIds.
+func (s *LMSService) syncCourse(ctx context.Context, course *Course) error {
+	instructorIDs, err := s.courseInstructorIDs(ctx, course)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.permit.Api.SyncResource(ctx, &models.ResourceInput{
+		Type:   "course",
+		Key:    course.ID,
+		Tenant: course.TenantID,
+		Attributes: map[string]interface{}{
+			"teacherId":     course.TeacherID,
+			"studentIds":    course.StudentIDs,
+			"instructorIds": instructorIDs,
+			"status":        course.Status,
+			"termId":        course.TermID,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sync course: %w", err)
+	}
+	return nil
+}
+
+// authorize checks with Permit.io whether the current user may perform action
+// on resource in the current tenant. It writes an error response and returns
+// false when the request must not proceed.
+func (s *LMSService) authorize(w http.ResponseWriter, r *http.Request, action string, resource *models.ResourceInput) (string, bool) {
+	user, ok := getContextUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return "", false
+	}
+
+	userID, _ := user["id"].(string)
+	resource.Tenant = getContextTenant(r)
+
+	allowed, err := s.permit.Check(r.Context(), userID, action, resource)
+	if err != nil {
+		log.Printf("Error checking permission: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return "", false
+	}
+
+	if !allowed {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("Not authorized to %s this %s", action, resource.Type))
+		return "", false
+	}
+
+	return userID, true
 }
 
 // CreateCourse handles course creation
@@ -277,13 +581,18 @@ func (s *LMSService) CreateCourse(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userID, _ := user["id"].(string)
-	userRole, _ := user["role"].(string)
+	userRoles, _ := user["roles"].([]string)
+	tenantID := getContextTenant(r)
 
 	// Parse request body
 	var courseData struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		TeacherID   string `json:"teacherId"`
+		Title           string `json:"title"`
+		Description     string `json:"description"`
+		TeacherID       string `json:"teacherId"`
+		TermID          string `json:"termId"`
+		EnrollmentStart string `json:"enrollmentStart"`
+		EnrollmentEnd   string `json:"enrollmentEnd"`
+		Timezone        string `json:"timezone"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&courseData); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
@@ -291,7 +600,7 @@ func (s *LMSService) CreateCourse(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Set teacher ID to current user if not provided or not admin
-	if courseData.TeacherID == "" || userRole != "admin" {
+	if courseData.TeacherID == "" || !contains(userRoles, "admin") {
 		courseData.TeacherID = userID
 	}
 
@@ -301,13 +610,48 @@ func (s *LMSService) CreateCourse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Deadlines without a time of day end at 23:59:59 in this timezone
+	if courseData.Timezone == "" {
+		courseData.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(courseData.Timezone); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Timezone must be an IANA timezone name such as Europe/Berlin")
+		return
+	}
+
+	// The enrollment window defaults to the term dates
+	if courseData.TermID != "" {
+		term, err := s.getTerm(courseData.TermID, tenantID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Term not found")
+			return
+		}
+		if courseData.EnrollmentStart == "" {
+			courseData.EnrollmentStart = term.StartDate
+		}
+		if courseData.EnrollmentEnd == "" {
+			courseData.EnrollmentEnd = term.EndDate
+		}
+	}
+
+	for _, date := range []string{courseData.EnrollmentStart, courseData.EnrollmentEnd} {
+		if date == "" {
+			continue
+		}
+		if _, err := parseStartDate(date, time.UTC); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Enrollment dates must be RFC3339 timestamps or YYYY-MM-DD dates")
+			return
+		}
+	}
+
 	// Check if user can create a course using Permit
 	allowed, err := s.permit.Check(
 		r.Context(),
 		userID,
 		"create",
 		&models.ResourceInput{
-			Type: "course",
+			Type:   "course",
+			Tenant: tenantID,
 		},
 	)
 
@@ -322,27 +666,6 @@ func (s *LMSService) CreateCourse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set teacher ID if not provided (default to current user)
-	if newCourse.TeacherID == "" {
-		newCourse.TeacherID = userID
-	}
-
-	// Check if setting teacher ID for another user (admin only)
-	if newCourse.TeacherID != userID {
-		isAdmin := false
-		for _, role := range user["roles"].([]string) {
-			if role == "admin" {
-				isAdmin = true
-				break
-			}
-		}
-
-		if !isAdmin {
-			respondWithError(w, http.StatusForbidden, "Only admins can create courses for other teachers")
-			return
-		}
-	}
-
 	// Create course document in Appwrite
 	doc, err := s.db.CreateDocument(
 		r.Context(),
@@ -350,10 +673,16 @@ func (s *LMSService) CreateCourse(w http.ResponseWriter, r *http.Request) {
 		s.collectionID,
 		"unique()", // Let Appwrite generate a unique ID
 		map[string]interface{}{
-			"title":       courseData.Title,
-			"description": courseData.Description,
-			"teacherId":   courseData.TeacherID,
-			"studentIds":  []string{},
+			"title":           courseData.Title,
+			"description":     courseData.Description,
+			"teacherId":       courseData.TeacherID,
+			"studentIds":      []string{},
+			"tenantId":        tenantID,
+			"termId":          courseData.TermID,
+			"status":          CourseStatusDraft, // Not enrollable until published
+			"enrollmentStart": courseData.EnrollmentStart,
+			"enrollmentEnd":   courseData.EnrollmentEnd,
+			"timezone":        courseData.Timezone,
 		},
 	)
 
@@ -364,14 +693,13 @@ func (s *LMSService) CreateCourse(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Sync with Permit.io for fine-grained access control
-	_, err = s.permit.Api.SyncResource(context.Background(), &models.ResourceInput{
-		Type: "course",
-		Key:  doc.Get("$id").(string),
-		Attributes: map[string]interface{}{
-			"teacherId":   courseData.TeacherID,
-			"title":       courseData.Title,
-			"description": courseData.Description,
-		},
+	err = s.syncCourse(context.Background(), &Course{
+		ID:         doc.Get("$id").(string),
+		TeacherID:  courseData.TeacherID,
+		StudentIDs: []string{},
+		TenantID:   tenantID,
+		TermID:     courseData.TermID,
+		Status:     CourseStatusDraft,
 	})
 
 	if err != nil {
@@ -390,7 +718,16 @@ func (s *LMSService) CreateCourse(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *LMSService) EnrollInCourse(w http.ResponseWriter, r *http.Request) {
-	// ...
+	// Get user info from context
+	user, ok := getContextUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	userID, _ := user["id"].(string)
+	userRoles, _ := user["roles"].([]string)
+	tenantID := getContextTenant(r)
 
 	// Parse request body to get course ID
 	var requestData struct {
@@ -409,7 +746,7 @@ func (s *LMSService) EnrollInCourse(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user can enroll in courses
-	if userRole != "student" {
+	if !contains(userRoles, "student") {
 		http.Error(w, "Only students can enroll in courses", http.StatusForbidden)
 		return
 	}
@@ -440,6 +777,18 @@ func (s *LMSService) EnrollInCourse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Courses of other organizations are invisible to the user
+	if course.TenantID != tenantID {
+		http.Error(w, "Course not found", http.StatusNotFound)
+		return
+	}
+
+	// Only published courses inside their enrollment window accept students
+	if err := checkEnrollmentOpen(&course, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Check if student is already enrolled
 	for _, studentID := range course.StudentIDs {
 		if studentID == userID {
@@ -448,15 +797,22 @@ func (s *LMSService) EnrollInCourse(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Prerequisite courses must be completed unless an instructor exempted
+	// the student
+	reason, err := s.unmetCoursePrerequisite(r.Context(), &course, userID)
+	if err != nil {
+		log.Printf("Failed to check course prerequisites: %v", err)
+		http.Error(w, "Failed to check course prerequisites", http.StatusInternalServerError)
+		return
+	}
+	if reason != "" {
+		http.Error(w, reason, http.StatusForbidden)
+		return
+	}
+
 	// Add student to course
 	course.StudentIDs = append(course.StudentIDs, userID)
 
-	// Update course in Appwrite
-	collectionID := os.Getenv("APPWRITE_COLLECTION_ID")
-	if collectionID == "" {
-		collectionID = "courses"
-	}
-
 	// Update document
 	_, err = s.db.UpdateDocument(
 		s.databaseID,
@@ -473,8 +829,10 @@ func (s *LMSService) EnrollInCourse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// In a real app, you would update permissions in Permit.io here
-	// to allow the student to access the course resources
+	// Sync the enrollment with Permit.io
+	if err := s.syncCourse(context.Background(), &course); err != nil {
+		log.Printf("Warning: Failed to sync course with Permit.io: %v", err)
+	}
 
 	// Return success
 	w.Header().Set("Content-Type", "application/json")
@@ -511,6 +869,16 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, map[string]string{"error": message})
 }
 
+// contains reports whether value is present in list
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // getContextUser extracts user information from request context
 func getContextUser(r *http.Request) (map[string]interface{}, bool) {
 	user, ok := r.Context().Value("user").(map[string]interface{})
@@ -541,6 +909,14 @@ func main() {
 		log.Fatalf("Failed to initialize services: %v", err)
 	}
 
+	// One-off migration of prefs-based roles: `go run . migrate-roles`
+	if len(os.Args) > 1 && os.Args[1] == "migrate-roles" {
+		if err := service.MigrateRoles(context.Background()); err != nil {
+			log.Fatalf("Role migration failed: %v", err)
+		}
+		return
+	}
+
 	// Set up router
 	r := mux.NewRouter()
 
@@ -572,6 +948,132 @@ func main() {
 	api.HandleFunc("/courses", service.GetCourses).Methods("GET")
 	api.HandleFunc("/courses", service.CreateCourse).Methods("POST")
 	api.HandleFunc("/courses/{id}/enroll", service.EnrollInCourse).Methods("POST")
+	api.HandleFunc("/courses/{id}/prerequisite-courses", service.UpdateCoursePrerequisites).Methods("PUT")
+	api.HandleFunc("/courses/{id}/prerequisite-overrides", service.OverrideCoursePrerequisites).Methods("POST")
+	api.HandleFunc("/courses/{id}/prerequisite-overrides/{studentId}", service.RevokeCoursePrerequisiteOverride).Methods("DELETE")
+
+	// Term and course lifecycle routes
+	api.HandleFunc("/terms", service.ListTerms).Methods("GET")
+	api.HandleFunc("/terms", service.CreateTerm).Methods("POST")
+	api.HandleFunc("/courses/{id}/status", service.UpdateCourseStatus).Methods("PUT")
+
+	// Section routes
+	api.HandleFunc("/courses/{id}/sections", service.ListSections).Methods("GET")
+	api.HandleFunc("/courses/{id}/sections", service.CreateSection).Methods("POST")
+	api.HandleFunc("/sections/{id}/instructors", service.UpdateSectionInstructors).Methods("PUT")
+	api.HandleFunc("/sections/{id}/enroll", service.EnrollInSection).Methods("POST")
+	api.HandleFunc("/sections/{id}/due-dates", service.SetSectionDueDate).Methods("PUT")
+
+	// Module routes
+	api.HandleFunc("/courses/{id}/modules", service.ListModules).Methods("GET")
+	api.HandleFunc("/courses/{id}/modules", service.CreateModule).Methods("POST")
+	api.HandleFunc("/courses/{id}/modules/order", service.ReorderModules).Methods("PUT")
+	api.HandleFunc("/modules/{id}", service.UpdateModule).Methods("PUT")
+	api.HandleFunc("/modules/{id}", service.DeleteModule).Methods("DELETE")
+	api.HandleFunc("/modules/{id}/items/order", service.ReorderModuleItems).Methods("PUT")
+	api.HandleFunc("/modules/{id}/lessons", service.CreateLesson).Methods("POST")
+	api.HandleFunc("/modules/{id}/assignments", service.AddModuleAssignment).Methods("POST")
+	api.HandleFunc("/module-items/{id}", service.UpdateModuleItem).Methods("PUT")
+	api.HandleFunc("/module-items/{id}", service.DeleteModuleItem).Methods("DELETE")
+	api.HandleFunc("/lessons/{id}", service.GetLesson).Methods("GET")
+	api.HandleFunc("/lessons/{id}", service.UpdateLesson).Methods("PUT")
+	api.HandleFunc("/lessons/{id}/files", service.UploadLessonFile).Methods("POST")
+	api.HandleFunc("/lessons/{id}/files/{fileId}", service.DownloadLessonFile).Methods("GET")
+
+	// Prerequisite routes
+	api.HandleFunc("/courses/{id}/prerequisites", service.ListPrerequisites).Methods("GET")
+	api.HandleFunc("/modules/{id}/prerequisites", service.UpdateModulePrerequisites).Methods("PUT")
+	api.HandleFunc("/assignments/{id}/prerequisites", service.UpdateAssignmentPrerequisites).Methods("PUT")
+	api.HandleFunc("/lessons/{id}/complete", service.CompleteLesson).Methods("POST")
+
+	// Extension routes
+	api.HandleFunc("/assignments/{id}/extensions", service.ListExtensions).Methods("GET")
+	api.HandleFunc("/assignments/{id}/extensions", service.GrantExtension).Methods("POST")
+
+	// Gradebook routes
+	api.HandleFunc("/courses/{id}/grade-categories", service.ListGradeCategories).Methods("GET")
+	api.HandleFunc("/courses/{id}/grade-categories", service.UpdateGradeCategories).Methods("PUT")
+	api.HandleFunc("/courses/{id}/grade-scale", service.UpdateGradeScale).Methods("PUT")
+	api.HandleFunc("/courses/{id}/gradebook", service.GetGradebook).Methods("GET")
+	api.HandleFunc("/courses/{id}/gradebook/export", service.ExportGradebook).Methods("GET")
+	api.HandleFunc("/courses/{id}/gradebook/import", service.ImportGradebook).Methods("POST")
+	api.HandleFunc("/courses/{id}/grades", service.GetMyGrades).Methods("GET")
+
+	// Rubric routes
+	api.HandleFunc("/assignments/{id}/rubric", service.GetRubric).Methods("GET")
+	api.HandleFunc("/assignments/{id}/rubric", service.UpdateRubric).Methods("PUT")
+
+	// Quiz routes
+	api.HandleFunc("/assignments/{id}/quiz", service.GetQuiz).Methods("GET")
+	api.HandleFunc("/assignments/{id}/quiz", service.UpdateQuiz).Methods("PUT")
+	api.HandleFunc("/assignments/{id}/quiz/start", service.StartQuiz).Methods("POST")
+	api.HandleFunc("/assignments/{id}/quiz/draw", service.DrawQuizQuestions).Methods("POST")
+
+	// Autograder routes
+	api.HandleFunc("/assignments/{id}/test-suite", service.GetTestSuite).Methods("GET")
+	api.HandleFunc("/assignments/{id}/test-suite", service.UpdateTestSuite).Methods("PUT")
+	api.HandleFunc("/assignments/{id}/autograde", service.RerunAssignmentAutograder).Methods("POST")
+	api.HandleFunc("/submissions/{id}/autograde", service.GetAutogradeResults).Methods("GET")
+	api.HandleFunc("/submissions/{id}/autograde", service.RerunAutograder).Methods("POST")
+
+	// Similarity routes
+	api.HandleFunc("/assignments/{id}/similarity", service.GetSimilarityReport).Methods("GET")
+	api.HandleFunc("/assignments/{id}/similarity", service.StartSimilarityCheck).Methods("POST")
+
+	// Question bank routes
+	api.HandleFunc("/question-banks", service.ListQuestionBanks).Methods("GET")
+	api.HandleFunc("/question-banks", service.CreateQuestionBank).Methods("POST")
+	api.HandleFunc("/question-banks/{id}", service.GetQuestionBank).Methods("GET")
+	api.HandleFunc("/question-banks/{id}/questions", service.AddBankQuestion).Methods("POST")
+	api.HandleFunc("/question-banks/{id}/questions/{questionId}", service.DeleteBankQuestion).Methods("DELETE")
+	api.HandleFunc("/question-banks/{id}/sharing", service.ShareQuestionBank).Methods("PUT")
+
+	// Grade release routes
+	api.HandleFunc("/assignments/{id}/grade-release", service.UpdateGradeRelease).Methods("PUT")
+	api.HandleFunc("/assignments/{id}/release-grades", service.ReleaseGrades).Methods("POST")
+
+	// Blind grading routes
+	api.HandleFunc("/assignments/{id}/blind-grading", service.UpdateBlindGrading).Methods("PUT")
+	api.HandleFunc("/assignments/{id}/submissions", service.ListSubmissions).Methods("GET")
+
+	// Grade history and regrade routes
+	api.HandleFunc("/submissions/{id}/grade-history", service.GetGradeHistory).Methods("GET")
+	api.HandleFunc("/submissions/{id}/regrade-requests", service.CreateRegradeRequest).Methods("POST")
+	api.HandleFunc("/assignments/{id}/regrade-requests", service.ListRegradeRequests).Methods("GET")
+	api.HandleFunc("/regrade-requests/{id}", service.ResolveRegradeRequest).Methods("PUT")
+
+	// Peer review routes
+	api.HandleFunc("/assignments/{id}/peer-review", service.UpdatePeerReviewSettings).Methods("PUT")
+	api.HandleFunc("/assignments/{id}/peer-reviews/assign", service.AssignPeerReviews).Methods("POST")
+	api.HandleFunc("/assignments/{id}/peer-reviews/grade", service.GradePeerReviews).Methods("POST")
+	api.HandleFunc("/assignments/{id}/peer-reviews", service.ListPeerReviews).Methods("GET")
+	api.HandleFunc("/submissions/{id}/peer-reviews", service.ListSubmissionPeerReviews).Methods("GET")
+	api.HandleFunc("/peer-reviews/{id}", service.GetPeerReview).Methods("GET")
+	api.HandleFunc("/peer-reviews/{id}", service.SubmitPeerReview).Methods("PUT")
+	api.HandleFunc("/peer-reviews/{id}/attachments/{attachmentId}", service.DownloadPeerReviewAttachment).Methods("GET")
+
+	// Submission routes
+	api.HandleFunc("/assignments/{id}/attempts", service.ListAttempts).Methods("GET")
+	api.HandleFunc("/assignments/{id}/draft", service.GetDraft).Methods("GET")
+	api.HandleFunc("/assignments/{id}/draft", service.SaveDraft).Methods("PUT")
+	api.HandleFunc("/assignments/{id}/attachments", service.UploadAttachment).Methods("POST")
+	api.HandleFunc("/attachments/{id}/download", service.DownloadAttachment).Methods("GET")
+
+	// Admin user management routes
+	api.HandleFunc("/admin/users", service.ListUsers).Methods("GET")
+	api.HandleFunc("/admin/users/{id}/role", service.UpdateUserRole).Methods("PUT")
+	api.HandleFunc("/admin/users/{id}/deactivate", service.DeactivateUser).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/reactivate", service.ReactivateUser).Methods("POST")
+	api.HandleFunc("/admin/users/{id}/impersonate", service.ImpersonateUser).Methods("GET")
+
+	// Run queued autograde runs in the background
+	workers, err := strconv.Atoi(getEnv("AUTOGRADER_WORKERS", "2"))
+	if err != nil {
+		log.Fatalf("Invalid AUTOGRADER_WORKERS: %v", err)
+	}
+	if workers > 0 {
+		go service.RunAutograder(context.Background(), workers)
+	}
 
 	// Start server
 	port := getEnv("PORT", "8080")
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// prefsRoles extracts roles from legacy account preferences. Older accounts
+// stored either a "roles" list or a single "role" string.
+func prefsRoles(prefs map[string]interface{}) []string {
+	var roles []string
+	if prefRoles, ok := prefs["roles"].([]interface{}); ok {
+		for _, r := range prefRoles {
+			if role, ok := r.(string); ok && contains(validRoles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	if role, ok := prefs["role"].(string); ok && contains(validRoles, role) && !contains(roles, role) {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// MigrateRoles moves roles stored in user preferences to Appwrite labels and
+// Permit.io role assignments, then removes them from the preferences.
+//
+// Preferences were writable by users themselves, so an "admin" role found there
+// is only migrated for user IDs listed in MIGRATION_ADMIN_USER_IDS; any other
+// admin claim is dropped and logged for review.
+func (s *LMSService) MigrateRoles(ctx context.Context) error {
+	trustedAdmins := strings.Split(getEnv("MIGRATION_ADMIN_USER_IDS", ""), ",")
+
+	accounts, err := s.listAllUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	migrated, skipped := 0, 0
+	for i := range accounts {
+		account := &accounts[i]
+
+		legacyRoles := prefsRoles(account.Prefs)
+		if len(legacyRoles) == 0 {
+			continue
+		}
+
+		// Labels already set by an admin take precedence over preferences
+		if len(account.Roles()) > 0 {
+			log.Printf("User %s already has roles %v, ignoring prefs roles %v",
+				account.ID, account.Roles(), legacyRoles)
+			skipped++
+		} else {
+			var roles []string
+			for _, role := range legacyRoles {
+				if role == "admin" && !contains(trustedAdmins, account.ID) {
+					log.Printf("Dropping untrusted admin role from prefs of user %s", account.ID)
+					continue
+				}
+				roles = append(roles, role)
+			}
+
+			if len(roles) > 0 {
+				if err := s.setUserRoles(ctx, account, roles); err != nil {
+					return fmt.Errorf("failed to migrate roles for user %s: %w", account.ID, err)
+				}
+				migrated++
+			}
+		}
+
+		// Remove the roles from preferences so nothing reads them again
+		delete(account.Prefs, "roles")
+		delete(account.Prefs, "role")
+		if _, err := s.users.UpdatePrefs(account.ID, account.Prefs); err != nil {
+			return fmt.Errorf("failed to clear prefs roles for user %s: %w", account.ID, err)
+		}
+	}
+
+	log.Printf("Role migration complete: %d users migrated, %d skipped", migrated, skipped)
+	return nil
+}
@@ -0,0 +1,1297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// Course content is organized in ordered modules. A module holds ordered
+// items, each a lesson or an assignment of the course. Modules and items can
+// have a publish date; students see a module once it is published, and an
+// item once both the item and its module are published. Content is read with
+// the course read permission, by the course's staff and enrolled students.
+
+// Module item types
+const (
+	ModuleItemLesson     = "lesson"
+	ModuleItemAssignment = "assignment"
+)
+
+// maxLessonFileSizeMB is the upload limit for lesson files
+const maxLessonFileSizeMB = 100
+
+// Module is an ordered section of a course's content
+type Module struct {
+	ID          string       `json:"$id"`
+	CourseID    string       `json:"courseId"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Position    int          `json:"position"`
+	PublishDate string       `json:"publishDate"` // RFC3339, empty means published
+	TenantID    string       `json:"tenantId"`
+	CreatedAt   string       `json:"createdAt"`
+	Published   bool         `json:"published"`
+	Locked      bool         `json:"locked"` // For the requesting student
+	Items       []ModuleItem `json:"items,omitempty"`
+}
+
+// ModuleItem places a lesson or an assignment in a module
+type ModuleItem struct {
+	ID          string `json:"$id"`
+	ModuleID    string `json:"moduleId"`
+	CourseID    string `json:"courseId"`
+	Type        string `json:"type"`   // lesson or assignment
+	ItemID      string `json:"itemId"` // ID of the lesson or assignment
+	Position    int    `json:"position"`
+	PublishDate string `json:"publishDate"` // RFC3339, empty means published
+	TenantID    string `json:"tenantId"`
+	Title       string `json:"title,omitempty"`
+	Published   bool   `json:"published"`
+	Locked      bool   `json:"locked"` // For the requesting student
+}
+
+// Lesson is course material: rich text with links, an embedded video and
+// files. Files are stored in the course files bucket and listed by parallel
+// FileIDs and FileNames.
+type Lesson struct {
+	ID        string   `json:"$id"`
+	ModuleID  string   `json:"moduleId"`
+	CourseID  string   `json:"courseId"`
+	Title     string   `json:"title"`
+	Body      string   `json:"body"` // HTML
+	Links     []string `json:"links"`
+	VideoURL  string   `json:"videoUrl"` // Embedded video
+	FileIDs   []string `json:"fileIds"`
+	FileNames []string `json:"fileNames"`
+	TenantID  string   `json:"tenantId"`
+	CreatedAt string   `json:"createdAt"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+func modulesCollectionID() string {
+	return getEnv("APPWRITE_MODULES_COLLECTION_ID", "modules")
+}
+
+func moduleItemsCollectionID() string {
+	return getEnv("APPWRITE_MODULE_ITEMS_COLLECTION_ID", "module_items")
+}
+
+func lessonsCollectionID() string {
+	return getEnv("APPWRITE_LESSONS_COLLECTION_ID", "lessons")
+}
+
+func courseFilesBucketID() string {
+	return getEnv("APPWRITE_COURSE_FILES_BUCKET_ID", "course_files")
+}
+
+// normalizePublishDate validates a publish date from a request and returns it
+// as an RFC3339 instant in UTC. Plain dates publish at the start of that day
+// in the course's timezone. An empty date publishes right away.
+func normalizePublishDate(value string, course *Course) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	loc, err := courseLocation(course)
+	if err != nil {
+		return "", err
+	}
+	publishDate, err := parseStartDate(value, loc)
+	if err != nil {
+		return "", err
+	}
+	return publishDate.UTC().Format(time.RFC3339), nil
+}
+
+// isPublished reports whether content with the publish date is published at
+// the given time
+func isPublished(publishDate string, now time.Time) bool {
+	if publishDate == "" {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, publishDate)
+	if err != nil {
+		log.Printf("Warning: invalid publish date %q", publishDate)
+		return false
+	}
+	return !now.Before(t)
+}
+
+// unpublishedAssignments returns the IDs of the course's assignments that
+// students cannot see yet. Assignments outside every module are published;
+// those in modules are published once one of their items and its module are.
+func (s *LMSService) unpublishedAssignments(ctx context.Context, course *Course, now time.Time) (map[string]bool, error) {
+	modules, err := s.listCourseModules(ctx, course)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.listModuleItems(ctx, course, "")
+	if err != nil {
+		return nil, err
+	}
+
+	modulePublished := make(map[string]bool)
+	for _, module := range modules {
+		modulePublished[module.ID] = isPublished(module.PublishDate, now)
+	}
+
+	unpublished := make(map[string]bool)
+	published := make(map[string]bool)
+	for _, item := range items {
+		if item.Type != ModuleItemAssignment {
+			continue
+		}
+		if modulePublished[item.ModuleID] && isPublished(item.PublishDate, now) {
+			published[item.ItemID] = true
+		} else {
+			unpublished[item.ItemID] = true
+		}
+	}
+	for id := range published {
+		delete(unpublished, id)
+	}
+	return unpublished, nil
+}
+
+// validateLessonURLs returns an error unless links and the video URL are
+// absolute http(s) URLs
+func validateLessonURLs(links []string, videoURL string) error {
+	for _, link := range append(links, videoURL) {
+		if link == "" {
+			continue
+		}
+		parsed, err := url.Parse(link)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid URL %q", link)
+		}
+	}
+	return nil
+}
+
+// loadCourseContent loads a course for reading its content. Staff, that is
+// the teacher, section instructors and admins, see unpublished content; other
+// readers must be enrolled. It writes an error response and returns false
+// when the request must not proceed.
+func (s *LMSService) loadCourseContent(w http.ResponseWriter, r *http.Request, courseID string) (*Course, bool, bool) {
+	userID, course, ok := s.loadCourse(w, r, courseID, "read")
+	if !ok {
+		return nil, false, false
+	}
+
+	user, _ := getContextUser(r)
+	roles, _ := user["roles"].([]string)
+	if course.TeacherID == userID || contains(roles, "admin") {
+		return course, true, true
+	}
+
+	instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get course sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+		return nil, false, false
+	}
+	if contains(instructorIDs, userID) {
+		return course, true, true
+	}
+
+	if !contains(course.StudentIDs, userID) {
+		respondWithError(w, http.StatusForbidden, "Only enrolled students can view course content")
+		return nil, false, false
+	}
+	return course, false, true
+}
+
+// getModule loads a module by ID. Modules of other tenants are reported as
+// not found.
+func (s *LMSService) getModule(moduleID, tenantID string) (*Module, error) {
+	doc, err := s.db.GetDocument(s.databaseID, modulesCollectionID(), moduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	var module Module
+	if err := json.Unmarshal([]byte(doc.(string)), &module); err != nil {
+		return nil, fmt.Errorf("failed to parse module: %w", err)
+	}
+
+	if module.TenantID != tenantID {
+		return nil, fmt.Errorf("module %s not found", moduleID)
+	}
+	return &module, nil
+}
+
+// getModuleItem loads a module item by ID. Items of other tenants are
+// reported as not found.
+func (s *LMSService) getModuleItem(itemID, tenantID string) (*ModuleItem, error) {
+	doc, err := s.db.GetDocument(s.databaseID, moduleItemsCollectionID(), itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	var item ModuleItem
+	if err := json.Unmarshal([]byte(doc.(string)), &item); err != nil {
+		return nil, fmt.Errorf("failed to parse module item: %w", err)
+	}
+
+	if item.TenantID != tenantID {
+		return nil, fmt.Errorf("module item %s not found", itemID)
+	}
+	return &item, nil
+}
+
+// getLesson loads a lesson by ID. Lessons of other tenants are reported as
+// not found.
+func (s *LMSService) getLesson(lessonID, tenantID string) (*Lesson, error) {
+	doc, err := s.db.GetDocument(s.databaseID, lessonsCollectionID(), lessonID)
+	if err != nil {
+		return nil, err
+	}
+
+	var lesson Lesson
+	if err := json.Unmarshal([]byte(doc.(string)), &lesson); err != nil {
+		return nil, fmt.Errorf("failed to parse lesson: %w", err)
+	}
+
+	if lesson.TenantID != tenantID {
+		return nil, fmt.Errorf("lesson %s not found", lessonID)
+	}
+	return &lesson, nil
+}
+
+// listCourseModules returns the modules of a course in order
+func (s *LMSService) listCourseModules(ctx context.Context, course *Course) ([]Module, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		modulesCollectionID(),
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list modules: %w", err)
+	}
+
+	var modules []Module
+	if err := json.Unmarshal([]byte(documents.(string)), &modules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal modules: %w", err)
+	}
+
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Position < modules[j].Position
+	})
+	return modules, nil
+}
+
+// listModuleItems returns the items of a course in order, optionally only
+// those of one module
+func (s *LMSService) listModuleItems(ctx context.Context, course *Course, moduleID string) ([]ModuleItem, error) {
+	queries := []interface{}{
+		query.Equal("courseId", course.ID),
+		query.Equal("tenantId", course.TenantID),
+	}
+	if moduleID != "" {
+		queries = append(queries, query.Equal("moduleId", moduleID))
+	}
+
+	documents, err := s.db.ListDocuments(ctx, s.databaseID, moduleItemsCollectionID(), queries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list module items: %w", err)
+	}
+
+	var items []ModuleItem
+	if err := json.Unmarshal([]byte(documents.(string)), &items); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal module items: %w", err)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Position < items[j].Position
+	})
+	return items, nil
+}
+
+// listCourseLessons returns the lessons of a course
+func (s *LMSService) listCourseLessons(ctx context.Context, course *Course) ([]Lesson, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		lessonsCollectionID(),
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lessons: %w", err)
+	}
+
+	var lessons []Lesson
+	if err := json.Unmarshal([]byte(documents.(string)), &lessons); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lessons: %w", err)
+	}
+	return lessons, nil
+}
+
+// createModuleItem adds a lesson or assignment to a module at position
+func (s *LMSService) createModuleItem(ctx context.Context, module *Module, itemType, itemID, publishDate string, position int) (*ModuleItem, error) {
+	item := ModuleItem{
+		ModuleID:    module.ID,
+		CourseID:    module.CourseID,
+		Type:        itemType,
+		ItemID:      itemID,
+		Position:    position,
+		PublishDate: publishDate,
+		TenantID:    module.TenantID,
+	}
+	doc, err := s.db.CreateDocument(
+		ctx,
+		s.databaseID,
+		moduleItemsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"moduleId":    item.ModuleID,
+			"courseId":    item.CourseID,
+			"type":        item.Type,
+			"itemId":      item.ItemID,
+			"position":    item.Position,
+			"publishDate": item.PublishDate,
+			"tenantId":    item.TenantID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create module item: %w", err)
+	}
+	item.ID = fmt.Sprint(doc.Get("$id"))
+	item.Published = isPublished(publishDate, time.Now())
+	return &item, nil
+}
+
+// deleteModuleItem removes an item from its module. Lessons are deleted with
+// their files and the prerequisites that require them; assignments stay in
+// the course.
+func (s *LMSService) deleteModuleItem(ctx context.Context, course *Course, item *ModuleItem) error {
+	if item.Type == ModuleItemLesson {
+		lesson, err := s.getLesson(item.ItemID, item.TenantID)
+		if err != nil {
+			return fmt.Errorf("lesson not found: %w", err)
+		}
+		for _, fileID := range lesson.FileIDs {
+			if _, err := s.storage.DeleteFile(courseFilesBucketID(), fileID); err != nil {
+				log.Printf("Warning: Failed to delete lesson file %s: %v", fileID, err)
+			}
+		}
+		if _, err := s.db.DeleteDocument(s.databaseID, lessonsCollectionID(), lesson.ID); err != nil {
+			return fmt.Errorf("failed to delete lesson: %w", err)
+		}
+		if err := s.deletePrerequisites(ctx, course, "itemId", lesson.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.db.DeleteDocument(s.databaseID, moduleItemsCollectionID(), item.ID); err != nil {
+		return fmt.Errorf("failed to delete module item: %w", err)
+	}
+	return nil
+}
+
+// reorder sets the positions of documents to the order of ids, which must
+// hold exactly the current IDs
+func (s *LMSService) reorder(collectionID string, current, ids []string) error {
+	if len(ids) != len(current) {
+		return fmt.Errorf("expected %d IDs, got %d", len(current), len(ids))
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if !contains(current, id) || seen[id] {
+			return fmt.Errorf("unexpected or repeated ID %q", id)
+		}
+		seen[id] = true
+	}
+
+	for position, id := range ids {
+		_, err := s.db.UpdateDocument(
+			s.databaseID,
+			collectionID,
+			id,
+			map[string]interface{}{
+				"position": position,
+			},
+			nil, // permissions
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update position of %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// loadModule loads a module and checks that the current user may perform
+// action on its course
+func (s *LMSService) loadModule(w http.ResponseWriter, r *http.Request, moduleID, action string) (string, *Module, *Course, bool) {
+	module, err := s.getModule(moduleID, getContextTenant(r))
+	if err != nil {
+		log.Printf("Module not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Module not found")
+		return "", nil, nil, false
+	}
+
+	userID, course, ok := s.loadCourse(w, r, module.CourseID, action)
+	if !ok {
+		return "", nil, nil, false
+	}
+	return userID, module, course, true
+}
+
+// ListModules returns the modules of a course with their items in order.
+// Students only see published modules and items, and whether their
+// prerequisites lock them.
+func (s *LMSService) ListModules(w http.ResponseWriter, r *http.Request) {
+	course, staff, ok := s.loadCourseContent(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	modules, err := s.listCourseModules(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get modules: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve modules")
+		return
+	}
+	items, err := s.listModuleItems(r.Context(), course, "")
+	if err != nil {
+		log.Printf("Failed to get module items: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+		return
+	}
+	lessons, err := s.listCourseLessons(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get lessons: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve lessons")
+		return
+	}
+	assignments, err := s.listCourseAssignments(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get assignments: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+
+	user, _ := getContextUser(r)
+	userID, _ := user["id"].(string)
+	student := contains(course.StudentIDs, userID)
+	progress := &contentProgress{}
+	if student {
+		progress, err = s.loadProgress(r.Context(), course, userID)
+		if err != nil {
+			log.Printf("Failed to evaluate prerequisites: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to evaluate prerequisites")
+			return
+		}
+	}
+
+	titles := make(map[string]string)
+	for _, lesson := range lessons {
+		titles[lesson.ID] = lesson.Title
+	}
+	for _, assignment := range assignments {
+		titles[assignment.ID] = assignment.Title
+	}
+
+	now := time.Now()
+	byModule := make(map[string][]ModuleItem)
+	for _, item := range items {
+		item.Title = titles[item.ItemID]
+		item.Published = isPublished(item.PublishDate, now)
+		if item.Type == ModuleItemAssignment {
+			item.Locked = progress.locked(PrerequisiteTargetAssignment, item.ItemID)
+		} else {
+			item.Locked = progress.locked(PrerequisiteTargetModule, item.ModuleID)
+		}
+		if staff || item.Published {
+			byModule[item.ModuleID] = append(byModule[item.ModuleID], item)
+		}
+	}
+
+	var visible []Module
+	for _, module := range modules {
+		module.Published = isPublished(module.PublishDate, now)
+		if !staff && !module.Published {
+			continue
+		}
+		module.Locked = progress.locked(PrerequisiteTargetModule, module.ID)
+		module.Items = byModule[module.ID]
+		visible = append(visible, module)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    visible,
+		"meta": map[string]interface{}{
+			"total": len(visible),
+		},
+	})
+}
+
+// CreateModule adds a module to the end of a course
+func (s *LMSService) CreateModule(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		PublishDate string `json:"publishDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.Title == "" {
+		respondWithError(w, http.StatusBadRequest, "Title is required")
+		return
+	}
+	publishDate, err := normalizePublishDate(requestData.PublishDate, course)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	modules, err := s.listCourseModules(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get modules: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve modules")
+		return
+	}
+
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		modulesCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"courseId":    course.ID,
+			"title":       requestData.Title,
+			"description": requestData.Description,
+			"position":    len(modules),
+			"publishDate": publishDate,
+			"tenantId":    course.TenantID,
+			"createdAt":   time.Now().Format(time.RFC3339),
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to create module: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create module")
+		return
+	}
+
+	log.Printf("User %s created module %s in course %s", userID, doc.Get("$id"), course.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    doc,
+	})
+}
+
+// UpdateModule changes the title, description and publish date of a module
+func (s *LMSService) UpdateModule(w http.ResponseWriter, r *http.Request) {
+	userID, module, course, ok := s.loadModule(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		PublishDate string `json:"publishDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.Title == "" {
+		respondWithError(w, http.StatusBadRequest, "Title is required")
+		return
+	}
+	publishDate, err := normalizePublishDate(requestData.PublishDate, course)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"title":       requestData.Title,
+		"description": requestData.Description,
+		"publishDate": publishDate,
+	}
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		modulesCollectionID(),
+		module.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update module: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update module")
+		return
+	}
+
+	log.Printf("User %s updated module %s", userID, module.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// DeleteModule deletes a module with its lessons and prerequisites. Its
+// assignments stay in the course.
+func (s *LMSService) DeleteModule(w http.ResponseWriter, r *http.Request) {
+	userID, module, course, ok := s.loadModule(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	items, err := s.listModuleItems(r.Context(), course, module.ID)
+	if err != nil {
+		log.Printf("Failed to get module items: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+		return
+	}
+	for i := range items {
+		if err := s.deleteModuleItem(r.Context(), course, &items[i]); err != nil {
+			log.Printf("Failed to delete module item: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to delete module items")
+			return
+		}
+	}
+
+	if err := s.deletePrerequisites(r.Context(), course, "targetId", module.ID); err != nil {
+		log.Printf("Failed to delete module prerequisites: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete module prerequisites")
+		return
+	}
+
+	if _, err := s.db.DeleteDocument(s.databaseID, modulesCollectionID(), module.ID); err != nil {
+		log.Printf("Failed to delete module: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete module")
+		return
+	}
+
+	log.Printf("User %s deleted module %s with %d items", userID, module.ID, len(items))
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// ReorderModules sets the order of a course's modules to the given moduleIds
+func (s *LMSService) ReorderModules(w http.ResponseWriter, r *http.Request) {
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		ModuleIDs []string `json:"moduleIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	modules, err := s.listCourseModules(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get modules: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve modules")
+		return
+	}
+	var current []string
+	for _, module := range modules {
+		current = append(current, module.ID)
+	}
+
+	if err := s.reorder(modulesCollectionID(), current, requestData.ModuleIDs); err != nil {
+		log.Printf("Failed to reorder modules: %v", err)
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to reorder modules: %v", err))
+		return
+	}
+
+	log.Printf("User %s reordered the modules of course %s", userID, course.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    requestData.ModuleIDs,
+	})
+}
+
+// ReorderModuleItems sets the order of a module's items to the given itemIds
+func (s *LMSService) ReorderModuleItems(w http.ResponseWriter, r *http.Request) {
+	userID, module, course, ok := s.loadModule(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		ItemIDs []string `json:"itemIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	items, err := s.listModuleItems(r.Context(), course, module.ID)
+	if err != nil {
+		log.Printf("Failed to get module items: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+		return
+	}
+	var current []string
+	for _, item := range items {
+		current = append(current, item.ID)
+	}
+
+	if err := s.reorder(moduleItemsCollectionID(), current, requestData.ItemIDs); err != nil {
+		log.Printf("Failed to reorder module items: %v", err)
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to reorder module items: %v", err))
+		return
+	}
+
+	log.Printf("User %s reordered the items of module %s", userID, module.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    requestData.ItemIDs,
+	})
+}
+
+// CreateLesson adds a lesson to the end of a module
+func (s *LMSService) CreateLesson(w http.ResponseWriter, r *http.Request) {
+	userID, module, course, ok := s.loadModule(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Title       string   `json:"title"`
+		Body        string   `json:"body"`
+		Links       []string `json:"links"`
+		VideoURL    string   `json:"videoUrl"`
+		PublishDate string   `json:"publishDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.Title == "" {
+		respondWithError(w, http.StatusBadRequest, "Title is required")
+		return
+	}
+	if err := validateLessonURLs(requestData.Links, requestData.VideoURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	publishDate, err := normalizePublishDate(requestData.PublishDate, course)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items, err := s.listModuleItems(r.Context(), course, module.ID)
+	if err != nil {
+		log.Printf("Failed to get module items: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+		return
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		lessonsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"moduleId":  module.ID,
+			"courseId":  course.ID,
+			"title":     requestData.Title,
+			"body":      requestData.Body,
+			"links":     requestData.Links,
+			"videoUrl":  requestData.VideoURL,
+			"fileIds":   []string{},
+			"fileNames": []string{},
+			"tenantId":  course.TenantID,
+			"createdAt": now,
+			"updatedAt": now,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to create lesson: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create lesson")
+		return
+	}
+
+	lessonID := fmt.Sprint(doc.Get("$id"))
+	item, err := s.createModuleItem(r.Context(), module, ModuleItemLesson, lessonID, publishDate, len(items))
+	if err != nil {
+		log.Printf("Failed to add lesson to module: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to add lesson to module")
+		return
+	}
+
+	log.Printf("User %s created lesson %s in module %s", userID, lessonID, module.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"lesson": doc,
+			"item":   item,
+		},
+	})
+}
+
+// AddModuleAssignment adds an assignment of the course to the end of a
+// module. An assignment can be in one module at a time.
+func (s *LMSService) AddModuleAssignment(w http.ResponseWriter, r *http.Request) {
+	userID, module, course, ok := s.loadModule(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		AssignmentID string `json:"assignmentId"`
+		PublishDate  string `json:"publishDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	publishDate, err := normalizePublishDate(requestData.PublishDate, course)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	assignment, err := s.getAssignment(requestData.AssignmentID, course.TenantID)
+	if err != nil || assignment.CourseID != course.ID {
+		respondWithError(w, http.StatusBadRequest, "Assignment is not part of the course")
+		return
+	}
+
+	items, err := s.listModuleItems(r.Context(), course, "")
+	if err != nil {
+		log.Printf("Failed to get module items: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+		return
+	}
+	position := 0
+	for _, item := range items {
+		if item.Type == ModuleItemAssignment && item.ItemID == assignment.ID {
+			respondWithError(w, http.StatusConflict, "Assignment is already in a module")
+			return
+		}
+		if item.ModuleID == module.ID {
+			position++
+		}
+	}
+
+	item, err := s.createModuleItem(r.Context(), module, ModuleItemAssignment, assignment.ID, publishDate, position)
+	if err != nil {
+		log.Printf("Failed to add assignment to module: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to add assignment to module")
+		return
+	}
+
+	log.Printf("User %s added assignment %s to module %s", userID, assignment.ID, module.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    item,
+	})
+}
+
+// UpdateModuleItem sets the publish date of a module item
+func (s *LMSService) UpdateModuleItem(w http.ResponseWriter, r *http.Request) {
+	item, err := s.getModuleItem(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil {
+		log.Printf("Module item not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Module item not found")
+		return
+	}
+
+	userID, course, ok := s.loadCourse(w, r, item.CourseID, "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		PublishDate string `json:"publishDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	publishDate, err := normalizePublishDate(requestData.PublishDate, course)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"publishDate": publishDate,
+	}
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		moduleItemsCollectionID(),
+		item.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update module item: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update module item")
+		return
+	}
+
+	log.Printf("User %s set the publish date of module item %s to %q", userID, item.ID, publishDate)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// DeleteModuleItem removes an item from its module. Removing a lesson deletes
+// it; removing an assignment keeps it in the course.
+func (s *LMSService) DeleteModuleItem(w http.ResponseWriter, r *http.Request) {
+	item, err := s.getModuleItem(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil {
+		log.Printf("Module item not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Module item not found")
+		return
+	}
+
+	userID, course, ok := s.loadCourse(w, r, item.CourseID, "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err := s.deleteModuleItem(r.Context(), course, item); err != nil {
+		log.Printf("Failed to delete module item: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete module item")
+		return
+	}
+
+	log.Printf("User %s removed %s %s from module %s", userID, item.Type, item.ItemID, item.ModuleID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// loadLesson loads a lesson for reading. Students can only read lessons that
+// are published in a published module, once the module is unlocked. It writes
+// an error response and returns false when the request must not proceed.
+func (s *LMSService) loadLesson(w http.ResponseWriter, r *http.Request, lessonID string) (string, *Lesson, *Course, bool) {
+	lesson, err := s.getLesson(lessonID, getContextTenant(r))
+	if err != nil {
+		log.Printf("Lesson not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Lesson not found")
+		return "", nil, nil, false
+	}
+
+	course, staff, ok := s.loadCourseContent(w, r, lesson.CourseID)
+	if !ok {
+		return "", nil, nil, false
+	}
+
+	module, err := s.getModule(lesson.ModuleID, lesson.TenantID)
+	if err != nil {
+		log.Printf("Module not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Lesson not found")
+		return "", nil, nil, false
+	}
+
+	if !staff {
+		items, err := s.listModuleItems(r.Context(), course, module.ID)
+		if err != nil {
+			log.Printf("Failed to get module items: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve module items")
+			return "", nil, nil, false
+		}
+
+		now := time.Now()
+		published := false
+		for _, item := range items {
+			if item.Type == ModuleItemLesson && item.ItemID == lesson.ID &&
+				isPublished(item.PublishDate, now) && isPublished(module.PublishDate, now) {
+				published = true
+			}
+		}
+		if !published {
+			// Unpublished lessons do not exist for students
+			respondWithError(w, http.StatusNotFound, "Lesson not found")
+			return "", nil, nil, false
+		}
+	}
+
+	userID, ok := s.authorizeModule(w, r, course, module, "read")
+	if !ok {
+		return "", nil, nil, false
+	}
+	return userID, lesson, course, true
+}
+
+// GetLesson returns a lesson
+func (s *LMSService) GetLesson(w http.ResponseWriter, r *http.Request) {
+	_, lesson, _, ok := s.loadLesson(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    lesson,
+	})
+}
+
+// UpdateLesson changes the title, body, links and video of a lesson
+func (s *LMSService) UpdateLesson(w http.ResponseWriter, r *http.Request) {
+	lesson, err := s.getLesson(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil {
+		log.Printf("Lesson not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Lesson not found")
+		return
+	}
+
+	userID, course, ok := s.loadCourse(w, r, lesson.CourseID, "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Title    string   `json:"title"`
+		Body     string   `json:"body"`
+		Links    []string `json:"links"`
+		VideoURL string   `json:"videoUrl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.Title == "" {
+		respondWithError(w, http.StatusBadRequest, "Title is required")
+		return
+	}
+	if err := validateLessonURLs(requestData.Links, requestData.VideoURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data := map[string]interface{}{
+		"title":     requestData.Title,
+		"body":      requestData.Body,
+		"links":     requestData.Links,
+		"videoUrl":  requestData.VideoURL,
+		"updatedAt": time.Now().Format(time.RFC3339),
+	}
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		lessonsCollectionID(),
+		lesson.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update lesson: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update lesson")
+		return
+	}
+
+	log.Printf("User %s updated lesson %s", userID, lesson.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// UploadLessonFile attaches a file to a lesson. Lesson files are served by
+// the backend only, so the bucket grants no read permissions.
+func (s *LMSService) UploadLessonFile(w http.ResponseWriter, r *http.Request) {
+	lesson, err := s.getLesson(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil {
+		log.Printf("Lesson not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Lesson not found")
+		return
+	}
+
+	userID, course, ok := s.loadCourse(w, r, lesson.CourseID, "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	// Leave room for the multipart headers
+	r.Body = http.MaxBytesReader(w, r.Body, (maxLessonFileSizeMB+1)<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds the %d MB limit", maxLessonFileSizeMB))
+			return
+		}
+		respondWithError(w, http.StatusBadRequest, "Missing file")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxLessonFileSizeMB<<20 {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds the %d MB limit", maxLessonFileSizeMB))
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to read file")
+		return
+	}
+
+	stored, err := s.storage.CreateFile(
+		r.Context(),
+		courseFilesBucketID(),
+		"unique()",
+		header.Filename,
+		data,
+		[]string{},
+	)
+	if err != nil {
+		log.Printf("Failed to store lesson file: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to store file")
+		return
+	}
+
+	update := map[string]interface{}{
+		"fileIds":   append(lesson.FileIDs, fmt.Sprint(stored.Get("$id"))),
+		"fileNames": append(lesson.FileNames, header.Filename),
+		"updatedAt": time.Now().Format(time.RFC3339),
+	}
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		lessonsCollectionID(),
+		lesson.ID,
+		update,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update lesson: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to attach file to lesson")
+		return
+	}
+
+	log.Printf("User %s attached file %s to lesson %s", userID, stored.Get("$id"), lesson.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    update,
+	})
+}
+
+// DownloadLessonFile streams a file of a lesson to users who can read the
+// lesson
+func (s *LMSService) DownloadLessonFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	_, lesson, _, ok := s.loadLesson(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	index := -1
+	for i, fileID := range lesson.FileIDs {
+		if fileID == vars["fileId"] {
+			index = i
+		}
+	}
+	if index < 0 || index >= len(lesson.FileNames) {
+		respondWithError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	data, err := s.storage.GetFileDownload(courseFilesBucketID(), lesson.FileIDs[index])
+	if err != nil {
+		log.Printf("Failed to download lesson file: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to download file")
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", lesson.FileNames[index]))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
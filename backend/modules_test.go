@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizePublishDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		course  *Course
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "empty date publishes right away",
+			course: &Course{},
+			want:   "",
+		},
+		{
+			name:   "instant is converted to UTC",
+			value:  "2026-05-10T09:00:00+02:00",
+			course: &Course{},
+			want:   "2026-05-10T07:00:00Z",
+		},
+		{
+			name:   "plain date starts in the course timezone",
+			value:  "2026-05-10",
+			course: &Course{Timezone: "Europe/Berlin"},
+			want:   "2026-05-09T22:00:00Z",
+		},
+		{
+			name:   "plain date without a course timezone",
+			value:  "2026-05-10",
+			course: &Course{},
+			want:   "2026-05-10T00:00:00Z",
+		},
+		{
+			name:    "invalid date",
+			value:   "next monday",
+			course:  &Course{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePublishDate(tt.value, tt.course)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("normalizePublishDate(%q) = %q, want error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizePublishDate(%q) returned error: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizePublishDate(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPublished(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		publishDate string
+		want        bool
+	}{
+		{name: "no publish date", publishDate: "", want: true},
+		{name: "published earlier", publishDate: "2026-05-10T11:59:59Z", want: true},
+		{name: "published now", publishDate: "2026-05-10T12:00:00Z", want: true},
+		{name: "published later", publishDate: "2026-05-10T12:00:01Z", want: false},
+		{name: "invalid publish date stays hidden", publishDate: "2026-05-10", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPublished(tt.publishDate, now); got != tt.want {
+				t.Errorf("isPublished(%q) = %v, want %v", tt.publishDate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLessonURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		links    []string
+		videoURL string
+		wantErr  bool
+	}{
+		{
+			name: "no URLs",
+		},
+		{
+			name:     "http and https URLs",
+			links:    []string{"https://go.dev/doc", "http://example.com/notes.pdf"},
+			videoURL: "https://videos.example.com/lesson-1",
+		},
+		{
+			name:    "script URL",
+			links:   []string{"javascript:alert(1)"},
+			wantErr: true,
+		},
+		{
+			name:     "relative video URL",
+			videoURL: "/videos/lesson-1",
+			wantErr:  true,
+		},
+		{
+			name:    "URL without a host",
+			links:   []string{"https://"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLessonURLs(tt.links, tt.videoURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLessonURLs(%v, %q) error = %v, want error = %v", tt.links, tt.videoURL, err, tt.wantErr)
+			}
+		})
+	}
+}
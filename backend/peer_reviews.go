@@ -0,0 +1,721 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// Peer review states
+const (
+	PeerReviewAssigned  = "assigned"
+	PeerReviewCompleted = "completed"
+)
+
+// PeerReview is one student's review of another student's submission. Reviews
+// are anonymous: reviewers never see the author and authors never see the
+// reviewer. CriterionIDs, Levels and Comments are parallel lists holding the
+// rubric level the reviewer picked for each criterion.
+type PeerReview struct {
+	ID           string   `json:"$id"`
+	SubmissionID string   `json:"submissionId"`
+	AssignmentID string   `json:"assignmentId"`
+	AuthorID     string   `json:"authorId,omitempty"`
+	ReviewerID   string   `json:"reviewerId,omitempty"`
+	Status       string   `json:"status"`
+	CriterionIDs []string `json:"criterionIds"`
+	Levels       []int    `json:"levels"`
+	Comments     []string `json:"comments"`
+	Score        *int     `json:"score"` // 0-100, set once completed
+	CompletedAt  string   `json:"completedAt"`
+	AppliedAt    string   `json:"appliedAt"` // set once the score counted towards a grade
+	TenantID     string   `json:"tenantId"`
+}
+
+func peerReviewsCollectionID() string {
+	return getEnv("APPWRITE_PEER_REVIEWS_COLLECTION_ID", "peer_reviews")
+}
+
+// listPeerReviews returns the peer reviews of a tenant matching the queries
+func (s *LMSService) listPeerReviews(ctx context.Context, tenantID string, queries []interface{}) ([]PeerReview, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		peerReviewsCollectionID(),
+		append(queries, query.Equal("tenantId", tenantID)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list peer reviews: %w", err)
+	}
+
+	var reviews []PeerReview
+	if err := json.Unmarshal([]byte(documents.(string)), &reviews); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal peer reviews: %w", err)
+	}
+	return reviews, nil
+}
+
+// pairReviewers assigns count reviewers to every author. Authors are shuffled
+// and each one is reviewed by the next count authors in the shuffled order,
+// so everybody writes and receives the same number of reviews and nobody
+// reviews their own work.
+func pairReviewers(authorIDs []string, count int) map[string][]string {
+	shuffled := append([]string(nil), authorIDs...)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	reviewers := make(map[string][]string)
+	for i, author := range shuffled {
+		for k := 1; k <= count; k++ {
+			reviewers[author] = append(reviewers[author], shuffled[(i+k)%len(shuffled)])
+		}
+	}
+	return reviewers
+}
+
+// loadPeerReview loads a peer review with its assignment and course and
+// checks that the current user may perform action on it. It writes an error
+// response and returns false when the request must not proceed.
+func (s *LMSService) loadPeerReview(w http.ResponseWriter, r *http.Request, reviewID, action string) (string, *PeerReview, *Assignment, *Course, bool) {
+	tenantID := getContextTenant(r)
+
+	doc, err := s.db.GetDocument(s.databaseID, peerReviewsCollectionID(), reviewID)
+	if err != nil {
+		log.Printf("Peer review not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Peer review not found")
+		return "", nil, nil, nil, false
+	}
+
+	var review PeerReview
+	if err := json.Unmarshal([]byte(doc.(string)), &review); err != nil {
+		log.Printf("Failed to unmarshal peer review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process peer review")
+		return "", nil, nil, nil, false
+	}
+	if review.TenantID != tenantID {
+		respondWithError(w, http.StatusNotFound, "Peer review not found")
+		return "", nil, nil, nil, false
+	}
+
+	assignment, err := s.getAssignment(review.AssignmentID, tenantID)
+	if err != nil {
+		log.Printf("Assignment not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Assignment not found")
+		return "", nil, nil, nil, false
+	}
+
+	course, err := s.getCourse(assignment.CourseID, tenantID)
+	if err != nil {
+		log.Printf("Course not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return "", nil, nil, nil, false
+	}
+
+	instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get course sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+		return "", nil, nil, nil, false
+	}
+
+	userID, ok := s.authorize(w, r, action, &models.ResourceInput{
+		Type: "review",
+		Key:  review.ID,
+		Attributes: map[string]interface{}{
+			"reviewerId":    review.ReviewerID,
+			"courseId":      course.ID,
+			"teacherId":     course.TeacherID,
+			"instructorIds": instructorIDs,
+		},
+	})
+	if !ok {
+		return "", nil, nil, nil, false
+	}
+
+	// Reviewers must not learn whose work they review, nor graders under
+	// blind grading
+	if review.ReviewerID == userID {
+		review.AuthorID = ""
+	} else if identitiesMasked(assignment, course, time.Now()) {
+		if !checkBlindGradingConfigured(w) {
+			return "", nil, nil, nil, false
+		}
+		review.AuthorID = pseudonym(assignment.ID, review.AuthorID)
+		review.ReviewerID = pseudonym(assignment.ID, review.ReviewerID)
+	}
+	return userID, &review, assignment, course, true
+}
+
+// UpdatePeerReviewSettings sets how many peer reviews each submission of an
+// assignment gets. Peer review needs a rubric and cannot be changed once
+// reviewers were assigned.
+func (s *LMSService) UpdatePeerReviewSettings(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if assignment.PeerReviewsAssignedAt != "" {
+		respondWithError(w, http.StatusConflict, "Peer reviewers were already assigned")
+		return
+	}
+
+	var requestData struct {
+		ReviewsPerSubmission int `json:"reviewsPerSubmission"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.ReviewsPerSubmission < 0 {
+		respondWithError(w, http.StatusBadRequest, "Reviews per submission cannot be negative")
+		return
+	}
+
+	if requestData.ReviewsPerSubmission > 0 {
+		criteria, err := s.listRubricCriteria(r.Context(), assignment)
+		if err != nil {
+			log.Printf("Failed to get rubric: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric")
+			return
+		}
+		if len(criteria) == 0 {
+			respondWithError(w, http.StatusBadRequest, "Peer review needs a rubric")
+			return
+		}
+	}
+
+	data := map[string]interface{}{
+		"peerReviewCount": requestData.ReviewsPerSubmission,
+	}
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignment.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update peer review settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update peer review settings")
+		return
+	}
+
+	log.Printf("User %s set %d peer reviews per submission for assignment %s", userID, requestData.ReviewsPerSubmission, assignment.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// AssignPeerReviews anonymously assigns every counted submission of an
+// assignment to other students who submitted, once the due date has passed.
+// Students without a submission at that time, such as those with an
+// extension, neither write nor receive reviews.
+func (s *LMSService) AssignPeerReviews(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if assignment.PeerReviewCount == 0 {
+		respondWithError(w, http.StatusBadRequest, "Peer review is not enabled for this assignment")
+		return
+	}
+	if assignment.PeerReviewsAssignedAt != "" {
+		respondWithError(w, http.StatusConflict, "Peer reviewers were already assigned")
+		return
+	}
+
+	loc, err := courseLocation(course)
+	if err != nil {
+		log.Printf("Failed to load course timezone: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process course timezone")
+		return
+	}
+	dueDate, err := parseDeadline(assignment.DueDate, loc)
+	if err != nil {
+		log.Printf("Invalid due date of assignment %s: %v", assignment.ID, err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process due date")
+		return
+	}
+	if time.Now().Before(dueDate) {
+		respondWithError(w, http.StatusConflict, "Peer reviewers can only be assigned after the due date")
+		return
+	}
+
+	counted, err := s.listCountedSubmissions(r.Context(), course, []Assignment{*assignment}, "")
+	if err != nil {
+		log.Printf("Failed to get submissions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve submissions")
+		return
+	}
+
+	submissions := make(map[string]Submission)
+	var authorIDs []string
+	for studentID, byAssignment := range counted {
+		if submission, ok := byAssignment[assignment.ID]; ok {
+			submissions[studentID] = submission
+			authorIDs = append(authorIDs, studentID)
+		}
+	}
+	if len(authorIDs) <= assignment.PeerReviewCount {
+		respondWithError(w, http.StatusConflict,
+			fmt.Sprintf("%d peer reviews per submission need at least %d submissions", assignment.PeerReviewCount, assignment.PeerReviewCount+1))
+		return
+	}
+
+	created := 0
+	for authorID, reviewerIDs := range pairReviewers(authorIDs, assignment.PeerReviewCount) {
+		for _, reviewerID := range reviewerIDs {
+			_, err := s.db.CreateDocument(
+				r.Context(),
+				s.databaseID,
+				peerReviewsCollectionID(),
+				"unique()",
+				map[string]interface{}{
+					"submissionId": submissions[authorID].ID,
+					"assignmentId": assignment.ID,
+					"authorId":     authorID,
+					"reviewerId":   reviewerID,
+					"status":       PeerReviewAssigned,
+					"tenantId":     assignment.TenantID,
+				},
+			)
+			if err != nil {
+				log.Printf("Failed to create peer review: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to assign peer reviews")
+				return
+			}
+			created++
+		}
+	}
+
+	assignedAt := time.Now().UTC().Format(time.RFC3339)
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignment.ID,
+		map[string]interface{}{
+			"peerReviewsAssignedAt": assignedAt,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update assignment")
+		return
+	}
+
+	log.Printf("User %s assigned %d peer reviews for assignment %s", userID, created, assignment.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"assignmentId":          assignment.ID,
+			"peerReviewsAssignedAt": assignedAt,
+			"submissions":           len(authorIDs),
+			"reviews":               created,
+		},
+	})
+}
+
+// ListPeerReviews returns the peer reviews of an assignment. Graders see all
+// of them; with ?mine=true students see the reviews they were assigned,
+// without the authors.
+func (s *LMSService) ListPeerReviews(w http.ResponseWriter, r *http.Request) {
+	assignmentID := mux.Vars(r)["id"]
+	queries := []interface{}{query.Equal("assignmentId", assignmentID)}
+
+	mine := r.URL.Query().Get("mine") == "true"
+	action := "grade"
+	if mine {
+		action = "read"
+	}
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, assignmentID, action)
+	if !ok {
+		return
+	}
+	if mine {
+		queries = append(queries, query.Equal("reviewerId", userID))
+	}
+
+	reviews, err := s.listPeerReviews(r.Context(), assignment.TenantID, queries)
+	if err != nil {
+		log.Printf("Failed to get peer reviews: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve peer reviews")
+		return
+	}
+
+	masked := identitiesMasked(assignment, course, time.Now())
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+	for i := range reviews {
+		if mine {
+			reviews[i].AuthorID = ""
+		} else {
+			reviews[i].AuthorID = maskStudent(assignment, masked, reviews[i].AuthorID)
+			reviews[i].ReviewerID = maskStudent(assignment, masked, reviews[i].ReviewerID)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    reviews,
+		"meta": map[string]interface{}{
+			"total": len(reviews),
+		},
+	})
+}
+
+// GetPeerReview returns a peer review with the reviewed work and the rubric.
+// The work is returned without its author.
+func (s *LMSService) GetPeerReview(w http.ResponseWriter, r *http.Request) {
+	_, review, assignment, _, ok := s.loadPeerReview(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	submission, err := s.getSubmission(review.SubmissionID, review.TenantID)
+	if err != nil {
+		log.Printf("Submission not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+
+	var attachments []map[string]interface{}
+	for _, attachmentID := range submission.AttachmentIDs {
+		attachment, err := s.getAttachment(attachmentID, review.TenantID)
+		if err != nil {
+			log.Printf("Warning: Failed to get attachment %s: %v", attachmentID, err)
+			continue
+		}
+		attachments = append(attachments, map[string]interface{}{
+			"id":        attachment.ID,
+			"name":      attachment.Name,
+			"mimeType":  attachment.MimeType,
+			"sizeBytes": attachment.SizeBytes,
+		})
+	}
+
+	criteria, err := s.listRubricCriteria(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get rubric: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"review": review,
+			"submission": map[string]interface{}{
+				"id":          submission.ID,
+				"content":     submission.Content,
+				"submittedAt": submission.SubmittedAt,
+				"attachments": attachments,
+			},
+			"rubric": criteria,
+		},
+	})
+}
+
+// SubmitPeerReview scores the reviewed work against the assignment's rubric.
+// Reviewers can revise their review until the peer grades are applied.
+func (s *LMSService) SubmitPeerReview(w http.ResponseWriter, r *http.Request) {
+	userID, review, assignment, course, ok := s.loadPeerReview(w, r, mux.Vars(r)["id"], "submit")
+	if !ok {
+		return
+	}
+
+	if review.AppliedAt != "" {
+		respondWithError(w, http.StatusConflict, "Peer grades were already applied")
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Scores []RubricScore `json:"scores"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	criteria, err := s.listRubricCriteria(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get rubric: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric")
+		return
+	}
+
+	score, err := scoreRubric(criteria, requestData.Scores)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var criterionIDs, comments []string
+	var levels []int
+	for _, rubricScore := range requestData.Scores {
+		criterionIDs = append(criterionIDs, rubricScore.CriterionID)
+		levels = append(levels, rubricScore.Level)
+		comments = append(comments, rubricScore.Comment)
+	}
+
+	data := map[string]interface{}{
+		"status":       PeerReviewCompleted,
+		"criterionIds": criterionIDs,
+		"levels":       levels,
+		"comments":     comments,
+		"score":        score,
+		"completedAt":  time.Now().Format(time.RFC3339),
+	}
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		peerReviewsCollectionID(),
+		review.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update peer review: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save peer review")
+		return
+	}
+
+	log.Printf("User %s completed peer review %s", userID, review.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    data,
+	})
+}
+
+// DownloadPeerReviewAttachment streams an attachment of the work under review
+func (s *LMSService) DownloadPeerReviewAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	_, review, _, _, ok := s.loadPeerReview(w, r, vars["id"], "read")
+	if !ok {
+		return
+	}
+
+	submission, err := s.getSubmission(review.SubmissionID, review.TenantID)
+	if err != nil || !contains(submission.AttachmentIDs, vars["attachmentId"]) {
+		respondWithError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	attachment, err := s.getAttachment(vars["attachmentId"], review.TenantID)
+	if err != nil {
+		log.Printf("Attachment not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Attachment not found")
+		return
+	}
+
+	s.serveAttachment(w, attachment)
+}
+
+// ListSubmissionPeerReviews returns the peer reviews of a submission. The
+// author sees the completed reviews, without reviewers, once grades are
+// released; graders see all of them.
+func (s *LMSService) ListSubmissionPeerReviews(w http.ResponseWriter, r *http.Request) {
+	user, ok := getContextUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID, _ := user["id"].(string)
+
+	submission, err := s.getSubmission(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil || submission.Status == SubmissionStatusDraft {
+		log.Printf("Submission not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+
+	isAuthor := submission.StudentID == userID
+	action := "grade"
+	if isAuthor {
+		action = "read"
+	}
+	_, assignment, course, ok := s.loadAssignmentCourse(w, r, submission.AssignmentID, action)
+	if !ok {
+		return
+	}
+
+	queries := []interface{}{query.Equal("submissionId", submission.ID)}
+	if isAuthor {
+		if !gradesReleased(assignment, course, time.Now()) {
+			respondWithError(w, http.StatusConflict, "Grades of this assignment are not released yet")
+			return
+		}
+		queries = append(queries, query.Equal("status", PeerReviewCompleted))
+	}
+
+	reviews, err := s.listPeerReviews(r.Context(), submission.TenantID, queries)
+	if err != nil {
+		log.Printf("Failed to get peer reviews: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve peer reviews")
+		return
+	}
+
+	masked := !isAuthor && identitiesMasked(assignment, course, time.Now())
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+	for i := range reviews {
+		if isAuthor {
+			reviews[i].ReviewerID = ""
+		} else {
+			reviews[i].AuthorID = maskStudent(assignment, masked, reviews[i].AuthorID)
+			reviews[i].ReviewerID = maskStudent(assignment, masked, reviews[i].ReviewerID)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    reviews,
+		"meta": map[string]interface{}{
+			"total": len(reviews),
+		},
+	})
+}
+
+// GradePeerReviews grades every submission of an assignment that has
+// completed peer reviews with the average of their scores. The late penalty
+// applies as usual, and each change is recorded in the grade history.
+// Submissions whose grade would not change are skipped, so this can be run
+// again as more reviews come in. Submissions graded some other way, e.g. by a
+// teacher or a regrade, keep their grade unless ?override=true is given.
+// Reviews that counted towards a grade can no longer be revised.
+func (s *LMSService) GradePeerReviews(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "grade")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if assignment.PeerReviewsAssignedAt == "" {
+		respondWithError(w, http.StatusConflict, "Peer reviewers were not assigned yet")
+		return
+	}
+
+	reviews, err := s.listPeerReviews(r.Context(), assignment.TenantID, []interface{}{
+		query.Equal("assignmentId", assignment.ID),
+		query.Equal("status", PeerReviewCompleted),
+	})
+	if err != nil {
+		log.Printf("Failed to get peer reviews: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve peer reviews")
+		return
+	}
+
+	override := r.URL.Query().Get("override") == "true"
+
+	scores := make(map[string][]int)
+	reviewIDs := make(map[string][]string)
+	for _, review := range reviews {
+		if review.Score != nil {
+			scores[review.SubmissionID] = append(scores[review.SubmissionID], *review.Score)
+			reviewIDs[review.SubmissionID] = append(reviewIDs[review.SubmissionID], review.ID)
+		}
+	}
+
+	graded := make(map[string]int)
+	var skipped []string
+	for submissionID, submissionScores := range scores {
+		sum := 0
+		for _, score := range submissionScores {
+			sum += score
+		}
+		grade := int(math.Round(float64(sum) / float64(len(submissionScores))))
+
+		submission, err := s.getSubmission(submissionID, assignment.TenantID)
+		if err != nil {
+			log.Printf("Failed to get submission %s: %v", submissionID, err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve submission")
+			return
+		}
+		if submission.GradedAt != "" && !override {
+			source, err := s.lastGradeSource(r.Context(), submission)
+			if err != nil {
+				log.Printf("Failed to get grade history of submission %s: %v", submissionID, err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to retrieve grade history")
+				return
+			}
+			if source != GradeSourcePeerReview {
+				skipped = append(skipped, submissionID)
+				continue
+			}
+		}
+
+		if submission.GradedAt == "" || submission.RawGrade != grade {
+			reason := fmt.Sprintf("Average of %d peer reviews", len(submissionScores))
+			if err := s.saveGrade(r.Context(), submission, grade, submission.Feedback, userID, reason, GradeSourcePeerReview); err != nil {
+				log.Printf("Failed to grade submission %s: %v", submissionID, err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to grade submission")
+				return
+			}
+			graded[submissionID] = grade
+		}
+
+		appliedAt := time.Now().Format(time.RFC3339)
+		for _, reviewID := range reviewIDs[submissionID] {
+			_, err := s.db.UpdateDocument(
+				s.databaseID,
+				peerReviewsCollectionID(),
+				reviewID,
+				map[string]interface{}{"appliedAt": appliedAt},
+				nil, // permissions
+			)
+			if err != nil {
+				log.Printf("Failed to mark peer review %s as applied: %v", reviewID, err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to update peer review")
+				return
+			}
+		}
+	}
+
+	log.Printf("User %s graded %d submissions of assignment %s from peer reviews", userID, len(graded), assignment.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    graded,
+		"meta": map[string]interface{}{
+			"total":    len(graded),
+			"reviewed": len(scores),
+			"skipped":  skipped,
+		},
+	})
+}
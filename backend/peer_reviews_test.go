@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPairReviewers(t *testing.T) {
+	tests := []struct {
+		name    string
+		authors int
+		count   int
+	}{
+		{name: "two authors review each other", authors: 2, count: 1},
+		{name: "one review each", authors: 5, count: 1},
+		{name: "several reviews each", authors: 7, count: 3},
+		{name: "everybody reviews everybody else", authors: 4, count: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var authorIDs []string
+			for i := 0; i < tt.authors; i++ {
+				authorIDs = append(authorIDs, fmt.Sprintf("student-%d", i))
+			}
+
+			reviewers := pairReviewers(authorIDs, tt.count)
+
+			if len(reviewers) != tt.authors {
+				t.Fatalf("got reviewers for %d authors, want %d", len(reviewers), tt.authors)
+			}
+			written := make(map[string]int)
+			for _, author := range authorIDs {
+				seen := make(map[string]bool)
+				for _, reviewer := range reviewers[author] {
+					if reviewer == author {
+						t.Errorf("%s reviews their own work", author)
+					}
+					if seen[reviewer] {
+						t.Errorf("%s reviews %s twice", reviewer, author)
+					}
+					seen[reviewer] = true
+					written[reviewer]++
+				}
+				if len(reviewers[author]) != tt.count {
+					t.Errorf("%s gets %d reviews, want %d", author, len(reviewers[author]), tt.count)
+				}
+			}
+			for _, author := range authorIDs {
+				if written[author] != tt.count {
+					t.Errorf("%s writes %d reviews, want %d", author, written[author], tt.count)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// Modules and assignments can require a student to complete a lesson or to
+// score at least a minimum on an assignment before they unlock. Assignments
+// are also locked while their module is. Whether content is locked for the
+// requesting student is passed to Permit.io as the resource attribute
+// "locked", so the isUnlocked policy condition refuses access to it.
+
+// Prerequisite types
+const (
+	PrerequisiteLessonCompleted = "lesson_completed"
+	PrerequisiteMinScore        = "min_score"
+)
+
+// Content that can have prerequisites
+const (
+	PrerequisiteTargetModule     = "module"
+	PrerequisiteTargetAssignment = "assignment"
+)
+
+// Prerequisite is a condition a student must meet to unlock a module or an
+// assignment
+type Prerequisite struct {
+	ID         string `json:"$id"`
+	CourseID   string `json:"courseId"`
+	TargetType string `json:"targetType"` // module or assignment
+	TargetID   string `json:"targetId"`
+	Type       string `json:"type"`     // lesson_completed or min_score
+	ItemID     string `json:"itemId"`   // ID of the lesson or assignment
+	MinScore   int    `json:"minScore"` // Percent, for min_score
+	TenantID   string `json:"tenantId"`
+	Met        *bool  `json:"met,omitempty"` // For the requesting student
+}
+
+// LessonCompletion records that a student completed a lesson
+type LessonCompletion struct {
+	ID          string `json:"$id"`
+	LessonID    string `json:"lessonId"`
+	CourseID    string `json:"courseId"`
+	StudentID   string `json:"studentId"`
+	CompletedAt string `json:"completedAt"`
+	TenantID    string `json:"tenantId"`
+}
+
+func prerequisitesCollectionID() string {
+	return getEnv("APPWRITE_PREREQUISITES_COLLECTION_ID", "prerequisites")
+}
+
+func lessonCompletionsCollectionID() string {
+	return getEnv("APPWRITE_LESSON_COMPLETIONS_COLLECTION_ID", "lesson_completions")
+}
+
+// contentProgress is what a student has done in a course, to evaluate the
+// course's prerequisites
+type contentProgress struct {
+	prerequisites []Prerequisite
+	moduleOf      map[string]string // Module ID by assignment ID
+	completed     map[string]bool   // Completed lesson IDs
+	scores        map[string]int    // Released grades by assignment ID
+}
+
+// met reports whether the student meets a prerequisite
+func (p *contentProgress) met(prerequisite Prerequisite) bool {
+	switch prerequisite.Type {
+	case PrerequisiteLessonCompleted:
+		return p.completed[prerequisite.ItemID]
+	case PrerequisiteMinScore:
+		score, ok := p.scores[prerequisite.ItemID]
+		return ok && score >= prerequisite.MinScore
+	default:
+		return false
+	}
+}
+
+// locked reports whether a module or assignment is locked for the student
+func (p *contentProgress) locked(targetType, targetID string) bool {
+	for _, prerequisite := range p.prerequisites {
+		if prerequisite.TargetType == targetType && prerequisite.TargetID == targetID && !p.met(prerequisite) {
+			return true
+		}
+	}
+	if moduleID, ok := p.moduleOf[targetID]; ok && targetType == PrerequisiteTargetAssignment {
+		return p.locked(PrerequisiteTargetModule, moduleID)
+	}
+	return false
+}
+
+// listPrerequisites returns the prerequisites of a course
+func (s *LMSService) listPrerequisites(ctx context.Context, course *Course) ([]Prerequisite, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		prerequisitesCollectionID(),
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prerequisites: %w", err)
+	}
+
+	var prerequisites []Prerequisite
+	if err := json.Unmarshal([]byte(documents.(string)), &prerequisites); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal prerequisites: %w", err)
+	}
+	return prerequisites, nil
+}
+
+// listLessonCompletions returns the lessons a student completed in a course
+func (s *LMSService) listLessonCompletions(ctx context.Context, course *Course, studentID string) ([]LessonCompletion, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		lessonCompletionsCollectionID(),
+		[]interface{}{
+			query.Equal("courseId", course.ID),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", course.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lesson completions: %w", err)
+	}
+
+	var completions []LessonCompletion
+	if err := json.Unmarshal([]byte(documents.(string)), &completions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal lesson completions: %w", err)
+	}
+	return completions, nil
+}
+
+// loadProgress loads what a student has done in a course. Scores count only
+// once the assignment's grades are released, so unlocking never reveals a
+// hidden grade.
+func (s *LMSService) loadProgress(ctx context.Context, course *Course, studentID string) (*contentProgress, error) {
+	prerequisites, err := s.listPrerequisites(ctx, course)
+	if err != nil {
+		return nil, err
+	}
+	progress := &contentProgress{
+		prerequisites: prerequisites,
+		moduleOf:      make(map[string]string),
+		completed:     make(map[string]bool),
+		scores:        make(map[string]int),
+	}
+	if len(prerequisites) == 0 {
+		return progress, nil
+	}
+
+	items, err := s.listModuleItems(ctx, course, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Type == ModuleItemAssignment {
+			progress.moduleOf[item.ItemID] = item.ModuleID
+		}
+	}
+
+	completions, err := s.listLessonCompletions(ctx, course, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, completion := range completions {
+		progress.completed[completion.LessonID] = true
+	}
+
+	assignments, err := s.listCourseAssignments(ctx, course)
+	if err != nil {
+		return nil, err
+	}
+	counted, err := s.listCountedSubmissions(ctx, course, assignments, studentID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range assignments {
+		submission, ok := counted[studentID][assignments[i].ID]
+		if ok && submission.GradedAt != "" && gradesReleased(&assignments[i], course, now) {
+			progress.scores[assignments[i].ID] = submission.Grade
+		}
+	}
+	return progress, nil
+}
+
+// contentLocked reports whether a module or assignment is locked for a user.
+// Content is only ever locked for the course's students.
+func (s *LMSService) contentLocked(ctx context.Context, course *Course, userID, targetType, targetID string) (bool, error) {
+	if !contains(course.StudentIDs, userID) {
+		return false, nil
+	}
+	progress, err := s.loadProgress(ctx, course, userID)
+	if err != nil {
+		return false, err
+	}
+	return progress.locked(targetType, targetID), nil
+}
+
+// authorizeModule checks that the current user may perform action on a
+// module
+func (s *LMSService) authorizeModule(w http.ResponseWriter, r *http.Request, course *Course, module *Module, action string) (string, bool) {
+	user, _ := getContextUser(r)
+	userID, _ := user["id"].(string)
+
+	locked, err := s.contentLocked(r.Context(), course, userID, PrerequisiteTargetModule, module.ID)
+	if err != nil {
+		log.Printf("Failed to evaluate prerequisites: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to evaluate prerequisites")
+		return "", false
+	}
+
+	instructorIDs, err := s.courseInstructorIDs(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get course sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve course sections")
+		return "", false
+	}
+
+	return s.authorize(w, r, action, &models.ResourceInput{
+		Type: "module",
+		Key:  module.ID,
+		Attributes: map[string]interface{}{
+			"courseId":      course.ID,
+			"teacherId":     course.TeacherID,
+			"instructorIds": instructorIDs,
+			"studentIds":    course.StudentIDs,
+			"locked":        locked,
+		},
+	})
+}
+
+// deletePrerequisites deletes the prerequisites of a course whose field has
+// the given value, such as those of a deleted module or lesson
+func (s *LMSService) deletePrerequisites(ctx context.Context, course *Course, field, value string) error {
+	prerequisites, err := s.listPrerequisites(ctx, course)
+	if err != nil {
+		return err
+	}
+	for _, prerequisite := range prerequisites {
+		if (field == "targetId" && prerequisite.TargetID == value) || (field == "itemId" && prerequisite.ItemID == value) {
+			if _, err := s.db.DeleteDocument(s.databaseID, prerequisitesCollectionID(), prerequisite.ID); err != nil {
+				return fmt.Errorf("failed to delete prerequisite: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// prerequisiteCycle reports whether prerequisites lock content behind itself,
+// directly or through other content, so that it can never unlock
+func (s *LMSService) prerequisiteCycle(ctx context.Context, course *Course, prerequisites []Prerequisite) (bool, error) {
+	lessons, err := s.listCourseLessons(ctx, course)
+	if err != nil {
+		return false, err
+	}
+	moduleOfLesson := make(map[string]string)
+	for _, lesson := range lessons {
+		moduleOfLesson[lesson.ID] = lesson.ModuleID
+	}
+	items, err := s.listModuleItems(ctx, course, "")
+	if err != nil {
+		return false, err
+	}
+
+	// Content depends on the content it needs unlocked to meet its
+	// prerequisites, and assignments on their module
+	dependsOn := make(map[string][]string)
+	for _, prerequisite := range prerequisites {
+		target := prerequisite.TargetType + ":" + prerequisite.TargetID
+		switch prerequisite.Type {
+		case PrerequisiteLessonCompleted:
+			dependsOn[target] = append(dependsOn[target], PrerequisiteTargetModule+":"+moduleOfLesson[prerequisite.ItemID])
+		case PrerequisiteMinScore:
+			dependsOn[target] = append(dependsOn[target], PrerequisiteTargetAssignment+":"+prerequisite.ItemID)
+		}
+	}
+	for _, item := range items {
+		if item.Type == ModuleItemAssignment {
+			target := PrerequisiteTargetAssignment + ":" + item.ItemID
+			dependsOn[target] = append(dependsOn[target], PrerequisiteTargetModule+":"+item.ModuleID)
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(node string) bool
+	visit = func(node string) bool {
+		switch state[node] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[node] = visiting
+		for _, next := range dependsOn[node] {
+			if visit(next) {
+				return true
+			}
+		}
+		state[node] = done
+		return false
+	}
+	for node := range dependsOn {
+		if visit(node) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// replacePrerequisites replaces the prerequisites of a module or assignment
+// with those in the request body and writes the response
+func (s *LMSService) replacePrerequisites(w http.ResponseWriter, r *http.Request, userID string, course *Course, targetType, targetID string) {
+	var requestData struct {
+		Prerequisites []struct {
+			Type     string `json:"type"`
+			ItemID   string `json:"itemId"`
+			MinScore int    `json:"minScore"`
+		} `json:"prerequisites"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var replacement []Prerequisite
+	for _, requested := range requestData.Prerequisites {
+		switch requested.Type {
+		case PrerequisiteLessonCompleted:
+			lesson, err := s.getLesson(requested.ItemID, course.TenantID)
+			if err != nil || lesson.CourseID != course.ID {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Lesson %s is not part of the course", requested.ItemID))
+				return
+			}
+			requested.MinScore = 0
+		case PrerequisiteMinScore:
+			assignment, err := s.getAssignment(requested.ItemID, course.TenantID)
+			if err != nil || assignment.CourseID != course.ID {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Assignment %s is not part of the course", requested.ItemID))
+				return
+			}
+			if requested.MinScore < 0 || requested.MinScore > 100 {
+				respondWithError(w, http.StatusBadRequest, "Minimum score must be between 0 and 100")
+				return
+			}
+		default:
+			respondWithError(w, http.StatusBadRequest,
+				fmt.Sprintf("Invalid prerequisite type %q: expected %s or %s", requested.Type, PrerequisiteLessonCompleted, PrerequisiteMinScore))
+			return
+		}
+		replacement = append(replacement, Prerequisite{
+			CourseID:   course.ID,
+			TargetType: targetType,
+			TargetID:   targetID,
+			Type:       requested.Type,
+			ItemID:     requested.ItemID,
+			MinScore:   requested.MinScore,
+			TenantID:   course.TenantID,
+		})
+	}
+
+	existing, err := s.listPrerequisites(r.Context(), course)
+	if err != nil {
+		log.Printf("Failed to get prerequisites: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve prerequisites")
+		return
+	}
+
+	var kept, replaced []Prerequisite
+	for _, prerequisite := range existing {
+		if prerequisite.TargetType == targetType && prerequisite.TargetID == targetID {
+			replaced = append(replaced, prerequisite)
+		} else {
+			kept = append(kept, prerequisite)
+		}
+	}
+
+	cycle, err := s.prerequisiteCycle(r.Context(), course, append(kept, replacement...))
+	if err != nil {
+		log.Printf("Failed to check prerequisites: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check prerequisites")
+		return
+	}
+	if cycle {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Prerequisites would lock the %s behind itself", targetType))
+		return
+	}
+
+	for _, prerequisite := range replaced {
+		if _, err := s.db.DeleteDocument(s.databaseID, prerequisitesCollectionID(), prerequisite.ID); err != nil {
+			log.Printf("Failed to delete prerequisite: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update prerequisites")
+			return
+		}
+	}
+
+	var created []interface{}
+	for _, prerequisite := range replacement {
+		doc, err := s.db.CreateDocument(
+			r.Context(),
+			s.databaseID,
+			prerequisitesCollectionID(),
+			"unique()",
+			map[string]interface{}{
+				"courseId":   prerequisite.CourseID,
+				"targetType": prerequisite.TargetType,
+				"targetId":   prerequisite.TargetID,
+				"type":       prerequisite.Type,
+				"itemId":     prerequisite.ItemID,
+				"minScore":   prerequisite.MinScore,
+				"tenantId":   prerequisite.TenantID,
+			},
+		)
+		if err != nil {
+			log.Printf("Failed to create prerequisite: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update prerequisites")
+			return
+		}
+		created = append(created, doc)
+	}
+
+	log.Printf("User %s updated the prerequisites of %s %s", userID, targetType, targetID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    created,
+		"meta": map[string]interface{}{
+			"total": len(created),
+		},
+	})
+}
+
+// ListPrerequisites returns the prerequisites of a course's modules and
+// assignments. For students each prerequisite says whether they meet it.
+func (s *LMSService) ListPrerequisites(w http.ResponseWriter, r *http.Request) {
+	course, staff, ok := s.loadCourseContent(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	var prerequisites []Prerequisite
+	if staff {
+		var err error
+		prerequisites, err = s.listPrerequisites(r.Context(), course)
+		if err != nil {
+			log.Printf("Failed to get prerequisites: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve prerequisites")
+			return
+		}
+	} else {
+		user, _ := getContextUser(r)
+		userID, _ := user["id"].(string)
+		progress, err := s.loadProgress(r.Context(), course, userID)
+		if err != nil {
+			log.Printf("Failed to evaluate prerequisites: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to evaluate prerequisites")
+			return
+		}
+		for _, prerequisite := range progress.prerequisites {
+			met := progress.met(prerequisite)
+			prerequisite.Met = &met
+			prerequisites = append(prerequisites, prerequisite)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    prerequisites,
+		"meta": map[string]interface{}{
+			"total": len(prerequisites),
+		},
+	})
+}
+
+// UpdateModulePrerequisites replaces the prerequisites of a module
+func (s *LMSService) UpdateModulePrerequisites(w http.ResponseWriter, r *http.Request) {
+	userID, module, course, ok := s.loadModule(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	s.replacePrerequisites(w, r, userID, course, PrerequisiteTargetModule, module.ID)
+}
+
+// UpdateAssignmentPrerequisites replaces the prerequisites of an assignment
+func (s *LMSService) UpdateAssignmentPrerequisites(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	s.replacePrerequisites(w, r, userID, course, PrerequisiteTargetAssignment, assignment.ID)
+}
+
+// CompleteLesson marks a lesson as completed by the current student
+func (s *LMSService) CompleteLesson(w http.ResponseWriter, r *http.Request) {
+	userID, lesson, course, ok := s.loadLesson(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	if !contains(course.StudentIDs, userID) {
+		respondWithError(w, http.StatusForbidden, "Only enrolled students can complete lessons")
+		return
+	}
+
+	completions, err := s.listLessonCompletions(r.Context(), course, userID)
+	if err != nil {
+		log.Printf("Failed to get lesson completions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve lesson completions")
+		return
+	}
+	for _, completion := range completions {
+		if completion.LessonID == lesson.ID {
+			respondWithJSON(w, http.StatusOK, map[string]interface{}{
+				"success": true,
+				"data":    completion,
+			})
+			return
+		}
+	}
+
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		lessonCompletionsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"lessonId":    lesson.ID,
+			"courseId":    course.ID,
+			"studentId":   userID,
+			"completedAt": time.Now().Format(time.RFC3339),
+			"tenantId":    course.TenantID,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to record lesson completion: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to complete lesson")
+		return
+	}
+
+	log.Printf("Student %s completed lesson %s", userID, lesson.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    doc,
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestContentProgressMet(t *testing.T) {
+	progress := &contentProgress{
+		completed: map[string]bool{"lesson-1": true},
+		scores:    map[string]int{"quiz-1": 70},
+	}
+
+	tests := []struct {
+		name         string
+		prerequisite Prerequisite
+		want         bool
+	}{
+		{
+			name:         "completed lesson",
+			prerequisite: Prerequisite{Type: PrerequisiteLessonCompleted, ItemID: "lesson-1"},
+			want:         true,
+		},
+		{
+			name:         "lesson not completed",
+			prerequisite: Prerequisite{Type: PrerequisiteLessonCompleted, ItemID: "lesson-2"},
+			want:         false,
+		},
+		{
+			name:         "score reaches the minimum",
+			prerequisite: Prerequisite{Type: PrerequisiteMinScore, ItemID: "quiz-1", MinScore: 70},
+			want:         true,
+		},
+		{
+			name:         "score below the minimum",
+			prerequisite: Prerequisite{Type: PrerequisiteMinScore, ItemID: "quiz-1", MinScore: 71},
+			want:         false,
+		},
+		{
+			name:         "no released grade",
+			prerequisite: Prerequisite{Type: PrerequisiteMinScore, ItemID: "quiz-2", MinScore: 0},
+			want:         false,
+		},
+		{
+			name:         "unknown type",
+			prerequisite: Prerequisite{Type: "attendance", ItemID: "lesson-1"},
+			want:         false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := progress.met(tt.prerequisite); got != tt.want {
+				t.Errorf("met = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentProgressLocked(t *testing.T) {
+	progress := &contentProgress{
+		prerequisites: []Prerequisite{
+			{TargetType: PrerequisiteTargetModule, TargetID: "module-2", Type: PrerequisiteLessonCompleted, ItemID: "lesson-1"},
+			{TargetType: PrerequisiteTargetModule, TargetID: "module-3", Type: PrerequisiteLessonCompleted, ItemID: "lesson-2"},
+			{TargetType: PrerequisiteTargetAssignment, TargetID: "essay", Type: PrerequisiteMinScore, ItemID: "quiz-1", MinScore: 80},
+			{TargetType: PrerequisiteTargetAssignment, TargetID: "project", Type: PrerequisiteMinScore, ItemID: "quiz-1", MinScore: 50},
+		},
+		moduleOf: map[string]string{
+			"quiz-1":  "module-1",
+			"project": "module-2",
+			"exam":    "module-3",
+		},
+		completed: map[string]bool{"lesson-1": true},
+		scores:    map[string]int{"quiz-1": 70},
+	}
+
+	tests := []struct {
+		name       string
+		targetType string
+		targetID   string
+		want       bool
+	}{
+		{name: "module without prerequisites", targetType: PrerequisiteTargetModule, targetID: "module-1", want: false},
+		{name: "module with met prerequisite", targetType: PrerequisiteTargetModule, targetID: "module-2", want: false},
+		{name: "module with unmet prerequisite", targetType: PrerequisiteTargetModule, targetID: "module-3", want: true},
+		{name: "assignment outside every module", targetType: PrerequisiteTargetAssignment, targetID: "essay", want: true},
+		{name: "assignment in an unlocked module", targetType: PrerequisiteTargetAssignment, targetID: "quiz-1", want: false},
+		{name: "met assignment prerequisite in an unlocked module", targetType: PrerequisiteTargetAssignment, targetID: "project", want: false},
+		{name: "assignment in a locked module", targetType: PrerequisiteTargetAssignment, targetID: "exam", want: true},
+		{name: "module IDs do not lock other targets", targetType: PrerequisiteTargetModule, targetID: "exam", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := progress.locked(tt.targetType, tt.targetID); got != tt.want {
+				t.Errorf("locked(%s, %s) = %v, want %v", tt.targetType, tt.targetID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,639 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// Question difficulties
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+)
+
+// QuestionBank is a reusable set of quiz questions. Banks belong to a teacher,
+// and optionally to a course, whose teacher and instructors may use them too.
+// The owner can share a bank with other teachers.
+type QuestionBank struct {
+	ID          string   `json:"$id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	OwnerID     string   `json:"ownerId"`
+	CourseID    string   `json:"courseId"`
+	SharedWith  []string `json:"sharedWith"` // IDs of teachers the bank is shared with
+	TenantID    string   `json:"tenantId"`
+	CreatedAt   string   `json:"createdAt"`
+}
+
+// BankQuestion is a question of a question bank. Its fields match
+// QuizQuestion; questions are copied into quizzes when drawn.
+type BankQuestion struct {
+	ID              string   `json:"$id"`
+	BankID          string   `json:"bankId"`
+	Type            string   `json:"type"`
+	Prompt          string   `json:"prompt"`
+	Choices         []string `json:"choices"`
+	CorrectChoices  []int    `json:"correctChoices"`
+	NumericAnswer   *float64 `json:"numericAnswer"`
+	Tolerance       float64  `json:"tolerance"`
+	AcceptedAnswers []string `json:"acceptedAnswers"`
+	Points          int      `json:"points"`
+	Tags            []string `json:"tags"`
+	Difficulty      string   `json:"difficulty"` // easy, medium or hard
+	TenantID        string   `json:"tenantId"`
+}
+
+func questionBanksCollectionID() string {
+	return getEnv("APPWRITE_QUESTION_BANKS_COLLECTION_ID", "question_banks")
+}
+
+func bankQuestionsCollectionID() string {
+	return getEnv("APPWRITE_BANK_QUESTIONS_COLLECTION_ID", "bank_questions")
+}
+
+// quizQuestion returns the question as a quiz question drawn from the bank
+func (q BankQuestion) quizQuestion() QuizQuestion {
+	return QuizQuestion{
+		Type:            q.Type,
+		Prompt:          q.Prompt,
+		Choices:         q.Choices,
+		CorrectChoices:  q.CorrectChoices,
+		NumericAnswer:   q.NumericAnswer,
+		Tolerance:       q.Tolerance,
+		AcceptedAnswers: q.AcceptedAnswers,
+		Points:          q.Points,
+		BankQuestionID:  q.ID,
+	}
+}
+
+// matches reports whether the question has all the tags and, if set, the
+// difficulty
+func (q BankQuestion) matches(tags []string, difficulty string) bool {
+	if difficulty != "" && q.Difficulty != difficulty {
+		return false
+	}
+	for _, tag := range tags {
+		if !contains(q.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// getQuestionBank loads a question bank by ID. Banks of other tenants are
+// reported as not found.
+func (s *LMSService) getQuestionBank(bankID, tenantID string) (*QuestionBank, error) {
+	doc, err := s.db.GetDocument(s.databaseID, questionBanksCollectionID(), bankID)
+	if err != nil {
+		return nil, err
+	}
+
+	var bank QuestionBank
+	if err := json.Unmarshal([]byte(doc.(string)), &bank); err != nil {
+		return nil, fmt.Errorf("failed to parse question bank: %w", err)
+	}
+
+	if bank.TenantID != tenantID {
+		return nil, fmt.Errorf("question bank %s not found", bankID)
+	}
+	return &bank, nil
+}
+
+// questionBankResource returns the bank as a Permit.io resource. Course banks
+// carry the course's teacher and instructors.
+func (s *LMSService) questionBankResource(ctx context.Context, bank *QuestionBank) (*models.ResourceInput, error) {
+	attributes := map[string]interface{}{
+		"ownerId":    bank.OwnerID,
+		"sharedWith": bank.SharedWith,
+		"courseId":   bank.CourseID,
+	}
+
+	if bank.CourseID != "" {
+		course, err := s.getCourse(bank.CourseID, bank.TenantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get course of question bank: %w", err)
+		}
+		instructorIDs, err := s.courseInstructorIDs(ctx, course)
+		if err != nil {
+			return nil, err
+		}
+		attributes["teacherId"] = course.TeacherID
+		attributes["instructorIds"] = instructorIDs
+	}
+
+	return &models.ResourceInput{
+		Type:       "question_bank",
+		Key:        bank.ID,
+		Tenant:     bank.TenantID,
+		Attributes: attributes,
+	}, nil
+}
+
+// syncQuestionBank pushes the bank attributes used by policy conditions to
+// Permit.io
+func (s *LMSService) syncQuestionBank(ctx context.Context, bank *QuestionBank) error {
+	resource, err := s.questionBankResource(ctx, bank)
+	if err != nil {
+		return err
+	}
+	if _, err := s.permit.Api.SyncResource(ctx, resource); err != nil {
+		return fmt.Errorf("failed to sync question bank: %w", err)
+	}
+	return nil
+}
+
+// loadQuestionBank loads a question bank and checks that the current user may
+// perform action on it. It writes an error response and returns false when
+// the request must not proceed.
+func (s *LMSService) loadQuestionBank(w http.ResponseWriter, r *http.Request, bankID, action string) (string, *QuestionBank, bool) {
+	bank, err := s.getQuestionBank(bankID, getContextTenant(r))
+	if err != nil {
+		log.Printf("Question bank not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Question bank not found")
+		return "", nil, false
+	}
+
+	resource, err := s.questionBankResource(r.Context(), bank)
+	if err != nil {
+		log.Printf("Failed to load question bank attributes: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process question bank")
+		return "", nil, false
+	}
+
+	userID, ok := s.authorize(w, r, action, resource)
+	if !ok {
+		return "", nil, false
+	}
+	return userID, bank, true
+}
+
+// listBankQuestions returns the questions of a bank
+func (s *LMSService) listBankQuestions(ctx context.Context, bank *QuestionBank) ([]BankQuestion, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		bankQuestionsCollectionID(),
+		[]interface{}{
+			query.Equal("bankId", bank.ID),
+			query.Equal("tenantId", bank.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bank questions: %w", err)
+	}
+
+	var questions []BankQuestion
+	if err := json.Unmarshal([]byte(documents.(string)), &questions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bank questions: %w", err)
+	}
+	return questions, nil
+}
+
+// ListQuestionBanks returns the question banks of the tenant the current user
+// may read, optionally only those of a course
+func (s *LMSService) ListQuestionBanks(w http.ResponseWriter, r *http.Request) {
+	user, ok := getContextUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	userID, _ := user["id"].(string)
+	tenantID := getContextTenant(r)
+
+	queries := []interface{}{query.Equal("tenantId", tenantID)}
+	if courseID := r.URL.Query().Get("courseId"); courseID != "" {
+		queries = append(queries, query.Equal("courseId", courseID))
+	}
+
+	documents, err := s.db.ListDocuments(r.Context(), s.databaseID, questionBanksCollectionID(), queries)
+	if err != nil {
+		log.Printf("Failed to get question banks: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve question banks")
+		return
+	}
+
+	var banks []QuestionBank
+	if err := json.Unmarshal([]byte(documents.(string)), &banks); err != nil {
+		log.Printf("Failed to unmarshal question banks: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process question banks")
+		return
+	}
+
+	// Filter banks based on permissions
+	var visible []QuestionBank
+	for i := range banks {
+		resource, err := s.questionBankResource(r.Context(), &banks[i])
+		if err != nil {
+			log.Printf("Failed to load attributes of question bank %s: %v", banks[i].ID, err)
+			continue
+		}
+		allowed, err := s.permit.Check(r.Context(), userID, "read", resource)
+		if err != nil {
+			log.Printf("Permission check failed for question bank %s: %v", banks[i].ID, err)
+			continue
+		}
+		if allowed {
+			visible = append(visible, banks[i])
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    visible,
+		"meta": map[string]interface{}{
+			"total": len(visible),
+		},
+	})
+}
+
+// CreateQuestionBank creates a question bank owned by the current user.
+// Course banks need permission to update the course.
+func (s *LMSService) CreateQuestionBank(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authorize(w, r, "create", &models.ResourceInput{Type: "question_bank"})
+	if !ok {
+		return
+	}
+
+	var requestData struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		CourseID    string `json:"courseId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	if requestData.CourseID != "" {
+		if _, _, ok := s.loadCourse(w, r, requestData.CourseID, "update"); !ok {
+			return
+		}
+	}
+
+	bank := QuestionBank{
+		Name:        requestData.Name,
+		Description: requestData.Description,
+		OwnerID:     userID,
+		CourseID:    requestData.CourseID,
+		SharedWith:  []string{},
+		TenantID:    getContextTenant(r),
+		CreatedAt:   time.Now().Format(time.RFC3339),
+	}
+
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		questionBanksCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"name":        bank.Name,
+			"description": bank.Description,
+			"ownerId":     bank.OwnerID,
+			"courseId":    bank.CourseID,
+			"sharedWith":  bank.SharedWith,
+			"tenantId":    bank.TenantID,
+			"createdAt":   bank.CreatedAt,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to create question bank: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create question bank")
+		return
+	}
+
+	bank.ID = fmt.Sprint(doc.Get("$id"))
+	if err := s.syncQuestionBank(r.Context(), &bank); err != nil {
+		log.Printf("Warning: Failed to sync question bank with Permit.io: %v", err)
+	}
+
+	log.Printf("User %s created question bank %s", userID, bank.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    doc,
+	})
+}
+
+// GetQuestionBank returns a question bank with its questions, optionally only
+// those with all the given ?tag= values and the given ?difficulty=
+func (s *LMSService) GetQuestionBank(w http.ResponseWriter, r *http.Request) {
+	_, bank, ok := s.loadQuestionBank(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	questions, err := s.listBankQuestions(r.Context(), bank)
+	if err != nil {
+		log.Printf("Failed to get bank questions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve bank questions")
+		return
+	}
+
+	tags := r.URL.Query()["tag"]
+	difficulty := r.URL.Query().Get("difficulty")
+	var matching []BankQuestion
+	for _, question := range questions {
+		if question.matches(tags, difficulty) {
+			matching = append(matching, question)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"bank":      bank,
+			"questions": matching,
+		},
+		"meta": map[string]interface{}{
+			"total": len(matching),
+		},
+	})
+}
+
+// AddBankQuestion adds a question to a question bank
+func (s *LMSService) AddBankQuestion(w http.ResponseWriter, r *http.Request) {
+	userID, bank, ok := s.loadQuestionBank(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	var question BankQuestion
+	if err := json.NewDecoder(r.Body).Decode(&question); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	switch question.Difficulty {
+	case DifficultyEasy, DifficultyMedium, DifficultyHard:
+	case "":
+		question.Difficulty = DifficultyMedium
+	default:
+		respondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("Difficulty must be %s, %s or %s", DifficultyEasy, DifficultyMedium, DifficultyHard))
+		return
+	}
+
+	quizQuestion := question.quizQuestion()
+	if err := quizQuestion.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Question %v", err))
+		return
+	}
+
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		bankQuestionsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"bankId":          bank.ID,
+			"type":            quizQuestion.Type,
+			"prompt":          quizQuestion.Prompt,
+			"choices":         quizQuestion.Choices,
+			"correctChoices":  quizQuestion.CorrectChoices,
+			"numericAnswer":   quizQuestion.NumericAnswer,
+			"tolerance":       quizQuestion.Tolerance,
+			"acceptedAnswers": quizQuestion.AcceptedAnswers,
+			"points":          quizQuestion.Points,
+			"tags":            question.Tags,
+			"difficulty":      question.Difficulty,
+			"tenantId":        bank.TenantID,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to create bank question: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to add question")
+		return
+	}
+
+	log.Printf("User %s added question %s to question bank %s", userID, doc.Get("$id"), bank.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    doc,
+	})
+}
+
+// DeleteBankQuestion removes a question from a question bank. Quizzes keep
+// their copies of questions drawn from it.
+func (s *LMSService) DeleteBankQuestion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, bank, ok := s.loadQuestionBank(w, r, vars["id"], "update")
+	if !ok {
+		return
+	}
+
+	doc, err := s.db.GetDocument(s.databaseID, bankQuestionsCollectionID(), vars["questionId"])
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Question not found")
+		return
+	}
+	var question BankQuestion
+	if err := json.Unmarshal([]byte(doc.(string)), &question); err != nil || question.BankID != bank.ID {
+		respondWithError(w, http.StatusNotFound, "Question not found")
+		return
+	}
+
+	if _, err := s.db.DeleteDocument(s.databaseID, bankQuestionsCollectionID(), question.ID); err != nil {
+		log.Printf("Failed to delete bank question: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to delete question")
+		return
+	}
+
+	log.Printf("User %s deleted question %s from question bank %s", userID, question.ID, bank.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// ShareQuestionBank replaces the teachers a question bank is shared with.
+// Teachers it is shared with can read the bank and draw from it.
+func (s *LMSService) ShareQuestionBank(w http.ResponseWriter, r *http.Request) {
+	userID, bank, ok := s.loadQuestionBank(w, r, mux.Vars(r)["id"], "share")
+	if !ok {
+		return
+	}
+
+	var requestData struct {
+		TeacherIDs []string `json:"teacherIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	sharedWith := []string{}
+	for _, teacherID := range requestData.TeacherIDs {
+		if teacherID == bank.OwnerID || contains(sharedWith, teacherID) {
+			continue
+		}
+		account, err := s.getUserAccount(teacherID)
+		if err != nil || !contains(account.Roles(), "teacher") {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("User %s is not a teacher", teacherID))
+			return
+		}
+		sharedWith = append(sharedWith, teacherID)
+	}
+
+	_, err := s.db.UpdateDocument(
+		s.databaseID,
+		questionBanksCollectionID(),
+		bank.ID,
+		map[string]interface{}{
+			"sharedWith": sharedWith,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to share question bank: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to share question bank")
+		return
+	}
+
+	bank.SharedWith = sharedWith
+	if err := s.syncQuestionBank(r.Context(), bank); err != nil {
+		log.Printf("Warning: Failed to sync question bank with Permit.io: %v", err)
+	}
+
+	log.Printf("User %s shared question bank %s with %d teachers", userID, bank.ID, len(sharedWith))
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    bank,
+	})
+}
+
+// DrawQuizQuestions adds randomly drawn questions from a question bank to a
+// quiz. Only questions with all the given tags and the given difficulty are
+// drawn, and never one that is already in the quiz. The questions are copied,
+// so later changes to the bank do not change the quiz.
+func (s *LMSService) DrawQuizQuestions(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		BankID     string   `json:"bankId"`
+		Count      int      `json:"count"`
+		Tags       []string `json:"tags"`
+		Difficulty string   `json:"difficulty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.Count <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Count must be at least 1")
+		return
+	}
+
+	_, bank, ok := s.loadQuestionBank(w, r, requestData.BankID, "read")
+	if !ok {
+		return
+	}
+
+	started, err := s.hasSubmissions(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to check submissions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check submissions")
+		return
+	}
+	if started {
+		respondWithError(w, http.StatusConflict, "Quiz was already started by students and cannot be changed")
+		return
+	}
+
+	existing, err := s.listQuizQuestions(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get quiz questions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve quiz questions")
+		return
+	}
+	drawn := make(map[string]bool)
+	for _, question := range existing {
+		if question.BankQuestionID != "" {
+			drawn[question.BankQuestionID] = true
+		}
+	}
+
+	questions, err := s.listBankQuestions(r.Context(), bank)
+	if err != nil {
+		log.Printf("Failed to get bank questions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve bank questions")
+		return
+	}
+
+	var candidates []BankQuestion
+	for _, question := range questions {
+		if !drawn[question.ID] && question.matches(requestData.Tags, requestData.Difficulty) {
+			candidates = append(candidates, question)
+		}
+	}
+	if len(candidates) < requestData.Count {
+		respondWithError(w, http.StatusConflict,
+			fmt.Sprintf("Question bank has only %d matching questions that are not in the quiz yet", len(candidates)))
+		return
+	}
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	var created []interface{}
+	for i, question := range candidates[:requestData.Count] {
+		doc, err := s.createQuizQuestion(r.Context(), assignment, question.quizQuestion(), len(existing)+i)
+		if err != nil {
+			log.Printf("Failed to create quiz question: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to add questions to the quiz")
+			return
+		}
+		created = append(created, doc)
+	}
+
+	if assignment.Type != AssignmentTypeQuiz {
+		_, err = s.db.UpdateDocument(
+			s.databaseID,
+			assignmentsCollectionID(),
+			assignment.ID,
+			map[string]interface{}{
+				"type": AssignmentTypeQuiz,
+			},
+			nil, // permissions
+		)
+		if err != nil {
+			log.Printf("Failed to update assignment: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update quiz")
+			return
+		}
+	}
+
+	log.Printf("User %s drew %d questions from question bank %s into quiz %s", userID, len(created), bank.ID, assignment.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    created,
+		"meta": map[string]interface{}{
+			"total": len(created),
+		},
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestBankQuestionMatches(t *testing.T) {
+	question := BankQuestion{Tags: []string{"loops", "arrays"}, Difficulty: "medium"}
+
+	tests := []struct {
+		name       string
+		tags       []string
+		difficulty string
+		want       bool
+	}{
+		{
+			name: "no filters",
+			want: true,
+		},
+		{
+			name:       "same difficulty",
+			difficulty: "medium",
+			want:       true,
+		},
+		{
+			name:       "other difficulty",
+			difficulty: "hard",
+			want:       false,
+		},
+		{
+			name: "every tag",
+			tags: []string{"arrays", "loops"},
+			want: true,
+		},
+		{
+			name: "one missing tag",
+			tags: []string{"loops", "recursion"},
+			want: false,
+		},
+		{
+			name:       "tags and difficulty",
+			tags:       []string{"loops"},
+			difficulty: "medium",
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := question.matches(tt.tags, tt.difficulty); got != tt.want {
+				t.Errorf("matches(%v, %q) = %v, want %v", tt.tags, tt.difficulty, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBankQuestionQuizQuestion(t *testing.T) {
+	question := BankQuestion{
+		ID:             "bank-question-1",
+		BankID:         "bank-1",
+		Type:           QuestionMultipleChoice,
+		Prompt:         "2 + 2?",
+		Choices:        []string{"3", "4"},
+		CorrectChoices: []int{1},
+		Points:         2,
+		TenantID:       "tenant-1",
+	}
+
+	got := question.quizQuestion()
+	if got.ID != "" {
+		t.Errorf("ID = %q, want a new question", got.ID)
+	}
+	if got.BankQuestionID != "bank-question-1" {
+		t.Errorf("BankQuestionID = %q, want bank-question-1", got.BankQuestionID)
+	}
+	if got.Type != question.Type || got.Prompt != question.Prompt || got.Points != question.Points || len(got.Choices) != 2 || len(got.CorrectChoices) != 1 {
+		t.Errorf("quizQuestion() = %+v, want a copy of %+v", got, question)
+	}
+}
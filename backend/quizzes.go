@@ -0,0 +1,472 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// AssignmentTypeQuiz marks assignments answered with quiz questions instead
+// of free text. Quiz answers are stored as the submission's content, a JSON
+// object from question ID to answer, and graded by submit_assignment.
+const AssignmentTypeQuiz = "quiz"
+
+// Quiz question types
+const (
+	QuestionMultipleChoice = "multiple_choice"
+	QuestionMultiSelect    = "multi_select"
+	QuestionTrueFalse      = "true_false"
+	QuestionNumeric        = "numeric"
+	QuestionShortAnswer    = "short_answer"
+)
+
+// quizTimeLimitGrace is added to quiz time limits to allow for network delays
+const quizTimeLimitGrace = time.Minute
+
+// QuizQuestion is one question of a quiz. Choice questions are answered with
+// the index of a choice, or a list of indexes for multi_select; true_false
+// questions have the choices "True" and "False". Numeric answers are correct
+// within Tolerance of NumericAnswer, and short answers when they match one of
+// AcceptedAnswers, ignoring case and extra spaces.
+type QuizQuestion struct {
+	ID              string   `json:"$id"`
+	AssignmentID    string   `json:"assignmentId"`
+	Type            string   `json:"type"`
+	Prompt          string   `json:"prompt"`
+	Choices         []string `json:"choices"`
+	CorrectChoices  []int    `json:"correctChoices,omitempty"`
+	NumericAnswer   *float64 `json:"numericAnswer,omitempty"`
+	Tolerance       float64  `json:"tolerance,omitempty"`
+	AcceptedAnswers []string `json:"acceptedAnswers,omitempty"`
+	Points          int      `json:"points"`
+	Position        int      `json:"position"`
+	BankQuestionID  string   `json:"bankQuestionId,omitempty"` // Set when drawn from a question bank
+	TenantID        string   `json:"tenantId"`
+}
+
+func quizQuestionsCollectionID() string {
+	return getEnv("APPWRITE_QUIZ_QUESTIONS_COLLECTION_ID", "quiz_questions")
+}
+
+// withoutAnswers returns the question as students see it while taking the quiz
+func (q QuizQuestion) withoutAnswers() QuizQuestion {
+	q.CorrectChoices = nil
+	q.NumericAnswer = nil
+	q.Tolerance = 0
+	q.AcceptedAnswers = nil
+	q.BankQuestionID = ""
+	return q
+}
+
+// validate checks that the question can be answered and graded
+func (q *QuizQuestion) validate() error {
+	if q.Prompt == "" {
+		return fmt.Errorf("needs a prompt")
+	}
+	if q.Points <= 0 {
+		return fmt.Errorf("must be worth more than 0 points")
+	}
+
+	switch q.Type {
+	case QuestionTrueFalse:
+		q.Choices = []string{"True", "False"}
+		fallthrough
+	case QuestionMultipleChoice, QuestionMultiSelect:
+		if len(q.Choices) < 2 {
+			return fmt.Errorf("needs at least two choices")
+		}
+		if len(q.CorrectChoices) == 0 || (q.Type != QuestionMultiSelect && len(q.CorrectChoices) != 1) {
+			return fmt.Errorf("has the wrong number of correct choices")
+		}
+		for _, choice := range q.CorrectChoices {
+			if choice < 0 || choice >= len(q.Choices) {
+				return fmt.Errorf("has no choice %d", choice)
+			}
+		}
+	case QuestionNumeric:
+		if q.NumericAnswer == nil {
+			return fmt.Errorf("needs a numeric answer")
+		}
+		if q.Tolerance < 0 {
+			return fmt.Errorf("has a negative tolerance")
+		}
+	case QuestionShortAnswer:
+		if len(q.AcceptedAnswers) == 0 {
+			return fmt.Errorf("needs at least one accepted answer")
+		}
+	default:
+		return fmt.Errorf("has unknown type %q", q.Type)
+	}
+	return nil
+}
+
+// listQuizQuestions returns the questions of a quiz in authoring order
+func (s *LMSService) listQuizQuestions(ctx context.Context, assignment *Assignment) ([]QuizQuestion, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		quizQuestionsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quiz questions: %w", err)
+	}
+
+	var questions []QuizQuestion
+	if err := json.Unmarshal([]byte(documents.(string)), &questions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal quiz questions: %w", err)
+	}
+
+	sort.Slice(questions, func(i, j int) bool {
+		return questions[i].Position < questions[j].Position
+	})
+	return questions, nil
+}
+
+// createQuizQuestion stores a validated question of a quiz at position
+func (s *LMSService) createQuizQuestion(ctx context.Context, assignment *Assignment, question QuizQuestion, position int) (interface{}, error) {
+	doc, err := s.db.CreateDocument(
+		ctx,
+		s.databaseID,
+		quizQuestionsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"assignmentId":    assignment.ID,
+			"type":            question.Type,
+			"prompt":          question.Prompt,
+			"choices":         question.Choices,
+			"correctChoices":  question.CorrectChoices,
+			"numericAnswer":   question.NumericAnswer,
+			"tolerance":       question.Tolerance,
+			"acceptedAnswers": question.AcceptedAnswers,
+			"points":          question.Points,
+			"position":        position,
+			"bankQuestionId":  question.BankQuestionID,
+			"tenantId":        assignment.TenantID,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quiz question: %w", err)
+	}
+	return doc, nil
+}
+
+// hasSubmissions reports whether any student started or submitted the
+// assignment
+func (s *LMSService) hasSubmissions(ctx context.Context, assignment *Assignment) (bool, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		submissionsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+			query.Limit(1),
+		},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to list submissions: %w", err)
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(documents.(string)), &submissions); err != nil {
+		return false, fmt.Errorf("failed to unmarshal submissions: %w", err)
+	}
+	return len(submissions) > 0, nil
+}
+
+// quizEndsAt returns when the time limit of a started quiz runs out. ok is
+// false for quizzes without a time limit.
+func quizEndsAt(assignment *Assignment, draft *Submission) (endsAt time.Time, ok bool) {
+	if assignment.TimeLimitMinutes == 0 {
+		return time.Time{}, false
+	}
+	startedAt, err := time.Parse(time.RFC3339, draft.StartedAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return startedAt.Add(time.Duration(assignment.TimeLimitMinutes) * time.Minute), true
+}
+
+// GetQuiz returns the settings and questions of a quiz with their answers
+func (s *LMSService) GetQuiz(w http.ResponseWriter, r *http.Request) {
+	_, assignment, _, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "grade")
+	if !ok {
+		return
+	}
+
+	questions, err := s.listQuizQuestions(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get quiz questions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve quiz questions")
+		return
+	}
+
+	maxPoints := 0
+	for _, question := range questions {
+		maxPoints += question.Points
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    questions,
+		"meta": map[string]interface{}{
+			"total":            len(questions),
+			"maxPoints":        maxPoints,
+			"timeLimitMinutes": assignment.TimeLimitMinutes,
+			"shuffleQuestions": assignment.ShuffleQuestions,
+		},
+	})
+}
+
+// UpdateQuiz turns an assignment into a quiz and replaces its questions and
+// settings. Quizzes cannot be changed once a student started them.
+func (s *LMSService) UpdateQuiz(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		TimeLimitMinutes int            `json:"timeLimitMinutes"` // 0 means no limit
+		ShuffleQuestions bool           `json:"shuffleQuestions"`
+		Questions        []QuizQuestion `json:"questions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if requestData.TimeLimitMinutes < 0 {
+		respondWithError(w, http.StatusBadRequest, "Time limit cannot be negative")
+		return
+	}
+	if len(requestData.Questions) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Quiz needs at least one question")
+		return
+	}
+	for i := range requestData.Questions {
+		if err := requestData.Questions[i].validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Question %d %v", i+1, err))
+			return
+		}
+	}
+
+	started, err := s.hasSubmissions(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to check submissions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check submissions")
+		return
+	}
+	if started {
+		respondWithError(w, http.StatusConflict, "Quiz was already started by students and cannot be changed")
+		return
+	}
+
+	existing, err := s.listQuizQuestions(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get quiz questions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve quiz questions")
+		return
+	}
+	for _, question := range existing {
+		if _, err := s.db.DeleteDocument(s.databaseID, quizQuestionsCollectionID(), question.ID); err != nil {
+			log.Printf("Failed to delete quiz question: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update quiz")
+			return
+		}
+	}
+
+	var created []interface{}
+	for i, question := range requestData.Questions {
+		doc, err := s.createQuizQuestion(r.Context(), assignment, question, i)
+		if err != nil {
+			log.Printf("Failed to create quiz question: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update quiz")
+			return
+		}
+		created = append(created, doc)
+	}
+
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		assignmentsCollectionID(),
+		assignment.ID,
+		map[string]interface{}{
+			"type":             AssignmentTypeQuiz,
+			"timeLimitMinutes": requestData.TimeLimitMinutes,
+			"shuffleQuestions": requestData.ShuffleQuestions,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update assignment: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update quiz")
+		return
+	}
+
+	log.Printf("User %s updated the quiz of assignment %s (%d questions)", userID, assignment.ID, len(created))
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    created,
+		"meta": map[string]interface{}{
+			"total": len(created),
+		},
+	})
+}
+
+// StartQuiz starts an attempt at a quiz for the current student and returns
+// the questions without answers. The attempt is kept as the student's draft,
+// which records when it started and the order of the questions. Calling it
+// again returns the attempt in progress.
+func (s *LMSService) StartQuiz(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	if assignment.Type != AssignmentTypeQuiz {
+		respondWithError(w, http.StatusBadRequest, "Assignment is not a quiz")
+		return
+	}
+
+	if !contains(course.StudentIDs, userID) {
+		respondWithError(w, http.StatusForbidden, "Only enrolled students can take quizzes")
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	questions, err := s.listQuizQuestions(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get quiz questions: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve quiz questions")
+		return
+	}
+
+	draft, err := s.findDraft(r.Context(), assignment, userID)
+	if err != nil {
+		log.Printf("Failed to get draft: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve draft")
+		return
+	}
+
+	if draft == nil || draft.StartedAt == "" {
+		attempts, err := s.listStudentAttempts(r.Context(), assignment, userID)
+		if err != nil {
+			log.Printf("Failed to get attempts: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve attempts")
+			return
+		}
+		if assignment.MaxAttempts > 0 && len(attempts) >= assignment.MaxAttempts {
+			respondWithError(w, http.StatusConflict, "No attempts left")
+			return
+		}
+
+		// A quiz cannot be started once submissions are no longer accepted
+		deadline, err := s.studentSubmissionDeadline(r.Context(), assignment, course, userID)
+		if err != nil {
+			log.Printf("Failed to get submission deadline: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve due date")
+			return
+		}
+		if time.Now().After(deadline) {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("Submissions closed at %s", deadline.UTC().Format(time.RFC3339)))
+			return
+		}
+
+		var order []string
+		for _, question := range questions {
+			order = append(order, question.ID)
+		}
+		if assignment.ShuffleQuestions {
+			rand.Shuffle(len(order), func(i, j int) {
+				order[i], order[j] = order[j], order[i]
+			})
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		data := map[string]interface{}{
+			"content":       "",
+			"attachmentIds": []string{},
+			"savedAt":       now,
+			"startedAt":     now,
+			"questionOrder": order,
+		}
+		if draft != nil {
+			_, err = s.db.UpdateDocument(
+				s.databaseID,
+				submissionsCollectionID(),
+				draft.ID,
+				data,
+				nil, // permissions
+			)
+		} else {
+			data["assignmentId"] = assignment.ID
+			data["studentId"] = userID
+			data["tenantId"] = assignment.TenantID
+			data["status"] = SubmissionStatusDraft
+			_, err = s.db.CreateDocument(
+				r.Context(),
+				s.databaseID,
+				submissionsCollectionID(),
+				"unique()",
+				data,
+			)
+		}
+		if err != nil {
+			log.Printf("Failed to start quiz: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to start quiz")
+			return
+		}
+
+		draft = &Submission{StartedAt: now, QuestionOrder: order}
+		log.Printf("User %s started quiz %s", userID, assignment.ID)
+	}
+
+	byID := make(map[string]QuizQuestion)
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+	var ordered []QuizQuestion
+	for _, id := range draft.QuestionOrder {
+		if question, ok := byID[id]; ok {
+			ordered = append(ordered, question.withoutAnswers())
+		}
+	}
+
+	meta := map[string]interface{}{
+		"total":     len(ordered),
+		"startedAt": draft.StartedAt,
+		"answers":   draft.Content,
+	}
+	if endsAt, ok := quizEndsAt(assignment, draft); ok {
+		meta["endsAt"] = endsAt.UTC().Format(time.RFC3339)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    ordered,
+		"meta":    meta,
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuizQuestionValidate(t *testing.T) {
+	answer := 42.0
+
+	tests := []struct {
+		name     string
+		question QuizQuestion
+		wantErr  bool
+	}{
+		{
+			name:     "multiple choice",
+			question: QuizQuestion{Type: QuestionMultipleChoice, Prompt: "2 + 2?", Choices: []string{"3", "4"}, CorrectChoices: []int{1}, Points: 1},
+		},
+		{
+			name:     "multiple choice with two correct choices",
+			question: QuizQuestion{Type: QuestionMultipleChoice, Prompt: "2 + 2?", Choices: []string{"3", "4"}, CorrectChoices: []int{0, 1}, Points: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "correct choice out of range",
+			question: QuizQuestion{Type: QuestionMultipleChoice, Prompt: "2 + 2?", Choices: []string{"3", "4"}, CorrectChoices: []int{2}, Points: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "single choice",
+			question: QuizQuestion{Type: QuestionMultipleChoice, Prompt: "2 + 2?", Choices: []string{"4"}, CorrectChoices: []int{0}, Points: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "multi select",
+			question: QuizQuestion{Type: QuestionMultiSelect, Prompt: "Even numbers?", Choices: []string{"1", "2", "4"}, CorrectChoices: []int{1, 2}, Points: 2},
+		},
+		{
+			name:     "multi select without correct choices",
+			question: QuizQuestion{Type: QuestionMultiSelect, Prompt: "Even numbers?", Choices: []string{"1", "3"}, Points: 2},
+			wantErr:  true,
+		},
+		{
+			name:     "true or false",
+			question: QuizQuestion{Type: QuestionTrueFalse, Prompt: "Go has generics", CorrectChoices: []int{0}, Points: 1},
+		},
+		{
+			name:     "numeric",
+			question: QuizQuestion{Type: QuestionNumeric, Prompt: "6 * 7?", NumericAnswer: &answer, Points: 1},
+		},
+		{
+			name:     "numeric without an answer",
+			question: QuizQuestion{Type: QuestionNumeric, Prompt: "6 * 7?", Points: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "numeric with a negative tolerance",
+			question: QuizQuestion{Type: QuestionNumeric, Prompt: "6 * 7?", NumericAnswer: &answer, Tolerance: -1, Points: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "short answer",
+			question: QuizQuestion{Type: QuestionShortAnswer, Prompt: "Capital of France?", AcceptedAnswers: []string{"Paris"}, Points: 1},
+		},
+		{
+			name:     "short answer without accepted answers",
+			question: QuizQuestion{Type: QuestionShortAnswer, Prompt: "Capital of France?", Points: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "no prompt",
+			question: QuizQuestion{Type: QuestionShortAnswer, AcceptedAnswers: []string{"Paris"}, Points: 1},
+			wantErr:  true,
+		},
+		{
+			name:     "worth no points",
+			question: QuizQuestion{Type: QuestionShortAnswer, Prompt: "Capital of France?", AcceptedAnswers: []string{"Paris"}},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown type",
+			question: QuizQuestion{Type: "essay", Prompt: "Discuss", Points: 1},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.question.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, want error = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuizQuestionValidateTrueFalseChoices(t *testing.T) {
+	question := QuizQuestion{Type: QuestionTrueFalse, Prompt: "Go has generics", Choices: []string{"Yes", "No", "Maybe"}, CorrectChoices: []int{0}, Points: 1}
+	if err := question.validate(); err != nil {
+		t.Fatalf("validate() returned error: %v", err)
+	}
+	if want := []string{"True", "False"}; !reflect.DeepEqual(question.Choices, want) {
+		t.Errorf("Choices = %v, want %v", question.Choices, want)
+	}
+}
+
+func TestQuizQuestionWithoutAnswers(t *testing.T) {
+	answer := 42.0
+	question := QuizQuestion{
+		ID:              "question-1",
+		Type:            QuestionNumeric,
+		Prompt:          "6 * 7?",
+		CorrectChoices:  []int{0},
+		NumericAnswer:   &answer,
+		Tolerance:       0.5,
+		AcceptedAnswers: []string{"42"},
+		Points:          1,
+	}
+
+	got := question.withoutAnswers()
+	if got.CorrectChoices != nil || got.NumericAnswer != nil || got.Tolerance != 0 || got.AcceptedAnswers != nil {
+		t.Errorf("withoutAnswers() still has answers: %+v", got)
+	}
+	if got.ID != "question-1" || got.Prompt != "6 * 7?" || got.Points != 1 {
+		t.Errorf("withoutAnswers() changed the question itself: %+v", got)
+	}
+	if question.NumericAnswer == nil {
+		t.Error("withoutAnswers() changed the original question")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// Regrade request states
+const (
+	RegradePending  = "pending"
+	RegradeAccepted = "accepted"
+	RegradeRejected = "rejected"
+)
+
+// RegradeRequest is a student's request to reconsider the grade of a submission
+type RegradeRequest struct {
+	ID           string `json:"$id"`
+	SubmissionID string `json:"submissionId"`
+	AssignmentID string `json:"assignmentId"`
+	StudentID    string `json:"studentId"`
+	Reason       string `json:"reason"`
+	Status       string `json:"status"`
+	Response     string `json:"response"`
+	ResolvedBy   string `json:"resolvedBy"`
+	ResolvedAt   string `json:"resolvedAt"`
+	CreatedAt    string `json:"createdAt"`
+	TenantID     string `json:"tenantId"`
+}
+
+func regradeRequestsCollectionID() string {
+	return getEnv("APPWRITE_REGRADE_REQUESTS_COLLECTION_ID", "regrade_requests")
+}
+
+// listRegradeRequests returns the regrade requests matching the queries
+func (s *LMSService) listRegradeRequests(r *http.Request, queries []interface{}) ([]RegradeRequest, error) {
+	documents, err := s.db.ListDocuments(
+		r.Context(),
+		s.databaseID,
+		regradeRequestsCollectionID(),
+		append(queries, query.Equal("tenantId", getContextTenant(r))),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []RegradeRequest
+	if err := json.Unmarshal([]byte(documents.(string)), &requests); err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+// CreateRegradeRequest lets a student ask for a released grade to be
+// reconsidered. A submission can have one pending request at a time.
+func (s *LMSService) CreateRegradeRequest(w http.ResponseWriter, r *http.Request) {
+	submission, err := s.getSubmission(mux.Vars(r)["id"], getContextTenant(r))
+	if err != nil || submission.Status == SubmissionStatusDraft {
+		log.Printf("Submission not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Submission not found")
+		return
+	}
+
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, submission.AssignmentID, "read")
+	if !ok {
+		return
+	}
+
+	if submission.StudentID != userID {
+		respondWithError(w, http.StatusForbidden, "Only the student who submitted can request a regrade")
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if submission.GradedAt == "" || !gradesReleased(assignment, course, time.Now()) {
+		respondWithError(w, http.StatusConflict, "Submission has no released grade")
+		return
+	}
+
+	var requestData struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if requestData.Reason == "" {
+		respondWithError(w, http.StatusBadRequest, "Reason is required")
+		return
+	}
+
+	pending, err := s.listRegradeRequests(r, []interface{}{
+		query.Equal("submissionId", submission.ID),
+		query.Equal("status", RegradePending),
+	})
+	if err != nil {
+		log.Printf("Failed to get regrade requests: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve regrade requests")
+		return
+	}
+	if len(pending) > 0 {
+		respondWithError(w, http.StatusConflict, "A regrade request for this submission is already pending")
+		return
+	}
+
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		regradeRequestsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"submissionId": submission.ID,
+			"assignmentId": submission.AssignmentID,
+			"studentId":    userID,
+			"reason":       requestData.Reason,
+			"status":       RegradePending,
+			"createdAt":    time.Now().Format(time.RFC3339),
+			"tenantId":     submission.TenantID,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to create regrade request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create regrade request")
+		return
+	}
+
+	log.Printf("User %s requested a regrade of submission %s", userID, submission.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    doc,
+	})
+}
+
+// ListRegradeRequests returns the regrade requests of an assignment. Graders
+// see all of them, students only their own.
+func (s *LMSService) ListRegradeRequests(w http.ResponseWriter, r *http.Request) {
+	assignmentID := mux.Vars(r)["id"]
+	queries := []interface{}{query.Equal("assignmentId", assignmentID)}
+
+	mine := r.URL.Query().Get("mine") == "true"
+	action := "grade"
+	if mine {
+		action = "read"
+	}
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, assignmentID, action)
+	if !ok {
+		return
+	}
+	if mine {
+		queries = append(queries, query.Equal("studentId", userID))
+	}
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		queries = append(queries, query.Equal("status", status))
+	}
+
+	requests, err := s.listRegradeRequests(r, queries)
+	if err != nil {
+		log.Printf("Failed to get regrade requests: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve regrade requests")
+		return
+	}
+
+	masked := !mine && identitiesMasked(assignment, course, time.Now())
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+	for i := range requests {
+		requests[i].StudentID = maskStudent(assignment, masked, requests[i].StudentID)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    requests,
+		"meta": map[string]interface{}{
+			"total": len(requests),
+		},
+	})
+}
+
+// ResolveRegradeRequest accepts or rejects a pending regrade request.
+// Accepting it with a new grade regrades the submission, which is recorded in
+// the grade history with the student's reason.
+func (s *LMSService) ResolveRegradeRequest(w http.ResponseWriter, r *http.Request) {
+	tenantID := getContextTenant(r)
+
+	doc, err := s.db.GetDocument(s.databaseID, regradeRequestsCollectionID(), mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Regrade request not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Regrade request not found")
+		return
+	}
+
+	var request RegradeRequest
+	if err := json.Unmarshal([]byte(doc.(string)), &request); err != nil {
+		log.Printf("Failed to unmarshal regrade request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process regrade request")
+		return
+	}
+	if request.TenantID != tenantID {
+		respondWithError(w, http.StatusNotFound, "Regrade request not found")
+		return
+	}
+
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, request.AssignmentID, "grade")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if request.Status != RegradePending {
+		respondWithError(w, http.StatusConflict, "Regrade request was already resolved")
+		return
+	}
+
+	var requestData struct {
+		Decision string  `json:"decision"` // accept or reject
+		Grade    *int    `json:"grade"`
+		Feedback *string `json:"feedback"`
+		Response string  `json:"response"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	status := RegradeRejected
+	switch requestData.Decision {
+	case "accept":
+		status = RegradeAccepted
+	case "reject":
+	default:
+		respondWithError(w, http.StatusBadRequest, "Decision must be accept or reject")
+		return
+	}
+
+	if status == RegradeAccepted && requestData.Grade != nil {
+		if *requestData.Grade < 0 || *requestData.Grade > 100 {
+			respondWithError(w, http.StatusBadRequest, "Grade must be from 0 to 100")
+			return
+		}
+
+		// Rubric grades are derived from the rubric scores, which a single
+		// number would leave out of step
+		criteria, err := s.listRubricCriteria(r.Context(), assignment)
+		if err != nil {
+			log.Printf("Failed to get rubric: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric")
+			return
+		}
+		if len(criteria) > 0 {
+			respondWithError(w, http.StatusBadRequest,
+				"Assignment is graded with a rubric: accept without a grade and regrade the rubric with grade_assignment")
+			return
+		}
+
+		submission, err := s.getSubmission(request.SubmissionID, tenantID)
+		if err != nil {
+			log.Printf("Submission not found: %v", err)
+			respondWithError(w, http.StatusNotFound, "Submission not found")
+			return
+		}
+
+		feedback := submission.Feedback
+		if requestData.Feedback != nil {
+			feedback = *requestData.Feedback
+		}
+
+		if err := s.saveGrade(r.Context(), submission, *requestData.Grade, feedback, userID, request.Reason, GradeSourceRegrade); err != nil {
+			log.Printf("Failed to regrade submission: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to regrade submission")
+			return
+		}
+		if assignment.GradingRule == "best" {
+			if err := s.countBestAttempt(r.Context(), assignment, submission.StudentID); err != nil {
+				log.Printf("Failed to update counted attempt: %v", err)
+				respondWithError(w, http.StatusInternalServerError, "Failed to update counted attempt")
+				return
+			}
+		}
+	}
+
+	update := map[string]interface{}{
+		"status":     status,
+		"response":   requestData.Response,
+		"resolvedBy": userID,
+		"resolvedAt": time.Now().Format(time.RFC3339),
+	}
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		regradeRequestsCollectionID(),
+		request.ID,
+		update,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update regrade request: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update regrade request")
+		return
+	}
+
+	log.Printf("User %s %s regrade request %s", userID, status, request.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    update,
+	})
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// RubricCriterion is one row of an assignment's rubric. LevelTitles and
+// LevelPoints are parallel lists describing the achievable levels.
+type RubricCriterion struct {
+	ID           string   `json:"$id"`
+	AssignmentID string   `json:"assignmentId"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	LevelTitles  []string `json:"levelTitles"`
+	LevelPoints  []int    `json:"levelPoints"`
+	Position     int      `json:"position"`
+	TenantID     string   `json:"tenantId"`
+}
+
+// RubricScore is the level a grader picked for one criterion of a submission
+type RubricScore struct {
+	ID           string `json:"$id"`
+	SubmissionID string `json:"submissionId"`
+	CriterionID  string `json:"criterionId"`
+	Level        int    `json:"level"`
+	Points       int    `json:"points"`
+	Comment      string `json:"comment"`
+	GradedBy     string `json:"gradedBy"`
+	TenantID     string `json:"tenantId"`
+}
+
+func rubricCriteriaCollectionID() string {
+	return getEnv("APPWRITE_RUBRIC_CRITERIA_COLLECTION_ID", "rubric_criteria")
+}
+
+func rubricScoresCollectionID() string {
+	return getEnv("APPWRITE_RUBRIC_SCORES_COLLECTION_ID", "rubric_scores")
+}
+
+// maxPoints returns the points of the criterion's highest level
+func (c RubricCriterion) maxPoints() int {
+	max := 0
+	for _, points := range c.LevelPoints {
+		if points > max {
+			max = points
+		}
+	}
+	return max
+}
+
+// scoreRubric checks that every criterion has a valid level, fills in the
+// points of each score and returns the grade: the share of the rubric's
+// maximum points that was earned, scaled to 0-100
+func scoreRubric(criteria []RubricCriterion, scores []RubricScore) (int, error) {
+	byCriterion := make(map[string]*RubricScore)
+	for i := range scores {
+		byCriterion[scores[i].CriterionID] = &scores[i]
+	}
+
+	earned, possible := 0, 0
+	for _, criterion := range criteria {
+		possible += criterion.maxPoints()
+
+		score, ok := byCriterion[criterion.ID]
+		if !ok {
+			return 0, fmt.Errorf("criterion %q is not scored", criterion.Title)
+		}
+		if score.Level < 0 || score.Level >= len(criterion.LevelPoints) {
+			return 0, fmt.Errorf("criterion %q has no level %d", criterion.Title, score.Level)
+		}
+		score.Points = criterion.LevelPoints[score.Level]
+		earned += score.Points
+	}
+
+	if len(byCriterion) != len(criteria) {
+		return 0, fmt.Errorf("scores reference criteria that are not part of the rubric")
+	}
+	if possible == 0 {
+		return 0, fmt.Errorf("rubric is worth 0 points")
+	}
+
+	return int(math.Round(float64(earned) * 100 / float64(possible))), nil
+}
+
+// listRubricCriteria returns the rubric of an assignment in display order
+func (s *LMSService) listRubricCriteria(ctx context.Context, assignment *Assignment) ([]RubricCriterion, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		rubricCriteriaCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rubric criteria: %w", err)
+	}
+
+	var criteria []RubricCriterion
+	if err := json.Unmarshal([]byte(documents.(string)), &criteria); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rubric criteria: %w", err)
+	}
+
+	sort.Slice(criteria, func(i, j int) bool {
+		return criteria[i].Position < criteria[j].Position
+	})
+	return criteria, nil
+}
+
+// listRubricScores returns the rubric scores of a submission
+func (s *LMSService) listRubricScores(ctx context.Context, submission *Submission) ([]RubricScore, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		rubricScoresCollectionID(),
+		[]interface{}{
+			query.Equal("submissionId", submission.ID),
+			query.Equal("tenantId", submission.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rubric scores: %w", err)
+	}
+
+	var scores []RubricScore
+	if err := json.Unmarshal([]byte(documents.(string)), &scores); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rubric scores: %w", err)
+	}
+	return scores, nil
+}
+
+// rubricInUse reports whether any submission was graded with the criteria
+func (s *LMSService) rubricInUse(ctx context.Context, criteria []RubricCriterion) (bool, error) {
+	for _, criterion := range criteria {
+		documents, err := s.db.ListDocuments(
+			ctx,
+			s.databaseID,
+			rubricScoresCollectionID(),
+			[]interface{}{
+				query.Equal("criterionId", criterion.ID),
+				query.Limit(1),
+			},
+		)
+		if err != nil {
+			return false, fmt.Errorf("failed to list rubric scores: %w", err)
+		}
+
+		var scores []RubricScore
+		if err := json.Unmarshal([]byte(documents.(string)), &scores); err != nil {
+			return false, fmt.Errorf("failed to unmarshal rubric scores: %w", err)
+		}
+		if len(scores) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetRubric returns the rubric of an assignment
+func (s *LMSService) GetRubric(w http.ResponseWriter, r *http.Request) {
+	_, assignment, _, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	criteria, err := s.listRubricCriteria(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get rubric: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric")
+		return
+	}
+
+	maxPoints := 0
+	for _, criterion := range criteria {
+		maxPoints += criterion.maxPoints()
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    criteria,
+		"meta": map[string]interface{}{
+			"total":     len(criteria),
+			"maxPoints": maxPoints,
+		},
+	})
+}
+
+// UpdateRubric replaces the rubric of an assignment. Rubrics that were
+// already used for grading cannot be replaced.
+func (s *LMSService) UpdateRubric(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		Criteria []struct {
+			Title       string   `json:"title"`
+			Description string   `json:"description"`
+			LevelTitles []string `json:"levelTitles"`
+			LevelPoints []int    `json:"levelPoints"`
+		} `json:"criteria"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	maxPoints := 0
+	for i, criterion := range requestData.Criteria {
+		if criterion.Title == "" {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Criterion %d needs a title", i+1))
+			return
+		}
+		if len(criterion.LevelPoints) == 0 || len(criterion.LevelTitles) != len(criterion.LevelPoints) {
+			respondWithError(w, http.StatusBadRequest,
+				fmt.Sprintf("Criterion %q needs at least one level with a title and points", criterion.Title))
+			return
+		}
+		criterionMax := 0
+		for _, points := range criterion.LevelPoints {
+			if points < 0 {
+				respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Criterion %q has negative points", criterion.Title))
+				return
+			}
+			if points > criterionMax {
+				criterionMax = points
+			}
+		}
+		maxPoints += criterionMax
+	}
+	if len(requestData.Criteria) > 0 && maxPoints == 0 {
+		respondWithError(w, http.StatusBadRequest, "Rubric must be worth more than 0 points")
+		return
+	}
+
+	existing, err := s.listRubricCriteria(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get rubric: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric")
+		return
+	}
+
+	if assignment.PeerReviewsAssignedAt != "" {
+		respondWithError(w, http.StatusConflict, "Rubric is used by peer reviews and cannot be replaced")
+		return
+	}
+
+	inUse, err := s.rubricInUse(r.Context(), existing)
+	if err != nil {
+		log.Printf("Failed to check rubric usage: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to check rubric usage")
+		return
+	}
+	if inUse {
+		respondWithError(w, http.StatusConflict, "Rubric was already used for grading and cannot be replaced")
+		return
+	}
+
+	for _, criterion := range existing {
+		if _, err := s.db.DeleteDocument(s.databaseID, rubricCriteriaCollectionID(), criterion.ID); err != nil {
+			log.Printf("Failed to delete rubric criterion: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update rubric")
+			return
+		}
+	}
+
+	var created []interface{}
+	for i, criterion := range requestData.Criteria {
+		doc, err := s.db.CreateDocument(
+			r.Context(),
+			s.databaseID,
+			rubricCriteriaCollectionID(),
+			"unique()",
+			map[string]interface{}{
+				"assignmentId": assignment.ID,
+				"title":        criterion.Title,
+				"description":  criterion.Description,
+				"levelTitles":  criterion.LevelTitles,
+				"levelPoints":  criterion.LevelPoints,
+				"position":     i,
+				"tenantId":     assignment.TenantID,
+			},
+		)
+		if err != nil {
+			log.Printf("Failed to create rubric criterion: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to update rubric")
+			return
+		}
+		created = append(created, doc)
+	}
+
+	log.Printf("User %s updated the rubric of assignment %s (%d criteria)", userID, assignment.ID, len(created))
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    created,
+		"meta": map[string]interface{}{
+			"total":     len(created),
+			"maxPoints": maxPoints,
+		},
+	})
+}
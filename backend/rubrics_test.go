@@ -0,0 +1,117 @@
+package main
+
+import "testing"
+
+func TestScoreRubric(t *testing.T) {
+	criteria := []RubricCriterion{
+		{ID: "code", Title: "Code", LevelPoints: []int{0, 5, 10}},
+		{ID: "docs", Title: "Docs", LevelPoints: []int{0, 2, 5}},
+	}
+
+	tests := []struct {
+		name       string
+		criteria   []RubricCriterion
+		scores     []RubricScore
+		want       int
+		wantPoints []int
+		wantErr    bool
+	}{
+		{
+			name:     "full marks",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 2},
+				{CriterionID: "docs", Level: 2},
+			},
+			want:       100,
+			wantPoints: []int{10, 5},
+		},
+		{
+			name:     "partial marks are rounded",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "docs", Level: 1},
+				{CriterionID: "code", Level: 1},
+			},
+			want:       47,
+			wantPoints: []int{2, 5},
+		},
+		{
+			name:     "no marks",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 0},
+				{CriterionID: "docs", Level: 0},
+			},
+			want:       0,
+			wantPoints: []int{0, 0},
+		},
+		{
+			name:     "missing criterion",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 2},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "level out of range",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 3},
+				{CriterionID: "docs", Level: 0},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "negative level",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: -1},
+				{CriterionID: "docs", Level: 0},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unknown criterion",
+			criteria: criteria,
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 2},
+				{CriterionID: "docs", Level: 2},
+				{CriterionID: "style", Level: 1},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "rubric worth nothing",
+			criteria: []RubricCriterion{{ID: "code", Title: "Code", LevelPoints: []int{0}}},
+			scores: []RubricScore{
+				{CriterionID: "code", Level: 0},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scoreRubric(tt.criteria, tt.scores)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("scoreRubric = %d, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("scoreRubric returned error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("scoreRubric = %d, want %d", got, tt.want)
+			}
+			for i, score := range tt.scores {
+				if score.Points != tt.wantPoints[i] {
+					t.Errorf("points of %s = %d, want %d", score.CriterionID, score.Points, tt.wantPoints[i])
+				}
+			}
+		})
+	}
+}
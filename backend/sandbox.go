@@ -0,0 +1,475 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Test suites run in a throwaway Docker container per run: without network,
+// with a read-only root filesystem, and with the CPU, memory, process and
+// time limits of the assignment. The container sees
+//
+//	/work/submission  the student's files, read-only
+//	/work/tests       the test suite, a tmpfs only the harness user can read
+//	/work/results     where the suite writes results.json, a small tmpfs
+//
+// and runs the assignment's test command with sh -c in /work as the harness
+// user. The harness user owns /work/tests and /work/results; student code
+// must be started through $RUN_AS_STUDENT, which drops to nobody, so it
+// cannot read the suite's expected answers, forge the results or signal the
+// harness. The suite is not mounted from the host but streamed to the
+// entrypoint as a tar archive on stdin, which it unpacks as the harness user.
+// The suite reports its tests in $RESULTS_FILE as a JSON array of objects
+// with name, passed, points and message. Without that file the whole suite
+// counts as one test that passes when the command exits with 0.
+//
+// Nothing the container writes reaches the host filesystem. The entrypoint
+// script reports the exit code, the results file and the output on stdout,
+// which the test command and student code cannot write to.
+
+// Sandbox defaults and upper bounds
+const (
+	defaultSandboxImage     = "python:3.12-slim"
+	defaultTestTimeLimit    = 60 // seconds
+	maxTestTimeLimit        = 600
+	defaultTestMemoryLimit  = 512 // MB
+	maxTestMemoryLimit      = 4096
+	defaultTestCPULimit     = 1.0
+	maxTestCPULimit         = 4.0
+	sandboxPidsLimit        = 128
+	sandboxMaxOutputBytes   = 64 * 1024
+	sandboxResultsFileName  = "results.json"
+	sandboxMaxResultsBytes  = 256 * 1024
+	sandboxMaxExtractedSize = 256 * 1024 * 1024
+	maxTestSuiteSizeMB      = 32
+	sandboxHarnessUID       = 65533 // Must match sandboxEntrypoint
+)
+
+// sandboxEntrypoint runs as root with only CAP_SETUID and CAP_SETGID. It
+// unpacks the test suite from stdin as the harness user, then starts the test
+// command as the harness user, keeping those capabilities so the harness can
+// drop student code to nobody, then reports on its own stdout:
+//
+//	exit <code>
+//	results <base64 of results.json, if it is a regular file>
+//	output <base64 of the combined output>
+//
+// Only PID 1 holds the container's stdout; the test command writes to a log
+// on its own tmpfs, so a full log cannot keep the suite from writing its
+// results.
+const sandboxEntrypoint = `
+if ! command -v setpriv >/dev/null 2>&1; then
+	echo "error setpriv is not installed in the sandbox image"
+	exit 0
+fi
+if ! setpriv --reuid=65533 --regid=65533 --clear-groups \
+	sh -c 'umask 077; tar -xf - -C /work/tests' >/dev/null 2>&1; then
+	echo "error failed to unpack the test suite"
+	exit 0
+fi
+RUN_AS_STUDENT="setpriv --reuid=65534 --regid=65534 --clear-groups --inh-caps=-all --ambient-caps=-all --" \
+	setpriv --reuid=65533 --regid=65533 --clear-groups \
+	--inh-caps=+setuid,+setgid --ambient-caps=+setuid,+setgid \
+	sh -c 'umask 077; cd /work && exec sh -c "$TEST_COMMAND"' \
+	</dev/null >/work/log/output 2>&1
+echo "exit $?"
+if [ -f "$RESULTS_FILE" ] && [ ! -L "$RESULTS_FILE" ]; then
+	echo "results $(head -c 262145 "$RESULTS_FILE" | base64 | tr -d '\n')"
+fi
+echo "output $(head -c 65537 /work/log/output | base64 | tr -d '\n')"
+`
+
+// SandboxLimits bound the resources of one test run
+type SandboxLimits struct {
+	TimeLimit time.Duration
+	MemoryMB  int
+	CPUs      float64
+}
+
+// TestResult is the outcome of one test of a test suite
+type TestResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Points  int    `json:"points"` // 0 counts as 1
+	Message string `json:"message"`
+}
+
+// SandboxResult is the outcome of running a test suite
+type SandboxResult struct {
+	Tests    []TestResult
+	Output   string // Combined stdout and stderr, truncated
+	ExitCode int
+	TimedOut bool
+}
+
+// sandboxLimits returns the limits of the assignment's test runs, with
+// defaults for unset limits
+func sandboxLimits(assignment *Assignment) SandboxLimits {
+	limits := SandboxLimits{
+		TimeLimit: time.Duration(assignment.TestTimeLimitSeconds) * time.Second,
+		MemoryMB:  assignment.TestMemoryLimitMB,
+		CPUs:      assignment.TestCPULimit,
+	}
+	if limits.TimeLimit <= 0 {
+		limits.TimeLimit = defaultTestTimeLimit * time.Second
+	}
+	if limits.MemoryMB <= 0 {
+		limits.MemoryMB = defaultTestMemoryLimit
+	}
+	if limits.CPUs <= 0 {
+		limits.CPUs = defaultTestCPULimit
+	}
+	return limits
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
+
+// sandboxImageAllowed reports whether test suites may run in the image. The
+// default image is always allowed; AUTOGRADER_ALLOWED_IMAGES lists the others,
+// separated by commas.
+func sandboxImageAllowed(image string) bool {
+	if image == "" || strings.HasPrefix(image, "-") {
+		return false
+	}
+	if image == getEnv("AUTOGRADER_DEFAULT_IMAGE", defaultSandboxImage) {
+		return true
+	}
+	for _, allowed := range strings.Split(getEnv("AUTOGRADER_ALLOWED_IMAGES", ""), ",") {
+		if strings.TrimSpace(allowed) == image {
+			return true
+		}
+	}
+	return false
+}
+
+// newSandboxDir creates the directories of a run. The submission directory
+// is mounted into the sandbox and world-readable, because the test command
+// does not run as the host user. The tests directory stays private to the
+// host; runSandbox streams it into the container.
+func newSandboxDir() (string, error) {
+	dir, err := os.MkdirTemp("", "autograde-")
+	if err != nil {
+		return "", err
+	}
+	for sub, mode := range map[string]os.FileMode{"submission": 0755, "tests": 0700} {
+		if err := os.Mkdir(filepath.Join(dir, sub), mode); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// writeSandboxFile stores a file in a sandbox directory. Zip archives are
+// extracted in place.
+func writeSandboxFile(dir, name string, data []byte) error {
+	name = filepath.Base(name)
+	if name == "." || name == string(filepath.Separator) {
+		return fmt.Errorf("invalid file name")
+	}
+	if strings.EqualFold(filepath.Ext(name), ".zip") {
+		return extractZip(dir, data)
+	}
+	return os.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+// extractZip extracts a zip archive into dir. Entries that would land outside
+// dir are rejected.
+func extractZip(dir string, data []byte) error {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	var extracted int64
+	for _, file := range archive.File {
+		target := filepath.Join(dir, file.Name)
+		if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("zip entry %q is outside the archive", file.Name)
+		}
+
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			return fmt.Errorf("zip entry %q is not a regular file", file.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		src, err := file.Open()
+		if err != nil {
+			return err
+		}
+		dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			src.Close()
+			return err
+		}
+		n, err := io.Copy(dst, io.LimitReader(src, sandboxMaxExtractedSize-extracted+1))
+		src.Close()
+		dst.Close()
+		if err != nil {
+			return err
+		}
+		extracted += n
+		if extracted > sandboxMaxExtractedSize {
+			return fmt.Errorf("zip archive exceeds %d MB when extracted", sandboxMaxExtractedSize/1024/1024)
+		}
+	}
+	return nil
+}
+
+// tarDir archives the directories and regular files below dir, with names
+// relative to dir
+func tarDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = archive.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// runSandbox runs the test command in a container with the files prepared in
+// dir (see newSandboxDir). Errors are returned only when the sandbox itself
+// failed; failing tests and timeouts are part of the result.
+func runSandbox(ctx context.Context, dir, name, image, command string, limits SandboxLimits) (*SandboxResult, error) {
+	suite, err := tarDir(filepath.Join(dir, "tests"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive test suite: %w", err)
+	}
+
+	docker := getEnv("AUTOGRADER_DOCKER", "docker")
+	args := []string{
+		"run", "--rm", "-i",
+		"--name", name,
+		"--network", "none",
+		"--cpus", fmt.Sprintf("%g", limits.CPUs),
+		"--memory", fmt.Sprintf("%dm", limits.MemoryMB),
+		"--memory-swap", fmt.Sprintf("%dm", limits.MemoryMB),
+		"--pids-limit", fmt.Sprint(sandboxPidsLimit),
+		"--read-only",
+		"--tmpfs", "/tmp:rw,size=64m",
+		"--tmpfs", fmt.Sprintf("/work/results:rw,size=1m,uid=%d,gid=%d,mode=0700", sandboxHarnessUID, sandboxHarnessUID),
+		"--tmpfs", "/work/log:rw,size=16m,mode=0700",
+		"--tmpfs", fmt.Sprintf("/work/tests:rw,size=%d,uid=%d,gid=%d,mode=0700", sandboxMaxExtractedSize, sandboxHarnessUID, sandboxHarnessUID),
+		"--cap-drop", "ALL",
+		"--cap-add", "SETUID",
+		"--cap-add", "SETGID",
+		"--security-opt", "no-new-privileges",
+		"--user", "0:0",
+		"-v", filepath.Join(dir, "submission") + ":/work/submission:ro",
+		"-w", "/work",
+		"-e", "RESULTS_FILE=/work/results/" + sandboxResultsFileName,
+		"-e", "TEST_COMMAND=" + command,
+		"--entrypoint", "sh",
+		image,
+		"-c", sandboxEntrypoint,
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, limits.TimeLimit)
+	defer cancel()
+
+	// The entrypoint's report is base64, a third larger than what it encodes
+	stdout := &limitedBuffer{max: 2 * (sandboxMaxResultsBytes + sandboxMaxOutputBytes)}
+	stderr := &limitedBuffer{max: sandboxMaxOutputBytes}
+	cmd := exec.CommandContext(runCtx, docker, args...)
+	cmd.Stdin = bytes.NewReader(suite)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	result := &SandboxResult{}
+	err = cmd.Run()
+	if runCtx.Err() == context.DeadlineExceeded {
+		// Killing the client leaves the container running
+		result.TimedOut = true
+		exec.Command(docker, "kill", name).Run()
+	} else if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to start sandbox: %w", err)
+		}
+		// Docker reports its own failures, such as a missing image, as 125
+		return nil, fmt.Errorf("sandbox failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	report, err := parseSandboxReport(stdout.buf.Bytes())
+	if err != nil {
+		if result.TimedOut {
+			// Stopped before the entrypoint could report
+			report = &sandboxReport{}
+		} else {
+			return nil, err
+		}
+	}
+	result.ExitCode = report.exitCode
+	result.Output = report.output
+
+	// A broken results file fails the suite rather than the run
+	tests, err := readTestResults(report.results)
+	switch {
+	case err != nil:
+		tests = []TestResult{{Name: "Test suite", Points: 1, Message: err.Error()}}
+	case tests == nil:
+		tests = []TestResult{{
+			Name:   "Test suite",
+			Passed: !result.TimedOut && result.ExitCode == 0,
+			Points: 1,
+		}}
+	}
+	result.Tests = tests
+	return result, nil
+}
+
+// sandboxReport is what the sandbox entrypoint reports about a run
+type sandboxReport struct {
+	exitCode int
+	results  []byte // nil when the suite wrote no results file
+	output   string
+}
+
+// parseSandboxReport parses the lines the sandbox entrypoint writes to stdout
+func parseSandboxReport(data []byte) (*sandboxReport, error) {
+	report := &sandboxReport{}
+	exited := false
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "error":
+			return nil, fmt.Errorf("sandbox failed: %s", value)
+		case "exit":
+			code, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("sandbox reported an invalid exit code %q", value)
+			}
+			report.exitCode = code
+			exited = true
+		case "results":
+			results, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("sandbox reported invalid results: %w", err)
+			}
+			report.results = results
+		case "output":
+			output, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("sandbox reported invalid output: %w", err)
+			}
+			if len(output) > sandboxMaxOutputBytes {
+				report.output = string(output[:sandboxMaxOutputBytes]) + "\n[output truncated]"
+			} else {
+				report.output = string(output)
+			}
+		}
+	}
+	if !exited {
+		return nil, fmt.Errorf("sandbox exited without a report")
+	}
+	return report, nil
+}
+
+// readTestResults parses the results file of a test suite. It returns nil
+// when the suite wrote none.
+func readTestResults(data []byte) ([]TestResult, error) {
+	if data == nil {
+		return nil, nil
+	}
+	if len(data) > sandboxMaxResultsBytes {
+		return nil, fmt.Errorf("test suite wrote more than %d KB of %s", sandboxMaxResultsBytes/1024, sandboxResultsFileName)
+	}
+
+	var tests []TestResult
+	if err := json.Unmarshal(data, &tests); err != nil {
+		return nil, fmt.Errorf("test suite wrote invalid %s: %w", sandboxResultsFileName, err)
+	}
+	if len(tests) == 0 {
+		return nil, nil
+	}
+	for i := range tests {
+		if tests[i].Points <= 0 {
+			tests[i].Points = 1
+		}
+	}
+	return tests, nil
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// zipFile is an entry of a zip archive built by a test
+type zipFile struct {
+	name    string
+	content string
+	mode    os.FileMode
+}
+
+// zipArchive builds a zip archive of the given files, in order
+func zipArchive(t *testing.T, files ...zipFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		header.SetMode(file.mode)
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", file.name, err)
+		}
+		if _, err := w.Write([]byte(file.content)); err != nil {
+			t.Fatalf("failed to write %s: %v", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractZip(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []zipFile
+		wantFiles map[string]string
+		wantErr   bool
+	}{
+		{
+			name: "files and directories",
+			files: []zipFile{
+				{name: "src/", mode: os.ModeDir | 0755},
+				{name: "src/main.py", content: "print(1)", mode: 0644},
+				{name: "README.md", content: "# Solution", mode: 0644},
+				{name: "tests/data/input.txt", content: "42", mode: 0644},
+			},
+			wantFiles: map[string]string{
+				"src/main.py":          "print(1)",
+				"README.md":            "# Solution",
+				"tests/data/input.txt": "42",
+			},
+		},
+		{
+			name:    "entry outside the directory",
+			files:   []zipFile{{name: "../escaped.txt", content: "x", mode: 0644}},
+			wantErr: true,
+		},
+		{
+			name:    "entry outside the directory through a subdirectory",
+			files:   []zipFile{{name: "src/../../escaped.txt", content: "x", mode: 0644}},
+			wantErr: true,
+		},
+		{
+			name:    "symbolic link",
+			files:   []zipFile{{name: "link", content: "/etc/passwd", mode: os.ModeSymlink | 0777}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "submission")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := extractZip(dir, zipArchive(t, tt.files...))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("extractZip succeeded, want error")
+				}
+				if _, err := os.Stat(filepath.Join(parent, "escaped.txt")); err == nil {
+					t.Error("entry was written outside the directory")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractZip returned error: %v", err)
+			}
+			for name, want := range tt.wantFiles {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Errorf("failed to read %s: %v", name, err)
+					continue
+				}
+				if string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractZipInvalidArchive(t *testing.T) {
+	if err := extractZip(t.TempDir(), []byte("not a zip archive")); err == nil {
+		t.Error("extractZip succeeded, want error")
+	}
+}
+
+func TestWriteSandboxFile(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "submission")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the base name of an upload is used
+	if err := writeSandboxFile(dir, "../../solution.py", []byte("print(1)")); err != nil {
+		t.Fatalf("writeSandboxFile returned error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "solution.py")); err != nil || string(got) != "print(1)" {
+		t.Errorf("solution.py = %q, %v, want %q", got, err, "print(1)")
+	}
+
+	// Zip archives are extracted in place
+	archive := zipArchive(t, zipFile{name: "lib/util.py", content: "x = 1", mode: 0644})
+	if err := writeSandboxFile(dir, "Project.ZIP", archive); err != nil {
+		t.Fatalf("writeSandboxFile returned error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "lib", "util.py")); err != nil || string(got) != "x = 1" {
+		t.Errorf("lib/util.py = %q, %v, want %q", got, err, "x = 1")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Project.ZIP")); err == nil {
+		t.Error("archive was stored next to its files")
+	}
+
+	if err := writeSandboxFile(dir, "/", []byte("x")); err == nil {
+		t.Error("writeSandboxFile accepted an empty name")
+	}
+}
+
+func TestParseSandboxReport(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	results := `[{"name":"adds","passed":true,"points":2}]`
+
+	tests := []struct {
+		name        string
+		report      string
+		wantExit    int
+		wantResults []byte
+		wantOutput  string
+		wantErr     bool
+	}{
+		{
+			name:        "full report",
+			report:      "exit 1\nresults " + encode(results) + "\noutput " + encode("1 passed\n") + "\n",
+			wantExit:    1,
+			wantResults: []byte(results),
+			wantOutput:  "1 passed\n",
+		},
+		{
+			name:       "no results file",
+			report:     "exit 0\noutput " + encode("ok") + "\n",
+			wantOutput: "ok",
+		},
+		{
+			name:       "long output is truncated",
+			report:     "exit 0\noutput " + encode(strings.Repeat("x", sandboxMaxOutputBytes+1)) + "\n",
+			wantOutput: strings.Repeat("x", sandboxMaxOutputBytes) + "\n[output truncated]",
+		},
+		{
+			name:    "sandbox error",
+			report:  "error setpriv is not installed in the sandbox image\n",
+			wantErr: true,
+		},
+		{
+			name:    "no exit code",
+			report:  "output " + encode("ok") + "\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid exit code",
+			report:  "exit killed\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid results",
+			report:  "exit 0\nresults not-base64!\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSandboxReport([]byte(tt.report))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseSandboxReport = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSandboxReport returned error: %v", err)
+			}
+			if got.exitCode != tt.wantExit {
+				t.Errorf("exit code = %d, want %d", got.exitCode, tt.wantExit)
+			}
+			if !bytes.Equal(got.results, tt.wantResults) || (got.results == nil) != (tt.wantResults == nil) {
+				t.Errorf("results = %q, want %q", got.results, tt.wantResults)
+			}
+			if got.output != tt.wantOutput {
+				t.Errorf("output = %q, want %q", got.output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestReadTestResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []TestResult
+		wantErr bool
+	}{
+		{
+			name: "tests without points count as one",
+			data: []byte(`[{"name":"adds","passed":true,"points":3},{"name":"subtracts","passed":false,"message":"expected 1"}]`),
+			want: []TestResult{
+				{Name: "adds", Passed: true, Points: 3},
+				{Name: "subtracts", Passed: false, Points: 1, Message: "expected 1"},
+			},
+		},
+		{
+			name: "negative points count as one",
+			data: []byte(`[{"name":"adds","passed":true,"points":-5}]`),
+			want: []TestResult{{Name: "adds", Passed: true, Points: 1}},
+		},
+		{
+			name: "no results file",
+			data: nil,
+		},
+		{
+			name: "empty results",
+			data: []byte(`[]`),
+		},
+		{
+			name:    "invalid JSON",
+			data:    []byte(`{"passed":true}`),
+			wantErr: true,
+		},
+		{
+			name:    "too large",
+			data:    bytes.Repeat([]byte(" "), sandboxMaxResultsBytes+1),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readTestResults(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readTestResults = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readTestResults returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readTestResults = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTarDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"test_main.py":   "assert True",
+		"data/input.txt": "42",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(dir, "passwd")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := tarDir(dir)
+	if err != nil {
+		t.Fatalf("tarDir returned error: %v", err)
+	}
+
+	got := make(map[string]string)
+	archive := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read archive: %v", err)
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", header.Name, err)
+		}
+		got[header.Name] = string(content)
+	}
+
+	want := map[string]string{
+		"data":           "",
+		"data/input.txt": "42",
+		"test_main.py":   "assert True",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("archive holds %q, want %q", got, want)
+	}
+}
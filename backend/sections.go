@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// Section is one cohort of a course with its own instructors and roster
+type Section struct {
+	ID            string   `json:"$id"`
+	CourseID      string   `json:"courseId"`
+	Name          string   `json:"name"`
+	TermID        string   `json:"termId"`
+	Schedule      string   `json:"schedule"`
+	InstructorIDs []string `json:"instructorIds"`
+	StudentIDs    []string `json:"studentIds"`
+	TenantID      string   `json:"tenantId"`
+}
+
+// SectionDueDate overrides the due date of an assignment for one section
+type SectionDueDate struct {
+	ID           string `json:"$id"`
+	SectionID    string `json:"sectionId"`
+	AssignmentID string `json:"assignmentId"`
+	DueDate      string `json:"dueDate"`
+	TenantID     string `json:"tenantId"`
+}
+
+func sectionsCollectionID() string {
+	return getEnv("APPWRITE_SECTIONS_COLLECTION_ID", "sections")
+}
+
+func sectionDueDatesCollectionID() string {
+	return getEnv("APPWRITE_SECTION_DUE_DATES_COLLECTION_ID", "section_due_dates")
+}
+
+// getSection loads a section by ID. Sections of other tenants are reported as
+// not found.
+func (s *LMSService) getSection(sectionID, tenantID string) (*Section, error) {
+	doc, err := s.db.GetDocument(s.databaseID, sectionsCollectionID(), sectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var section Section
+	if err := json.Unmarshal([]byte(doc.(string)), &section); err != nil {
+		return nil, fmt.Errorf("failed to parse section: %w", err)
+	}
+
+	if section.TenantID != tenantID {
+		return nil, fmt.Errorf("section %s not found", sectionID)
+	}
+	return &section, nil
+}
+
+// listCourseSections returns all sections of a course
+func (s *LMSService) listCourseSections(ctx context.Context, courseID, tenantID string) ([]Section, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		sectionsCollectionID(),
+		[]interface{}{
+			query.Equal("courseId", courseID),
+			query.Equal("tenantId", tenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sections: %w", err)
+	}
+
+	var sections []Section
+	if err := json.Unmarshal([]byte(documents.(string)), &sections); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sections: %w", err)
+	}
+	return sections, nil
+}
+
+// courseInstructorIDs returns the instructors of all sections of a course
+func (s *LMSService) courseInstructorIDs(ctx context.Context, course *Course) ([]string, error) {
+	sections, err := s.listCourseSections(ctx, course.ID, course.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var instructorIDs []string
+	for _, section := range sections {
+		for _, id := range section.InstructorIDs {
+			if !contains(instructorIDs, id) {
+				instructorIDs = append(instructorIDs, id)
+			}
+		}
+	}
+	return instructorIDs, nil
+}
+
+// syncSection pushes the section and its course to Permit.io, so course-level
+// conditions also match section members.
+func (s *LMSService) syncSection(ctx context.Context, section *Section, course *Course) error {
+	resource := sectionResource(section, course)
+	resource.Tenant = section.TenantID
+	_, err := s.permit.Api.SyncResource(ctx, resource)
+	if err != nil {
+		return fmt.Errorf("failed to sync section: %w", err)
+	}
+
+	return s.syncCourse(ctx, course)
+}
+
+// sectionResource returns a section as a Permit.io resource with the
+// attributes its policy conditions read
+func sectionResource(section *Section, course *Course) *models.ResourceInput {
+	return &models.ResourceInput{
+		Type: "section",
+		Key:  section.ID,
+		Attributes: map[string]interface{}{
+			"courseId":      section.CourseID,
+			"teacherId":     course.TeacherID,
+			"instructorIds": section.InstructorIDs,
+			"studentIds":    section.StudentIDs,
+		},
+	}
+}
+
+// ListSections returns the sections of a course
+func (s *LMSService) ListSections(w http.ResponseWriter, r *http.Request) {
+	_, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "read")
+	if !ok {
+		return
+	}
+
+	sections, err := s.listCourseSections(r.Context(), course.ID, course.TenantID)
+	if err != nil {
+		log.Printf("Failed to get sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve sections")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    sections,
+		"meta": map[string]interface{}{
+			"total": len(sections),
+		},
+	})
+}
+
+// CreateSection adds a section to a course
+func (s *LMSService) CreateSection(w http.ResponseWriter, r *http.Request) {
+	tenantID := getContextTenant(r)
+
+	userID, course, ok := s.loadCourse(w, r, mux.Vars(r)["id"], "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var sectionData struct {
+		Name          string   `json:"name"`
+		Schedule      string   `json:"schedule"`
+		InstructorIDs []string `json:"instructorIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&sectionData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if sectionData.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	// The course teacher leads the section unless instructors are given
+	if len(sectionData.InstructorIDs) == 0 {
+		sectionData.InstructorIDs = []string{course.TeacherID}
+	}
+
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		sectionsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"courseId":      course.ID,
+			"name":          sectionData.Name,
+			"termId":        course.TermID,
+			"schedule":      sectionData.Schedule,
+			"instructorIds": sectionData.InstructorIDs,
+			"studentIds":    []string{},
+			"tenantId":      tenantID,
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating section: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create section")
+		return
+	}
+
+	section := &Section{
+		ID:            doc.Get("$id").(string),
+		CourseID:      course.ID,
+		Name:          sectionData.Name,
+		TermID:        course.TermID,
+		Schedule:      sectionData.Schedule,
+		InstructorIDs: sectionData.InstructorIDs,
+		StudentIDs:    []string{},
+		TenantID:      tenantID,
+	}
+
+	if err := s.syncSection(context.Background(), section, course); err != nil {
+		log.Printf("Warning: Failed to sync section with Permit.io: %v", err)
+	}
+
+	log.Printf("User %s created section %s in course %s", userID, section.ID, course.ID)
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    section,
+	})
+}
+
+// UpdateSectionInstructors replaces the instructors of a section
+func (s *LMSService) UpdateSectionInstructors(w http.ResponseWriter, r *http.Request) {
+	sectionID := mux.Vars(r)["id"]
+	tenantID := getContextTenant(r)
+
+	section, err := s.getSection(sectionID, tenantID)
+	if err != nil {
+		log.Printf("Section not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Section not found")
+		return
+	}
+
+	userID, course, ok := s.loadCourse(w, r, section.CourseID, "update")
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		InstructorIDs []string `json:"instructorIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if len(requestData.InstructorIDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one instructor is required")
+		return
+	}
+
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		sectionsCollectionID(),
+		section.ID,
+		map[string]interface{}{
+			"instructorIds": requestData.InstructorIDs,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update section: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update section")
+		return
+	}
+	section.InstructorIDs = requestData.InstructorIDs
+
+	if err := s.syncSection(context.Background(), section, course); err != nil {
+		log.Printf("Warning: Failed to sync section with Permit.io: %v", err)
+	}
+
+	log.Printf("User %s set instructors of section %s to %v", userID, section.ID, section.InstructorIDs)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    section,
+	})
+}
+
+// EnrollInSection adds the current student to a section and its course
+func (s *LMSService) EnrollInSection(w http.ResponseWriter, r *http.Request) {
+	sectionID := mux.Vars(r)["id"]
+	tenantID := getContextTenant(r)
+
+	section, err := s.getSection(sectionID, tenantID)
+	if err != nil {
+		log.Printf("Section not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Section not found")
+		return
+	}
+
+	userID, course, ok := s.loadCourse(w, r, section.CourseID, "enroll")
+	if !ok {
+		return
+	}
+
+	// Only published courses inside their enrollment window accept students
+	if err := checkEnrollmentOpen(course, time.Now()); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Students joining the course must meet its prerequisite courses
+	if !contains(course.StudentIDs, userID) {
+		reason, err := s.unmetCoursePrerequisite(r.Context(), course, userID)
+		if err != nil {
+			log.Printf("Failed to check course prerequisites: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to check course prerequisites")
+			return
+		}
+		if reason != "" {
+			respondWithError(w, http.StatusForbidden, reason)
+			return
+		}
+	}
+
+	// A student belongs to at most one section of a course
+	sections, err := s.listCourseSections(r.Context(), course.ID, tenantID)
+	if err != nil {
+		log.Printf("Failed to get sections: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve sections")
+		return
+	}
+	for _, other := range sections {
+		if contains(other.StudentIDs, userID) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Already enrolled in section %s", other.Name))
+			return
+		}
+	}
+
+	section.StudentIDs = append(section.StudentIDs, userID)
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		sectionsCollectionID(),
+		section.ID,
+		map[string]interface{}{
+			"studentIds": section.StudentIDs,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to enroll in section: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to enroll in section")
+		return
+	}
+
+	// Section students are also students of the course
+	if !contains(course.StudentIDs, userID) {
+		course.StudentIDs = append(course.StudentIDs, userID)
+		_, err = s.db.UpdateDocument(
+			s.databaseID,
+			getEnv("APPWRITE_COLLECTION_ID", "courses"),
+			course.ID,
+			map[string]interface{}{
+				"studentIds": course.StudentIDs,
+			},
+			nil, // permissions
+		)
+		if err != nil {
+			log.Printf("Failed to enroll in course: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to enroll in course")
+			return
+		}
+	}
+
+	if err := s.syncSection(context.Background(), section, course); err != nil {
+		log.Printf("Warning: Failed to sync section with Permit.io: %v", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "Successfully enrolled in section",
+		"data":    section,
+	})
+}
+
+// SetSectionDueDate overrides the due date of an assignment for a section
+func (s *LMSService) SetSectionDueDate(w http.ResponseWriter, r *http.Request) {
+	sectionID := mux.Vars(r)["id"]
+	tenantID := getContextTenant(r)
+
+	section, err := s.getSection(sectionID, tenantID)
+	if err != nil {
+		log.Printf("Section not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Section not found")
+		return
+	}
+
+	course, err := s.getCourse(section.CourseID, tenantID)
+	if err != nil {
+		log.Printf("Course not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	userID, ok := s.authorize(w, r, "update", sectionResource(section, course))
+	if !ok {
+		return
+	}
+
+	if err := checkCourseWritable(course); err != nil {
+		respondWithError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	var requestData struct {
+		AssignmentID string `json:"assignmentId"`
+		DueDate      string `json:"dueDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if requestData.AssignmentID == "" {
+		respondWithError(w, http.StatusBadRequest, "Assignment ID is required")
+		return
+	}
+
+	// The assignment must belong to the section's course
+	assignment, err := s.getAssignment(requestData.AssignmentID, tenantID)
+	if err != nil {
+		log.Printf("Assignment not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Assignment not found")
+		return
+	}
+	if assignment.CourseID != section.CourseID {
+		respondWithError(w, http.StatusBadRequest, "Assignment does not belong to the section's course")
+		return
+	}
+
+	// Store the due date as an instant; plain dates end at 23:59:59 in the
+	// course's timezone
+	loc, err := courseLocation(course)
+	if err != nil {
+		log.Printf("Failed to load course timezone: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process course timezone")
+		return
+	}
+	requestData.DueDate, err = normalizeDeadline(requestData.DueDate, loc)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Replace an existing override for the same assignment
+	documents, err := s.db.ListDocuments(
+		r.Context(),
+		s.databaseID,
+		sectionDueDatesCollectionID(),
+		[]interface{}{
+			query.Equal("sectionId", section.ID),
+			query.Equal("assignmentId", requestData.AssignmentID),
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to get due date overrides: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve due date overrides")
+		return
+	}
+	var overrides []SectionDueDate
+	if err := json.Unmarshal([]byte(documents.(string)), &overrides); err != nil {
+		log.Printf("Failed to unmarshal due date overrides: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process due date overrides")
+		return
+	}
+
+	if len(overrides) > 0 {
+		_, err = s.db.UpdateDocument(
+			s.databaseID,
+			sectionDueDatesCollectionID(),
+			overrides[0].ID,
+			map[string]interface{}{
+				"dueDate": requestData.DueDate,
+			},
+			nil, // permissions
+		)
+	} else {
+		_, err = s.db.CreateDocument(
+			r.Context(),
+			s.databaseID,
+			sectionDueDatesCollectionID(),
+			"unique()",
+			map[string]interface{}{
+				"sectionId":    section.ID,
+				"assignmentId": requestData.AssignmentID,
+				"dueDate":      requestData.DueDate,
+				"tenantId":     tenantID,
+			},
+		)
+	}
+	if err != nil {
+		log.Printf("Failed to save due date override: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to save due date override")
+		return
+	}
+
+	log.Printf("User %s set due date of assignment %s to %s for section %s",
+		userID, requestData.AssignmentID, requestData.DueDate, section.ID)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"sectionId":    section.ID,
+			"assignmentId": requestData.AssignmentID,
+			"dueDate":      requestData.DueDate,
+		},
+	})
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// Similarity checks compare the counted submissions of an assignment with
+// winnowing, as in MOSS. Each submission is split into tokens, every run of
+// similarityKGram tokens is hashed, and of every similarityWindow consecutive
+// hashes the smallest is kept as a fingerprint. Two submissions are as similar
+// as the share of the smaller one's fingerprints found in the other.
+// Lowercasing and ignoring whitespace make reformatted copies match.
+
+// Similarity report states
+const (
+	SimilarityRunning   = "running"
+	SimilarityCompleted = "completed"
+	SimilarityFailed    = "failed"
+)
+
+const (
+	similarityKGram            = 5
+	similarityWindow           = 4
+	defaultSimilarityThreshold = 40 // percent
+	// similarityStaleAfter is when a running check is taken to have died with
+	// its backend, and a new one may start
+	similarityStaleAfter = 30 * time.Minute
+)
+
+// SimilarityReport is one similarity check of an assignment
+type SimilarityReport struct {
+	ID           string `json:"$id"`
+	AssignmentID string `json:"assignmentId"`
+	Status       string `json:"status"`    // running, completed or failed
+	Threshold    int    `json:"threshold"` // Smallest score stored as a match
+	Submissions  int    `json:"submissions"`
+	Matches      int    `json:"matches"`
+	Error        string `json:"error"`
+	StartedBy    string `json:"startedBy"`
+	StartedAt    string `json:"startedAt"`
+	FinishedAt   string `json:"finishedAt"`
+	TenantID     string `json:"tenantId"`
+}
+
+// SimilarityMatch is a pair of submissions whose similarity reached the
+// report's threshold
+type SimilarityMatch struct {
+	ID                 string `json:"$id"`
+	ReportID           string `json:"reportId"`
+	AssignmentID       string `json:"assignmentId"`
+	SubmissionA        string `json:"submissionA"`
+	StudentA           string `json:"studentA"`
+	SubmissionB        string `json:"submissionB"`
+	StudentB           string `json:"studentB"`
+	Score              int    `json:"score"` // 0-100
+	SharedFingerprints int    `json:"sharedFingerprints"`
+	TenantID           string `json:"tenantId"`
+}
+
+func similarityReportsCollectionID() string {
+	return getEnv("APPWRITE_SIMILARITY_REPORTS_COLLECTION_ID", "similarity_reports")
+}
+
+func similarityMatchesCollectionID() string {
+	return getEnv("APPWRITE_SIMILARITY_MATCHES_COLLECTION_ID", "similarity_matches")
+}
+
+// tokenize splits text into lowercased words and single punctuation
+// characters, dropping whitespace
+func tokenize(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			word.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens = append(tokens, string(r))
+		}
+	}
+	flush()
+	return tokens
+}
+
+// fingerprints returns the winnowed fingerprints of text
+func fingerprints(text string) map[uint64]bool {
+	tokens := tokenize(text)
+	result := make(map[uint64]bool)
+	if len(tokens) < similarityKGram {
+		return result
+	}
+
+	hashes := make([]uint64, 0, len(tokens)-similarityKGram+1)
+	for i := 0; i+similarityKGram <= len(tokens); i++ {
+		h := fnv.New64a()
+		for _, token := range tokens[i : i+similarityKGram] {
+			h.Write([]byte(token))
+			h.Write([]byte{0})
+		}
+		hashes = append(hashes, h.Sum64())
+	}
+
+	// Short texts are a single window
+	window := similarityWindow
+	if len(hashes) < window {
+		window = len(hashes)
+	}
+	for start := 0; start+window <= len(hashes); start++ {
+		smallest := start
+		for i := start + 1; i < start+window; i++ {
+			// The rightmost minimum, so equal runs select few fingerprints
+			if hashes[i] <= hashes[smallest] {
+				smallest = i
+			}
+		}
+		result[hashes[smallest]] = true
+	}
+	return result
+}
+
+// similarity returns the share of the smaller fingerprint set found in the
+// other, scaled to 0-100, and the number of shared fingerprints
+func similarity(a, b map[uint64]bool) (int, int) {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) == 0 {
+		return 0, 0
+	}
+	shared := 0
+	for fingerprint := range a {
+		if b[fingerprint] {
+			shared++
+		}
+	}
+	return shared * 100 / len(a), shared
+}
+
+// similarityResource returns the similarity report of an assignment as a
+// Permit.io resource
+func similarityResource(assignment *Assignment, course *Course) *models.ResourceInput {
+	return &models.ResourceInput{
+		Type: "similarity_report",
+		Key:  assignment.ID,
+		Attributes: map[string]interface{}{
+			"courseId":  course.ID,
+			"teacherId": course.TeacherID,
+		},
+	}
+}
+
+// loadSimilarityAssignment loads an assignment and its course, and checks
+// that the current user may perform action on its similarity reports. It
+// writes an error response and returns false when the request must not
+// proceed.
+func (s *LMSService) loadSimilarityAssignment(w http.ResponseWriter, r *http.Request, action string) (string, *Assignment, *Course, bool) {
+	tenantID := getContextTenant(r)
+
+	assignment, err := s.getAssignment(mux.Vars(r)["id"], tenantID)
+	if err != nil {
+		log.Printf("Assignment not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Assignment not found")
+		return "", nil, nil, false
+	}
+
+	course, err := s.getCourse(assignment.CourseID, tenantID)
+	if err != nil {
+		log.Printf("Course not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return "", nil, nil, false
+	}
+
+	userID, ok := s.authorize(w, r, action, similarityResource(assignment, course))
+	if !ok {
+		return "", nil, nil, false
+	}
+	return userID, assignment, course, true
+}
+
+// listSimilarityReports returns the similarity reports of an assignment,
+// newest first
+func (s *LMSService) listSimilarityReports(ctx context.Context, assignment *Assignment) ([]SimilarityReport, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		similarityReportsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list similarity reports: %w", err)
+	}
+
+	var reports []SimilarityReport
+	if err := json.Unmarshal([]byte(documents.(string)), &reports); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal similarity reports: %w", err)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].StartedAt > reports[j].StartedAt
+	})
+	return reports, nil
+}
+
+// listSimilarityMatches returns the matches of a report
+func (s *LMSService) listSimilarityMatches(ctx context.Context, report *SimilarityReport) ([]SimilarityMatch, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		similarityMatchesCollectionID(),
+		[]interface{}{
+			query.Equal("reportId", report.ID),
+			query.Equal("tenantId", report.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list similarity matches: %w", err)
+	}
+
+	var matches []SimilarityMatch
+	if err := json.Unmarshal([]byte(documents.(string)), &matches); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal similarity matches: %w", err)
+	}
+	return matches, nil
+}
+
+// submissionText returns the content of a submission with its text
+// attachments
+func (s *LMSService) submissionText(submission *Submission) (string, error) {
+	parts := []string{submission.Content}
+	for _, attachmentID := range submission.AttachmentIDs {
+		attachment, err := s.getAttachment(attachmentID, submission.TenantID)
+		if err != nil {
+			return "", fmt.Errorf("attachment %s not found: %w", attachmentID, err)
+		}
+		if !strings.HasPrefix(attachment.MimeType, "text/") {
+			continue
+		}
+		data, err := s.storage.GetFileDownload(submissionsBucketID(), attachment.FileID)
+		if err != nil {
+			return "", fmt.Errorf("failed to download attachment %s: %w", attachmentID, err)
+		}
+		parts = append(parts, string(data))
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// runSimilarityCheck compares the counted submissions of every student and
+// stores the pairs that reach the report's threshold. The matches of earlier
+// reports of the assignment are removed once it completes.
+func (s *LMSService) runSimilarityCheck(ctx context.Context, report SimilarityReport, assignment *Assignment, course *Course) {
+	matches, submissions, err := s.compareSubmissions(ctx, report, assignment, course)
+
+	data := map[string]interface{}{
+		"status":      SimilarityCompleted,
+		"submissions": submissions,
+		"matches":     matches,
+		"finishedAt":  time.Now().Format(time.RFC3339),
+	}
+	if err != nil {
+		log.Printf("Similarity check %s of assignment %s failed: %v", report.ID, assignment.ID, err)
+		data["status"] = SimilarityFailed
+		data["error"] = err.Error()
+	}
+
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		similarityReportsCollectionID(),
+		report.ID,
+		data,
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update similarity report %s: %v", report.ID, err)
+		return
+	}
+	if data["status"] != SimilarityCompleted {
+		return
+	}
+
+	log.Printf("Similarity check %s of assignment %s found %d matches among %d submissions", report.ID, assignment.ID, matches, submissions)
+
+	reports, err := s.listSimilarityReports(ctx, assignment)
+	if err != nil {
+		log.Printf("Failed to get earlier similarity reports: %v", err)
+		return
+	}
+	for i := range reports {
+		if reports[i].ID == report.ID || reports[i].StartedAt > report.StartedAt {
+			continue
+		}
+		old, err := s.listSimilarityMatches(ctx, &reports[i])
+		if err != nil {
+			log.Printf("Failed to get matches of similarity report %s: %v", reports[i].ID, err)
+			continue
+		}
+		for _, match := range old {
+			if _, err := s.db.DeleteDocument(s.databaseID, similarityMatchesCollectionID(), match.ID); err != nil {
+				log.Printf("Failed to delete similarity match %s: %v", match.ID, err)
+			}
+		}
+	}
+}
+
+// compareSubmissions fingerprints the counted submissions and stores the
+// matches of a report. It returns the number of matches and submissions.
+func (s *LMSService) compareSubmissions(ctx context.Context, report SimilarityReport, assignment *Assignment, course *Course) (int, int, error) {
+	counted, err := s.listCountedSubmissions(ctx, course, []Assignment{*assignment}, "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get submissions: %w", err)
+	}
+
+	type fingerprinted struct {
+		submission   Submission
+		fingerprints map[uint64]bool
+	}
+	var submissions []fingerprinted
+	for _, byAssignment := range counted {
+		submission, ok := byAssignment[assignment.ID]
+		if !ok {
+			continue
+		}
+		text, err := s.submissionText(&submission)
+		if err != nil {
+			return 0, 0, err
+		}
+		submissions = append(submissions, fingerprinted{submission, fingerprints(text)})
+	}
+
+	// Compare in a fixed order, so reruns list pairs the same way
+	sort.Slice(submissions, func(i, j int) bool {
+		return submissions[i].submission.StudentID < submissions[j].submission.StudentID
+	})
+
+	matches := 0
+	for i := range submissions {
+		for j := i + 1; j < len(submissions); j++ {
+			a, b := submissions[i], submissions[j]
+			score, shared := similarity(a.fingerprints, b.fingerprints)
+			if score < report.Threshold || shared == 0 {
+				continue
+			}
+
+			_, err := s.db.CreateDocument(
+				ctx,
+				s.databaseID,
+				similarityMatchesCollectionID(),
+				"unique()",
+				map[string]interface{}{
+					"reportId":           report.ID,
+					"assignmentId":       assignment.ID,
+					"submissionA":        a.submission.ID,
+					"studentA":           a.submission.StudentID,
+					"submissionB":        b.submission.ID,
+					"studentB":           b.submission.StudentID,
+					"score":              score,
+					"sharedFingerprints": shared,
+					"tenantId":           assignment.TenantID,
+				},
+			)
+			if err != nil {
+				return matches, len(submissions), fmt.Errorf("failed to store similarity match: %w", err)
+			}
+			matches++
+		}
+	}
+	return matches, len(submissions), nil
+}
+
+// StartSimilarityCheck starts a similarity check of an assignment in the
+// background. Only one check of an assignment runs at a time.
+func (s *LMSService) StartSimilarityCheck(w http.ResponseWriter, r *http.Request) {
+	userID, assignment, course, ok := s.loadSimilarityAssignment(w, r, "run")
+	if !ok {
+		return
+	}
+
+	var requestData struct {
+		Threshold *int `json:"threshold"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	threshold := defaultSimilarityThreshold
+	if requestData.Threshold != nil {
+		threshold = *requestData.Threshold
+	}
+	if threshold < 1 || threshold > 100 {
+		respondWithError(w, http.StatusBadRequest, "Threshold must be from 1 to 100")
+		return
+	}
+
+	reports, err := s.listSimilarityReports(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get similarity reports: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve similarity reports")
+		return
+	}
+	now := time.Now()
+	for _, report := range reports {
+		startedAt, err := time.Parse(time.RFC3339, report.StartedAt)
+		if report.Status == SimilarityRunning && err == nil && now.Sub(startedAt) < similarityStaleAfter {
+			respondWithError(w, http.StatusConflict, "A similarity check of this assignment is already running")
+			return
+		}
+	}
+
+	report := SimilarityReport{
+		AssignmentID: assignment.ID,
+		Status:       SimilarityRunning,
+		Threshold:    threshold,
+		StartedBy:    userID,
+		StartedAt:    now.Format(time.RFC3339),
+		TenantID:     assignment.TenantID,
+	}
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		similarityReportsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"assignmentId": report.AssignmentID,
+			"status":       report.Status,
+			"threshold":    report.Threshold,
+			"startedBy":    report.StartedBy,
+			"startedAt":    report.StartedAt,
+			"tenantId":     report.TenantID,
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to create similarity report: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to start similarity check")
+		return
+	}
+	report.ID = fmt.Sprint(doc.Get("$id"))
+
+	// The check outlives the request
+	go s.runSimilarityCheck(context.Background(), report, assignment, course)
+
+	log.Printf("User %s started similarity check %s of assignment %s", userID, report.ID, assignment.ID)
+
+	respondWithJSON(w, http.StatusAccepted, map[string]interface{}{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// GetSimilarityReport returns the latest similarity report of an assignment
+// with its matches, most similar first. While the latest check runs, the
+// report is returned without matches. Under blind grading, students are
+// shown as pseudonyms.
+func (s *LMSService) GetSimilarityReport(w http.ResponseWriter, r *http.Request) {
+	_, assignment, course, ok := s.loadSimilarityAssignment(w, r, "read")
+	if !ok {
+		return
+	}
+
+	reports, err := s.listSimilarityReports(r.Context(), assignment)
+	if err != nil {
+		log.Printf("Failed to get similarity reports: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve similarity reports")
+		return
+	}
+	if len(reports) == 0 {
+		respondWithError(w, http.StatusNotFound, "Assignment was not checked for similarity")
+		return
+	}
+	report := reports[0]
+
+	matches := []SimilarityMatch{}
+	if report.Status == SimilarityCompleted {
+		matches, err = s.listSimilarityMatches(r.Context(), &report)
+		if err != nil {
+			log.Printf("Failed to get similarity matches: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve similarity matches")
+			return
+		}
+	}
+
+	masked := identitiesMasked(assignment, course, time.Now())
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+	for i := range matches {
+		matches[i].StudentA = maskStudent(assignment, masked, matches[i].StudentA)
+		matches[i].StudentB = maskStudent(assignment, masked, matches[i].StudentB)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"report":  report,
+			"matches": matches,
+		},
+		"meta": map[string]interface{}{
+			"total": len(matches),
+		},
+	})
+}
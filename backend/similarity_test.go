@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "words and punctuation",
+			text: "x := foo(bar, 42)",
+			want: []string{"x", ":", "=", "foo", "(", "bar", ",", "42", ")"},
+		},
+		{
+			name: "case and whitespace are ignored",
+			text: "  Return\tmy_Value\n",
+			want: []string{"return", "my_value"},
+		},
+		{
+			name: "empty text",
+			text: " \n\t",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	const original = "func sum(values []int) int { total := 0; for _, v := range values { total += v }; return total }"
+
+	tests := []struct {
+		name      string
+		a, b      string
+		wantScore int
+		wantEmpty bool
+	}{
+		{
+			name:      "identical texts",
+			a:         original,
+			b:         original,
+			wantScore: 100,
+		},
+		{
+			name:      "reformatted copy",
+			a:         original,
+			b:         "FUNC sum(values []int) int {\n\ttotal := 0;\n\tfor _, v := range values {\n\t\ttotal += v\n\t};\n\treturn total\n}",
+			wantScore: 100,
+		},
+		{
+			name:      "unrelated texts",
+			a:         original,
+			b:         "The mitochondria is the powerhouse of the cell, as every biology student learns early on.",
+			wantScore: 0,
+		},
+		{
+			name:      "texts shorter than a k-gram",
+			a:         "a b c",
+			b:         "a b c",
+			wantScore: 0,
+			wantEmpty: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := fingerprints(tt.a), fingerprints(tt.b)
+			if tt.wantEmpty != (len(a) == 0) {
+				t.Fatalf("got %d fingerprints, want empty = %v", len(a), tt.wantEmpty)
+			}
+			if score, _ := similarity(a, b); score != tt.wantScore {
+				t.Errorf("similarity = %d, want %d", score, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestFingerprintsShortText(t *testing.T) {
+	// Texts with fewer hashes than a window still get one fingerprint
+	if got := fingerprints("a b c d e f"); len(got) != 1 {
+		t.Errorf("got %d fingerprints, want 1", len(got))
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       map[uint64]bool
+		wantScore  int
+		wantShared int
+	}{
+		{
+			name:       "smaller set fully contained",
+			a:          map[uint64]bool{1: true, 2: true},
+			b:          map[uint64]bool{1: true, 2: true, 3: true, 4: true},
+			wantScore:  100,
+			wantShared: 2,
+		},
+		{
+			name:       "order does not matter",
+			a:          map[uint64]bool{1: true, 2: true, 3: true, 4: true},
+			b:          map[uint64]bool{1: true, 2: true},
+			wantScore:  100,
+			wantShared: 2,
+		},
+		{
+			name:       "partial overlap",
+			a:          map[uint64]bool{1: true, 2: true, 3: true},
+			b:          map[uint64]bool{3: true, 4: true, 5: true},
+			wantScore:  33,
+			wantShared: 1,
+		},
+		{
+			name:       "empty set",
+			a:          map[uint64]bool{},
+			b:          map[uint64]bool{1: true},
+			wantScore:  0,
+			wantShared: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, shared := similarity(tt.a, tt.b)
+			if score != tt.wantScore || shared != tt.wantShared {
+				t.Errorf("similarity = %d, %d, want %d, %d", score, shared, tt.wantScore, tt.wantShared)
+			}
+		})
+	}
+}
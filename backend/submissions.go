@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+)
+
+// Submission is one attempt of a student at an assignment
+type Submission struct {
+	ID                 string        `json:"$id"`
+	AssignmentID       string        `json:"assignmentId"`
+	StudentID          string        `json:"studentId"`
+	Content            string        `json:"content"`
+	SubmittedAt        string        `json:"submittedAt"`
+	Grade              int           `json:"grade"`
+	RawGrade           int           `json:"rawGrade"`
+	Feedback           string        `json:"feedback"`
+	TenantID           string        `json:"tenantId"`
+	Late               bool          `json:"late"`
+	MinutesLate        int           `json:"minutesLate"`
+	LatePenaltyPercent int           `json:"latePenaltyPercent"`
+	Attempt            int           `json:"attempt"`
+	Counted            bool          `json:"counted"`
+	GradedAt           string        `json:"gradedAt"`
+	AttachmentIDs      []string      `json:"attachmentIds"`
+	Status             string        `json:"status"`
+	SavedAt            string        `json:"savedAt"`
+	StartedAt          string        `json:"startedAt"`       // When a quiz attempt was started
+	QuestionOrder      []string      `json:"questionOrder"`   // Quiz question IDs in the order shown
+	AutogradeRunID     string        `json:"autogradeRunId"`  // Latest autograde run
+	AutogradeStatus    string        `json:"autogradeStatus"` // Status of the latest autograde run
+	RubricScores       []RubricScore `json:"rubricScores,omitempty"`
+	GradeHidden        bool          `json:"gradeHidden,omitempty"` // Grades not released yet
+}
+
+func submissionsCollectionID() string {
+	return getEnv("APPWRITE_SUBMISSIONS_COLLECTION_ID", "submissions")
+}
+
+// listStudentAttempts returns a student's submitted attempts for an
+// assignment, ordered by attempt number. Drafts are left out.
+func (s *LMSService) listStudentAttempts(ctx context.Context, assignment *Assignment, studentID string) ([]Submission, error) {
+	documents, err := s.db.ListDocuments(
+		ctx,
+		s.databaseID,
+		submissionsCollectionID(),
+		[]interface{}{
+			query.Equal("assignmentId", assignment.ID),
+			query.Equal("studentId", studentID),
+			query.Equal("tenantId", assignment.TenantID),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var submissions []Submission
+	if err := json.Unmarshal([]byte(documents.(string)), &submissions); err != nil {
+		return nil, err
+	}
+
+	var attempts []Submission
+	for _, submission := range submissions {
+		if submission.Status != SubmissionStatusDraft {
+			attempts = append(attempts, submission)
+		}
+	}
+
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].Attempt < attempts[j].Attempt
+	})
+	return attempts, nil
+}
+
+// ListAttempts returns the attempt history of a student for an assignment.
+// Students see their own attempts; viewing another student's attempts
+// requires permission to grade the assignment, and under blind grading the
+// student's pseudonym.
+func (s *LMSService) ListAttempts(w http.ResponseWriter, r *http.Request) {
+	user, ok := getContextUser(r)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	currentUserID, _ := user["id"].(string)
+	studentID := r.URL.Query().Get("studentId")
+	if studentID == "" {
+		studentID = currentUserID
+	}
+
+	action := "read"
+	if studentID != currentUserID {
+		action = "grade"
+	}
+
+	_, assignment, course, ok := s.loadAssignmentCourse(w, r, mux.Vars(r)["id"], action)
+	if !ok {
+		return
+	}
+
+	// Under blind grading, graders ask for students by pseudonym
+	masked := action == "grade" && identitiesMasked(assignment, course, time.Now())
+	if masked && !checkBlindGradingConfigured(w) {
+		return
+	}
+	if masked {
+		resolved, err := resolvePseudonym(assignment, course, studentID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Assignment is blind graded: studentId must be a pseudonym")
+			return
+		}
+		studentID = resolved
+	}
+
+	attempts, err := s.listStudentAttempts(r.Context(), assignment, studentID)
+	if err != nil {
+		log.Printf("Failed to get attempts: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve attempts")
+		return
+	}
+
+	// Students only see grades once they are released
+	hidden := action == "read" && !gradesReleased(assignment, course, time.Now())
+
+	for i := range attempts {
+		attempts[i].StudentID = maskStudent(assignment, masked, attempts[i].StudentID)
+		if hidden {
+			hideGrade(&attempts[i])
+			continue
+		}
+		attempts[i].RubricScores, err = s.listRubricScores(r.Context(), &attempts[i])
+		if err != nil {
+			log.Printf("Failed to get rubric scores: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Failed to retrieve rubric scores")
+			return
+		}
+	}
+
+	gradingRule := assignment.GradingRule
+	if gradingRule == "" {
+		gradingRule = "latest"
+	}
+
+	attemptsLeft := -1
+	if assignment.MaxAttempts > 0 {
+		attemptsLeft = assignment.MaxAttempts - len(attempts)
+		if attemptsLeft < 0 {
+			attemptsLeft = 0
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    attempts,
+		"meta": map[string]interface{}{
+			"total":        len(attempts),
+			"maxAttempts":  assignment.MaxAttempts,
+			"attemptsLeft": attemptsLeft,
+			"gradingRule":  gradingRule,
+		},
+	})
+}
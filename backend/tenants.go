@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+)
+
+// Organizations (schools) are modelled as Appwrite teams. The team ID is used
+// as the tenant key in Permit.io and stored as tenantId on every course,
+// assignment and submission document.
+
+// Membership mirrors an Appwrite team membership
+type Membership struct {
+	ID      string `json:"$id"`
+	TeamID  string `json:"teamId"`
+	UserID  string `json:"userId"`
+	Confirm bool   `json:"confirm"`
+}
+
+// Team mirrors an Appwrite team
+type Team struct {
+	ID   string `json:"$id"`
+	Name string `json:"name"`
+}
+
+// defaultTenant is used for users that do not belong to any organization, so
+// single-school deployments keep working with Permit.io's default tenant.
+func defaultTenant() string {
+	return getEnv("DEFAULT_TENANT", "default")
+}
+
+// userTenants returns the organizations the user is a confirmed member of
+func (s *LMSService) userTenants(userID string) ([]string, error) {
+	result, err := s.users.ListMemberships(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	var memberships []Membership
+	if err := json.Unmarshal([]byte(result.(string)), &memberships); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal memberships: %w", err)
+	}
+
+	var tenants []string
+	for _, m := range memberships {
+		if m.Confirm {
+			tenants = append(tenants, m.TeamID)
+		}
+	}
+	return tenants, nil
+}
+
+// tenantMembers returns the IDs of all confirmed members of the organization
+func (s *LMSService) tenantMembers(tenantID string) ([]string, error) {
+	result, err := s.teams.ListMemberships(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+
+	var memberships []Membership
+	if err := json.Unmarshal([]byte(result.(string)), &memberships); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal memberships: %w", err)
+	}
+
+	var members []string
+	for _, m := range memberships {
+		if m.Confirm {
+			members = append(members, m.UserID)
+		}
+	}
+	return members, nil
+}
+
+// organizationMembers returns the IDs of the confirmed members of every
+// organization, so the default tenant can be told apart without looking up
+// each user's memberships
+func (s *LMSService) organizationMembers(ctx context.Context) (map[string]bool, error) {
+	members := make(map[string]bool)
+	cursor := ""
+	for {
+		queries := []interface{}{query.Limit(listPageSize)}
+		if cursor != "" {
+			queries = append(queries, query.CursorAfter(cursor))
+		}
+		result, err := s.teams.List(ctx, queries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list teams: %w", err)
+		}
+
+		var teams []Team
+		if err := json.Unmarshal([]byte(result.(string)), &teams); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal teams: %w", err)
+		}
+		for _, team := range teams {
+			ids, err := s.tenantMembers(team.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				members[id] = true
+			}
+		}
+		if len(teams) < listPageSize {
+			return members, nil
+		}
+		cursor = teams[len(teams)-1].ID
+	}
+}
+
+// inTenant reports whether the user belongs to the tenant. Only users outside
+// every organization belong to the default tenant.
+func (s *LMSService) inTenant(userID, tenantID string) (bool, error) {
+	tenants, err := s.userTenants(userID)
+	if err != nil {
+		return false, err
+	}
+	if tenantID == defaultTenant() {
+		return len(tenants) == 0, nil
+	}
+	return contains(tenants, tenantID), nil
+}
+
+// resolveTenant picks the organization a request acts in. Users in several
+// organizations must choose one with the X-Tenant-ID header.
+func (s *LMSService) resolveTenant(r *http.Request, userID string) (string, error) {
+	tenants, err := s.userTenants(userID)
+	if err != nil {
+		return "", err
+	}
+
+	requested := r.Header.Get("X-Tenant-ID")
+
+	switch {
+	case len(tenants) == 0:
+		if requested != "" && requested != defaultTenant() {
+			return "", fmt.Errorf("user is not a member of organization %s", requested)
+		}
+		return defaultTenant(), nil
+	case requested == "":
+		if len(tenants) > 1 {
+			return "", fmt.Errorf("user belongs to several organizations, X-Tenant-ID header is required")
+		}
+		return tenants[0], nil
+	case contains(tenants, requested):
+		return requested, nil
+	default:
+		return "", fmt.Errorf("user is not a member of organization %s", requested)
+	}
+}
+
+// getContextTenant returns the organization of the authenticated user
+func getContextTenant(r *http.Request) string {
+	user, ok := getContextUser(r)
+	if !ok {
+		return ""
+	}
+	tenant, _ := user["tenant"].(string)
+	return tenant
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/appwrite/go-sdk/appwrite/query"
+	"github.com/gorilla/mux"
+	"github.com/permitio/permit-golang/pkg/permit/models"
+)
+
+// Course lifecycle states
+const (
+	CourseStatusDraft     = "draft"
+	CourseStatusPublished = "published"
+	CourseStatusArchived  = "archived"
+)
+
+// courseTransitions lists the allowed status changes and the Permit.io action
+// guarding each of them
+var courseTransitions = map[string]map[string]string{
+	CourseStatusDraft: {
+		CourseStatusPublished: "publish",
+		CourseStatusArchived:  "archive",
+	},
+	CourseStatusPublished: {
+		CourseStatusDraft:    "publish",
+		CourseStatusArchived: "archive",
+	},
+}
+
+// Term is an academic term courses are scheduled in
+type Term struct {
+	ID        string `json:"$id"`
+	Name      string `json:"name"`
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	TenantID  string `json:"tenantId"`
+}
+
+func termsCollectionID() string {
+	return getEnv("APPWRITE_TERMS_COLLECTION_ID", "terms")
+}
+
+// getTerm loads a term by ID. Terms of other tenants are reported as not found.
+func (s *LMSService) getTerm(termID, tenantID string) (*Term, error) {
+	doc, err := s.db.GetDocument(s.databaseID, termsCollectionID(), termID)
+	if err != nil {
+		return nil, err
+	}
+
+	var term Term
+	if err := json.Unmarshal([]byte(doc.(string)), &term); err != nil {
+		return nil, fmt.Errorf("failed to parse term: %w", err)
+	}
+
+	if term.TenantID != tenantID {
+		return nil, fmt.Errorf("term %s not found", termID)
+	}
+	return &term, nil
+}
+
+// checkEnrollmentOpen returns an error when students cannot enroll in the
+// course at the given time. Enrollment dates are inclusive and evaluated in
+// the course's timezone.
+func checkEnrollmentOpen(course *Course, now time.Time) error {
+	if course.Status != CourseStatusPublished {
+		return fmt.Errorf("course is not open for enrollment")
+	}
+
+	loc, err := courseLocation(course)
+	if err != nil {
+		return err
+	}
+
+	if course.EnrollmentStart != "" {
+		start, err := parseStartDate(course.EnrollmentStart, loc)
+		if err != nil {
+			return fmt.Errorf("invalid enrollment start date: %w", err)
+		}
+		if now.Before(start) {
+			return fmt.Errorf("enrollment opens on %s", course.EnrollmentStart)
+		}
+	}
+
+	if course.EnrollmentEnd != "" {
+		end, err := parseDeadline(course.EnrollmentEnd, loc)
+		if err != nil {
+			return fmt.Errorf("invalid enrollment end date: %w", err)
+		}
+		if now.After(end) {
+			return fmt.Errorf("enrollment closed on %s", course.EnrollmentEnd)
+		}
+	}
+
+	return nil
+}
+
+// checkCourseWritable returns an error when the course is archived and must
+// no longer change
+func checkCourseWritable(course *Course) error {
+	if course.Status == CourseStatusArchived {
+		return fmt.Errorf("course is archived and read-only")
+	}
+	return nil
+}
+
+// ListTerms returns the terms of the current tenant
+func (s *LMSService) ListTerms(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, "read", &models.ResourceInput{Type: "term"}); !ok {
+		return
+	}
+
+	documents, err := s.db.ListDocuments(
+		r.Context(),
+		s.databaseID,
+		termsCollectionID(),
+		[]interface{}{query.Equal("tenantId", getContextTenant(r))},
+	)
+	if err != nil {
+		log.Printf("Failed to get terms: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve terms")
+		return
+	}
+
+	var terms []Term
+	if err := json.Unmarshal([]byte(documents.(string)), &terms); err != nil {
+		log.Printf("Failed to unmarshal terms: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to process terms")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    terms,
+		"meta": map[string]interface{}{
+			"total": len(terms),
+		},
+	})
+}
+
+// CreateTerm adds an academic term
+func (s *LMSService) CreateTerm(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authorize(w, r, "create", &models.ResourceInput{Type: "term"})
+	if !ok {
+		return
+	}
+
+	var termData struct {
+		Name      string `json:"name"`
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&termData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if termData.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	start, err := time.Parse("2006-01-02", termData.StartDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Start date must be formatted as YYYY-MM-DD")
+		return
+	}
+	end, err := time.Parse("2006-01-02", termData.EndDate)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "End date must be formatted as YYYY-MM-DD")
+		return
+	}
+	if end.Before(start) {
+		respondWithError(w, http.StatusBadRequest, "End date must not be before start date")
+		return
+	}
+
+	tenantID := getContextTenant(r)
+	doc, err := s.db.CreateDocument(
+		r.Context(),
+		s.databaseID,
+		termsCollectionID(),
+		"unique()",
+		map[string]interface{}{
+			"name":      termData.Name,
+			"startDate": termData.StartDate,
+			"endDate":   termData.EndDate,
+			"tenantId":  tenantID,
+		},
+	)
+	if err != nil {
+		log.Printf("Error creating term: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to create term")
+		return
+	}
+
+	log.Printf("User %s created term %s", userID, doc.Get("$id"))
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"success": true,
+		"data":    doc,
+	})
+}
+
+// UpdateCourseStatus moves a course through its lifecycle
+// (draft, published, archived)
+func (s *LMSService) UpdateCourseStatus(w http.ResponseWriter, r *http.Request) {
+	courseID := mux.Vars(r)["id"]
+	tenantID := getContextTenant(r)
+
+	var requestData struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	course, err := s.getCourse(courseID, tenantID)
+	if err != nil {
+		log.Printf("Course not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "Course not found")
+		return
+	}
+
+	// Courses created before course statuses existed have none and start
+	// as drafts
+	if course.Status == "" {
+		course.Status = CourseStatusDraft
+	}
+
+	action, ok := courseTransitions[course.Status][requestData.Status]
+	if !ok {
+		respondWithError(w, http.StatusBadRequest,
+			fmt.Sprintf("Cannot change course status from %s to %s", course.Status, requestData.Status))
+		return
+	}
+
+	userID, ok := s.authorize(w, r, action, &models.ResourceInput{
+		Type: "course",
+		Key:  course.ID,
+		Attributes: map[string]interface{}{
+			"teacherId": course.TeacherID,
+			"status":    course.Status,
+		},
+	})
+	if !ok {
+		return
+	}
+
+	// Publishing requires a complete enrollment window
+	if requestData.Status == CourseStatusPublished && (course.EnrollmentStart == "" || course.EnrollmentEnd == "") {
+		respondWithError(w, http.StatusBadRequest, "Enrollment start and end dates are required to publish a course")
+		return
+	}
+
+	_, err = s.db.UpdateDocument(
+		s.databaseID,
+		getEnv("APPWRITE_COLLECTION_ID", "courses"),
+		course.ID,
+		map[string]interface{}{
+			"status": requestData.Status,
+		},
+		nil, // permissions
+	)
+	if err != nil {
+		log.Printf("Failed to update course status: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Failed to update course status")
+		return
+	}
+
+	previousStatus := course.Status
+	course.Status = requestData.Status
+
+	if err := s.syncCourse(r.Context(), course); err != nil {
+		log.Printf("Warning: Failed to sync course with Permit.io: %v", err)
+	}
+
+	log.Printf("User %s changed status of course %s from %s to %s",
+		userID, course.ID, previousStatus, course.Status)
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data":    course,
+	})
+}
@@ -13,7 +13,6 @@ export default function Register() {
   const [name, setName] = useState("")
   const [email, setEmail] = useState("")
   const [password, setPassword] = useState("")
-  const [role, setRole] = useState<"student" | "teacher" | "admin">("student")
   const [error, setError] = useState("")
   const [isLoading, setIsLoading] = useState(false)
 
@@ -23,7 +22,7 @@ export default function Register() {
     setIsLoading(true)
 
     try {
-      await createAccount(email, password, name, role)
+      await createAccount(email, password, name)
       router.push("/dashboard")
     } catch (error) {
       console.error("Registration error:", error)
@@ -83,22 +82,6 @@ export default function Register() {
             />
           </div>
 
-          <div>
-            <label htmlFor="role" className="block text-sm font-medium text-gray-700 mb-1">
-              Role
-            </label>
-            <select
-              id="role"
-              value={role}
-              onChange={(e) => setRole(e.target.value as "student" | "teacher" | "admin")}
-              className="w-full px-3 py-2 border border-gray-300 rounded-md"
-            >
-              <option value="student">Student</option>
-              <option value="teacher">Teacher</option>
-              <option value="admin">Admin</option>
-            </select>
-          </div>
-
           <button
             type="submit"
             disabled={isLoading}
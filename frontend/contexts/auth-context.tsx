@@ -14,7 +14,7 @@ interface AuthContextType {
   isLoading: boolean
   login: (email: string, password: string) => Promise<User>
   logout: () => Promise<void>
-  createAccount: (email: string, password: string, name: string, role: "admin" | "teacher" | "student") => Promise<User>
+  createAccount: (email: string, password: string, name: string) => Promise<User>
 }
 
 const AuthContext = createContext<AuthContextType | undefined>(undefined)
@@ -63,10 +63,9 @@ export const AuthProvider = ({ children }: { children: ReactNode }) => {
     email: string,
     password: string,
     name: string,
-    role: "admin" | "teacher" | "student",
   ) => {
     try {
-      const user = await appwriteCreateAccount(email, password, name, role)
+      const user = await appwriteCreateAccount(email, password, name)
       setUser(user)
       return user
     } catch (error) {
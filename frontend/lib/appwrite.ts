@@ -49,21 +49,23 @@ export interface Submission {
   feedback: string
 }
 
+// Roles are stored in server-controlled Appwrite labels, which users cannot change
+const ROLES = ["admin", "teacher", "student"] as const
+
+const roleFromLabels = (labels: string[] = []): User["role"] =>
+  ROLES.find((role) => labels.includes(role))
+
 // Auth functions
 export const createAccount = async (
   email: string,
   password: string,
   name: string,
-  role: "admin" | "teacher" | "student",
 ): Promise<User> => {
   try {
-    // Create account
+    // Create account; new users have no role until an admin assigns one
     const user = await account.create(ID.unique(), email, password, name)
 
-    // Update user preferences to store role
-    await account.updatePrefs({ role })
-
-    return { ...user, role }
+    return { ...user, role: roleFromLabels(user.labels) }
   } catch (error) {
     console.error("Error creating account:", error)
     throw error
@@ -78,10 +80,7 @@ export const login = async (email: string, password: string): Promise<User> => {
     // Get account
     const user = await account.get()
 
-    // Get user preferences
-    const prefs = await account.getPrefs()
-
-    return { ...user, role: prefs.role }
+    return { ...user, role: roleFromLabels(user.labels) }
   } catch (error) {
     console.error("Error logging in:", error)
     throw error
@@ -100,9 +99,8 @@ export const logout = async (): Promise<void> => {
 export const getCurrentUser = async (): Promise<User | null> => {
   try {
     const user = await account.get()
-    const prefs = await account.getPrefs()
 
-    return { ...user, role: prefs.role }
+    return { ...user, role: roleFromLabels(user.labels) }
   } catch (error) {
     return null
   }